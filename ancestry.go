@@ -0,0 +1,184 @@
+package lrutree
+
+// AncestryOption represents options for the ancestry queries: IsAncestor, LowestCommonAncestor, Depth and PathBetween.
+type AncestryOption func(*ancestryOptions)
+
+type ancestryOptions struct {
+	promote bool
+}
+
+// WithPromotion makes an ancestry query mark the queried nodes and their ancestors as recently used, like Get does.
+// By default, ancestry queries don't update the LRU order (like Peek).
+func WithPromotion() AncestryOption {
+	return func(opts *ancestryOptions) {
+		opts.promote = true
+	}
+}
+
+// Ancestry queries walk up the parent links of the queried nodes, so they take O(depth) time
+// and don't copy branches. They run under the read lock unless WithPromotion is used
+// (with WithBufferedPromotion, they always run under the read lock).
+// Missing and expired nodes are treated as absent.
+
+// IsAncestor reports whether the node with the key ancestor is a proper ancestor of the node with the key descendant
+// (a node is not an ancestor of itself). It returns false if either node doesn't exist.
+func (c *Cache[K, V]) IsAncestor(ancestor, descendant K, options ...AncestryOption) bool {
+	var isAncestor bool
+	c.queryAncestry(options, func(lookup func(key K) *treeNode[K, V]) []*treeNode[K, V] {
+		ancNode, descNode := lookup(ancestor), lookup(descendant)
+		if ancNode == nil || descNode == nil {
+			return nil
+		}
+		for n := descNode.parent; n != nil; n = n.parent {
+			if n == ancNode {
+				isAncestor = true
+				break
+			}
+		}
+		return []*treeNode[K, V]{ancNode, descNode}
+	})
+	return isAncestor
+}
+
+// LowestCommonAncestor returns the deepest node that is an ancestor of both nodes with the given keys.
+// A node is considered an ancestor of itself, so if one node is an ancestor of the other, it's returned.
+// It returns false if either node doesn't exist or the nodes belong to different trees (see WithMultipleRoots).
+func (c *Cache[K, V]) LowestCommonAncestor(a, b K, options ...AncestryOption) (CacheNode[K, V], bool) {
+	var lca *treeNode[K, V]
+	var cacheNode CacheNode[K, V]
+	c.queryAncestry(options, func(lookup func(key K) *treeNode[K, V]) []*treeNode[K, V] {
+		aNode, bNode := lookup(a), lookup(b)
+		if aNode == nil || bNode == nil {
+			return nil
+		}
+		if lca = lowestCommonAncestor(aNode, bNode); lca != nil {
+			cacheNode = lca.toCacheNode()
+		}
+		return []*treeNode[K, V]{aNode, bNode}
+	})
+	return cacheNode, lca != nil
+}
+
+// Depth returns the number of edges between the node with the given key and the root (0 for the root itself).
+// It returns false if the node doesn't exist.
+func (c *Cache[K, V]) Depth(key K, options ...AncestryOption) (int, bool) {
+	depth := -1
+	c.queryAncestry(options, func(lookup func(key K) *treeNode[K, V]) []*treeNode[K, V] {
+		node := lookup(key)
+		if node == nil {
+			return nil
+		}
+		depth = nodeDepth(node)
+		return []*treeNode[K, V]{node}
+	})
+	return depth, depth >= 0
+}
+
+// PathBetween returns the path from the node a to the node b through their lowest common ancestor:
+// nodes from a up to the common ancestor followed by nodes down to b, both ends inclusive.
+// For a == b, the path consists of the single node.
+// It returns false if either node doesn't exist or the nodes belong to different trees (see WithMultipleRoots).
+func (c *Cache[K, V]) PathBetween(a, b K, options ...AncestryOption) ([]CacheNode[K, V], bool) {
+	var path []CacheNode[K, V]
+	c.queryAncestry(options, func(lookup func(key K) *treeNode[K, V]) []*treeNode[K, V] {
+		aNode, bNode := lookup(a), lookup(b)
+		if aNode == nil || bNode == nil {
+			return nil
+		}
+		lca := lowestCommonAncestor(aNode, bNode)
+		if lca == nil {
+			return nil
+		}
+		aDepth, bDepth, lcaDepth := nodeDepth(aNode), nodeDepth(bNode), nodeDepth(lca)
+		path = make([]CacheNode[K, V], aDepth+bDepth-2*lcaDepth+1)
+		i := 0
+		for n := aNode; n != lca; n = n.parent {
+			path[i] = n.toCacheNode()
+			i++
+		}
+		path[i] = lca.toCacheNode()
+		i = len(path) - 1
+		for n := bNode; n != lca; n = n.parent {
+			path[i] = n.toCacheNode()
+			i--
+		}
+		return []*treeNode[K, V]{aNode, bNode}
+	})
+	return path, path != nil
+}
+
+// queryAncestry runs the query with a function that looks up non-expired nodes by keys,
+// and marks the nodes returned by the query (and their ancestors) as recently used if WithPromotion is used.
+func (c *Cache[K, V]) queryAncestry(
+	options []AncestryOption, query func(lookup func(key K) *treeNode[K, V]) []*treeNode[K, V],
+) {
+	var opts ancestryOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	if !opts.promote || c.accessBuf != nil {
+		nodes := func() []*treeNode[K, V] {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+
+			now := c.now()
+			return query(func(key K) *treeNode[K, V] {
+				node, exists := c.keysMap[key]
+				if !exists || node.isExpired(now) {
+					return nil
+				}
+				return node
+			})
+		}()
+		if opts.promote {
+			for _, node := range nodes {
+				c.recordAccess(node)
+			}
+		}
+		return
+	}
+
+	var reapedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(reapedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	nodes := query(func(key K) *treeNode[K, V] {
+		node, exists := c.keysMap[key]
+		if !exists || c.reapIfExpired(node, now, &reapedNodes) {
+			return nil
+		}
+		return node
+	})
+	for _, node := range nodes {
+		for n := node; n != nil; n = n.parent {
+			c.promote(n)
+		}
+	}
+}
+
+// lowestCommonAncestor returns the lowest common ancestor of the nodes, or nil if they belong to different trees.
+func lowestCommonAncestor[K comparable, V any](a, b *treeNode[K, V]) *treeNode[K, V] {
+	aDepth, bDepth := nodeDepth(a), nodeDepth(b)
+	for ; aDepth > bDepth; aDepth-- {
+		a = a.parent
+	}
+	for ; bDepth > aDepth; bDepth-- {
+		b = b.parent
+	}
+	for a != b {
+		a, b = a.parent, b.parent
+	}
+	return a
+}
+
+func nodeDepth[K comparable, V any](node *treeNode[K, V]) int {
+	depth := 0
+	for n := node.parent; n != nil; n = n.parent {
+		depth++
+	}
+	return depth
+}
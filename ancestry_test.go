@@ -0,0 +1,168 @@
+package lrutree
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_Ancestry(t *testing.T) {
+	// root
+	// ├── org-1
+	// │   ├── eng
+	// │   │   ├── frontend
+	// │   │   └── backend
+	// │   └── sales
+	// └── org-2
+	newCache := func(options ...CacheOption[string, int]) *Cache[string, int] {
+		cache := NewCache[string, int](10, options...)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("org-1", 1, "root"))
+		assertNoError(t, cache.Add("eng", 2, "org-1"))
+		assertNoError(t, cache.Add("frontend", 3, "eng"))
+		assertNoError(t, cache.Add("backend", 4, "eng"))
+		assertNoError(t, cache.Add("sales", 5, "org-1"))
+		assertNoError(t, cache.Add("org-2", 6, "root"))
+		return cache
+	}
+
+	t.Run("IsAncestor", func(t *testing.T) {
+		cache := newCache()
+		assertTrue(t, cache.IsAncestor("root", "frontend"))
+		assertTrue(t, cache.IsAncestor("org-1", "frontend"))
+		assertTrue(t, cache.IsAncestor("eng", "backend"))
+		assertFalse(t, cache.IsAncestor("frontend", "org-1"))
+		assertFalse(t, cache.IsAncestor("eng", "eng"))
+		assertFalse(t, cache.IsAncestor("org-2", "frontend"))
+		assertFalse(t, cache.IsAncestor("sales", "frontend"))
+		assertFalse(t, cache.IsAncestor("nonexistent", "frontend"))
+		assertFalse(t, cache.IsAncestor("root", "nonexistent"))
+	})
+
+	t.Run("LowestCommonAncestor", func(t *testing.T) {
+		cache := newCache()
+		tests := []struct {
+			a, b     string
+			expected string
+		}{
+			{"frontend", "backend", "eng"},
+			{"frontend", "sales", "org-1"},
+			{"sales", "frontend", "org-1"},
+			{"frontend", "org-2", "root"},
+			{"eng", "backend", "eng"},
+			{"backend", "eng", "eng"},
+			{"frontend", "frontend", "frontend"},
+			{"root", "sales", "root"},
+		}
+		for _, tt := range tests {
+			lca, ok := cache.LowestCommonAncestor(tt.a, tt.b)
+			assertTrue(t, ok)
+			assertEqual(t, tt.expected, lca.Key)
+		}
+		lca, ok := cache.LowestCommonAncestor("frontend", "backend")
+		assertTrue(t, ok)
+		assertEqual(t, CacheNode[string, int]{Key: "eng", Value: 2, ParentKey: "org-1"}, lca)
+
+		_, ok = cache.LowestCommonAncestor("frontend", "nonexistent")
+		assertFalse(t, ok)
+	})
+
+	t.Run("Depth", func(t *testing.T) {
+		cache := newCache()
+		for key, expected := range map[string]int{"root": 0, "org-1": 1, "eng": 2, "backend": 3, "org-2": 1} {
+			depth, ok := cache.Depth(key)
+			assertTrue(t, ok)
+			assertEqual(t, expected, depth)
+		}
+		_, ok := cache.Depth("nonexistent")
+		assertFalse(t, ok)
+	})
+
+	t.Run("PathBetween", func(t *testing.T) {
+		cache := newCache()
+		pathKeys := func(a, b string) []string {
+			path, ok := cache.PathBetween(a, b)
+			assertTrue(t, ok)
+			keys := make([]string, 0, len(path))
+			for _, node := range path {
+				keys = append(keys, node.Key)
+			}
+			return keys
+		}
+		assertEqual(t, []string{"frontend", "eng", "backend"}, pathKeys("frontend", "backend"))
+		assertEqual(t, []string{"frontend", "eng", "org-1", "sales"}, pathKeys("frontend", "sales"))
+		assertEqual(t, []string{"sales", "org-1", "root", "org-2"}, pathKeys("sales", "org-2"))
+		assertEqual(t, []string{"backend", "eng", "org-1"}, pathKeys("backend", "org-1"))
+		assertEqual(t, []string{"root", "org-1", "eng"}, pathKeys("root", "eng"))
+		assertEqual(t, []string{"eng"}, pathKeys("eng", "eng"))
+
+		path, _ := cache.PathBetween("frontend", "sales")
+		assertEqual(t, CacheNode[string, int]{Key: "frontend", Value: 3, ParentKey: "eng"}, path[0])
+		assertEqual(t, CacheNode[string, int]{Key: "sales", Value: 5, ParentKey: "org-1"}, path[3])
+
+		_, ok := cache.PathBetween("nonexistent", "sales")
+		assertFalse(t, ok)
+	})
+
+	t.Run("different trees", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithMultipleRoots[string, int]())
+		assertNoError(t, cache.AddRoot("tenant-1", 1))
+		assertNoError(t, cache.Add("eng", 2, "tenant-1"))
+		assertNoError(t, cache.AddRoot("tenant-2", 3))
+		assertNoError(t, cache.Add("sales", 4, "tenant-2"))
+
+		assertFalse(t, cache.IsAncestor("tenant-1", "sales"))
+		_, ok := cache.LowestCommonAncestor("eng", "sales")
+		assertFalse(t, ok)
+		_, ok = cache.PathBetween("eng", "sales")
+		assertFalse(t, ok)
+		depth, _ := cache.Depth("sales")
+		assertEqual(t, 1, depth)
+	})
+
+	t.Run("expired nodes", func(t *testing.T) {
+		now := time.Now()
+		cache := newCache()
+		cache.now = func() time.Time { return now }
+		assertNoError(t, cache.AddWithTTL("tmp", 7, "eng", time.Minute))
+		assertTrue(t, cache.IsAncestor("eng", "tmp"))
+		now = now.Add(time.Minute)
+		assertFalse(t, cache.IsAncestor("eng", "tmp"))
+		_, ok := cache.Depth("tmp", WithPromotion())
+		assertFalse(t, ok)
+		assertEqual(t, 7, cache.Len()) // The expired node is reaped when promotion is requested.
+	})
+
+	t.Run("promotion", func(t *testing.T) {
+		cache := newCache()
+		initialOrder := []string{"root", "org-2", "org-1", "sales", "eng", "backend", "frontend"}
+		assertEqual(t, initialOrder, getLRUOrder(cache))
+
+		// Queries don't update the LRU order by default.
+		cache.IsAncestor("org-1", "frontend")
+		cache.LowestCommonAncestor("frontend", "sales")
+		cache.Depth("frontend")
+		cache.PathBetween("frontend", "org-2")
+		assertEqual(t, initialOrder, getLRUOrder(cache))
+
+		assertTrue(t, cache.IsAncestor("org-1", "frontend", WithPromotion()))
+		assertEqual(t, []string{"root", "org-1", "eng", "frontend", "org-2", "sales", "backend"}, getLRUOrder(cache))
+
+		_, ok := cache.PathBetween("sales", "org-2", WithPromotion())
+		assertTrue(t, ok)
+		assertEqual(t, []string{"root", "org-2", "org-1", "sales", "eng", "frontend", "backend"}, getLRUOrder(cache))
+
+		_, ok = cache.Depth("backend", WithPromotion())
+		assertTrue(t, ok)
+		assertEqual(t, []string{"root", "org-1", "eng", "backend", "org-2", "sales", "frontend"}, getLRUOrder(cache))
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("buffered promotion", func(t *testing.T) {
+		cache := newCache(WithBufferedPromotion[string, int](0))
+		defer cache.Close()
+
+		_, ok := cache.LowestCommonAncestor("sales", "org-2", WithPromotion())
+		assertTrue(t, ok)
+		assertEqual(t, []string{"root", "org-2", "org-1", "sales", "eng", "backend", "frontend"}, drainedLRUOrder(cache))
+	})
+}
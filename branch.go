@@ -0,0 +1,182 @@
+package lrutree
+
+// AddBranch inserts a whole branch into the cache in one call.
+//
+// The branch is ordered from the topmost node (index 0) to the leaf (last index), like the result of GetBranch.
+// Each node must be a child of the previous one (ParentKey is equal to the key of the previous node),
+// otherwise ErrInvalidBranch is returned.
+// The first node may be an existing root node, a node present in the cache,
+// or a new node whose parent is present in the cache (ErrParentNotExist is returned otherwise).
+// A first node with a zero ParentKey that is not present in the cache is added as a new root node
+// if the cache has no root yet or multiple roots are allowed (ErrRootAlreadyExists is returned otherwise).
+//
+// Missing nodes are created, and existing nodes are kept as is.
+// If an existing node has a different parent than in the branch, ErrAlreadyExists is returned.
+// Validation is done before any changes (expired nodes are treated as missing, but not reaped),
+// so on error the cache is left unmodified.
+//
+// All nodes of the branch (and their ancestors) are marked as recently used. Eviction happens only once
+// after the whole branch is inserted and never evicts the nodes of the branch. If the branch alone
+// exceeds the capacity, the cache may hold more entries than its capacity until the next eviction.
+func (c *Cache[K, V]) AddBranch(branch []CacheNode[K, V]) error {
+	defer c.observe(OpAddBranch)()
+
+	_, err := c.addBranch(branch, false)
+	return err
+}
+
+// AddOrUpdateBranch works like AddBranch, but existing nodes are updated with the values from the branch
+// and reparented if their parents differ from the branch. Old values are reported via the WithOnRemove callback
+// with RemovalReplaced reason.
+// ErrCycleDetected is returned if reparenting would create a cycle.
+func (c *Cache[K, V]) AddOrUpdateBranch(branch []CacheNode[K, V]) error {
+	defer c.observe(OpAddBranch)()
+
+	_, err := c.addBranch(branch, true)
+	return err
+}
+
+func (c *Cache[K, V]) addBranch(branch []CacheNode[K, V], update bool) (CacheNode[K, V], error) {
+	branchKeys, err := checkBranch(branch)
+	if err != nil {
+		return CacheNode[K, V]{}, err
+	}
+
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	// peek is used for validation, so expired nodes are not reaped until the branch is known to be valid.
+	peek := func(key K) *treeNode[K, V] {
+		node, exists := c.keysMap[key]
+		if !exists || node.isExpired(now) {
+			return nil
+		}
+		return node
+	}
+	lookup := func(key K) *treeNode[K, V] {
+		node, exists := c.keysMap[key]
+		if !exists || c.reapIfExpired(node, now, &evictedNodes) {
+			return nil
+		}
+		return node
+	}
+
+	// Find the anchor node that the branch is attached to.
+	// It's nil if the first node of the branch is a root node (an existing or a new one).
+	var anchor *treeNode[K, V]
+	if _, isRoot := c.roots[branch[0].Key]; !isRoot {
+		if anchor = peek(branch[0].ParentKey); anchor == nil {
+			var zeroKey K
+			switch {
+			case branch[0].ParentKey != zeroKey:
+				return CacheNode[K, V]{}, ErrParentNotExist
+			case !c.multipleRoots && len(c.roots) != 0:
+				return CacheNode[K, V]{}, ErrRootAlreadyExists
+			case peek(branch[0].Key) != nil:
+				return CacheNode[K, V]{}, ErrAlreadyExists // An existing node can't become a root.
+			}
+		}
+	}
+
+	// Validate the branch against the cache state before making any changes.
+	if update {
+		// Nodes of the branch will be moved under the anchor, so none of them may be its ancestor.
+		for n := anchor; n != nil; n = n.parent {
+			if _, exists := branchKeys[n.key]; exists {
+				c.reportCycleRejection()
+				return CacheNode[K, V]{}, ErrCycleDetected
+			}
+		}
+	} else {
+		// Existing nodes must already be linked in the same way as in the branch.
+		// A nil expected parent for a non-first node means that the previous node is new.
+		expectedParent := anchor
+		for i, branchNode := range branch {
+			node := peek(branchNode.Key)
+			if node == nil {
+				expectedParent = nil
+				continue
+			}
+			if node.parent != expectedParent || (i != 0 && expectedParent == nil) {
+				return CacheNode[K, V]{}, ErrAlreadyExists
+			}
+			expectedParent = node
+		}
+	}
+
+	var newKeys []K
+	for _, branchNode := range branch {
+		if peek(branchNode.Key) == nil {
+			newKeys = append(newKeys, branchNode.Key)
+		}
+	}
+	if !c.claimKeys(newKeys...) {
+		return CacheNode[K, V]{}, ErrAlreadyExists
+	}
+
+	protected := make(map[*treeNode[K, V]]struct{}, len(branch))
+	insertedCount := 0
+	parent := anchor
+	for _, branchNode := range branch {
+		node := lookup(branchNode.Key)
+		switch {
+		case node == nil:
+			node = c.insertNode(branchNode.Key, branchNode.Value, parent)
+			if parent != nil {
+				c.setExpiration(node, expirationTime(now, c.defaultTTL))
+			}
+			insertedCount++
+		case update:
+			if node.parent != nil || !c.rootReplica {
+				c.trackReplaced(node.toCacheNode(), &evictedNodes)
+			}
+			reparented := node.parent != parent
+			if reparented {
+				c.setParent(node, parent)
+			}
+			c.setValue(node, branchNode.Value)
+			c.reportUpdate(reparented)
+			if parent != nil {
+				c.setExpiration(node, expirationTime(now, c.defaultTTL))
+			}
+		}
+		protected[node] = struct{}{}
+		parent = node
+	}
+
+	leaf := parent
+	for n := leaf; n != nil; n = n.parent {
+		c.promote(n)
+	}
+
+	c.evictIfNeeded(&evictedNodes, protected)
+
+	c.reportInserts(insertedCount)
+	c.reportAmount()
+
+	return leaf.toCacheNode(), nil
+}
+
+// checkBranch checks that the branch is not empty, has no duplicate keys, and every node is a child of the previous one.
+// It returns the set of keys of the branch.
+func checkBranch[K comparable, V any](branch []CacheNode[K, V]) (map[K]struct{}, error) {
+	if len(branch) == 0 {
+		return nil, ErrInvalidBranch
+	}
+	branchKeys := make(map[K]struct{}, len(branch))
+	for i, branchNode := range branch {
+		if _, exists := branchKeys[branchNode.Key]; exists {
+			return nil, ErrInvalidBranch
+		}
+		branchKeys[branchNode.Key] = struct{}{}
+		if i > 0 && branchNode.ParentKey != branch[i-1].Key {
+			return nil, ErrInvalidBranch
+		}
+	}
+	return branchKeys, nil
+}
@@ -0,0 +1,183 @@
+package lrutree
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_AddBranch(t *testing.T) {
+	makeBranch := func(keys ...string) []CacheNode[string, int] {
+		branch := make([]CacheNode[string, int], len(keys))
+		for i, key := range keys {
+			branch[i] = CacheNode[string, int]{Key: key, Value: i + 1}
+			if i > 0 {
+				branch[i].ParentKey = keys[i-1]
+			}
+		}
+		return branch
+	}
+
+	t.Run("into empty cache", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddBranch(makeBranch("root", "sub-root", "partner-1", "customer-1")))
+		assertEqual(t, makeBranch("root", "sub-root", "partner-1", "customer-1"), cache.PeekBranch("customer-1"))
+		assertEqual(t, []string{"root", "sub-root", "partner-1", "customer-1"}, getLRUOrder(cache))
+		assertErrorIs(t, cache.AddRoot("root", 1), ErrRootAlreadyExists)
+
+		// A new root can't have a parent.
+		cache = NewCache[string, int](10)
+		branch := makeBranch("x", "y")
+		branch[0].ParentKey = "root"
+		assertErrorIs(t, cache.AddBranch(branch), ErrParentNotExist)
+		assertEqual(t, 0, cache.Len())
+	})
+
+	t.Run("inverse of GetBranch", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root", 2, "root"))
+		assertNoError(t, cache.Add("partner-1", 3, "sub-root"))
+		branch := cache.GetBranch("partner-1")
+
+		otherCache := NewCache[string, int](10)
+		assertNoError(t, otherCache.AddBranch(branch))
+		assertEqual(t, branch, otherCache.GetBranch("partner-1"))
+	})
+
+	t.Run("attaches to existing nodes", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root", 2, "root"))
+		assertNoError(t, cache.Add("partner-2", 20, "sub-root"))
+
+		// Branch starts with an existing node whose value is kept.
+		branch := makeBranch("sub-root", "partner-1", "customer-1")
+		branch[0].ParentKey = "root"
+		assertNoError(t, cache.AddBranch(branch))
+		cacheNode, _ := cache.Peek("sub-root")
+		assertEqual(t, 2, cacheNode.Value)
+		assertEqual(t, []string{"root", "sub-root", "partner-1", "customer-1", "partner-2"}, getLRUOrder(cache))
+
+		// Branch starts with a new node whose parent exists.
+		branch = makeBranch("partner-3", "customer-3")
+		branch[0].ParentKey = "sub-root"
+		assertNoError(t, cache.AddBranch(branch))
+		assertEqual(t, 3, len(cache.PeekBranch("partner-3")))
+		assertEqual(t, 4, len(cache.PeekBranch("customer-3")))
+		assertEqual(t, 7, cache.Len())
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root", 2, "root"))
+		assertNoError(t, cache.Add("partner-1", 3, "sub-root"))
+
+		assertErrorIs(t, cache.AddBranch(nil), ErrInvalidBranch)
+
+		branch := makeBranch("root", "sub-root", "partner-1")
+		branch[2].ParentKey = "root"
+		assertErrorIs(t, cache.AddBranch(branch), ErrInvalidBranch)
+
+		branch = makeBranch("root", "sub-root", "root")
+		assertErrorIs(t, cache.AddBranch(branch), ErrInvalidBranch)
+
+		branch = makeBranch("partner-2", "customer-2")
+		branch[0].ParentKey = "nonexistent"
+		assertErrorIs(t, cache.AddBranch(branch), ErrParentNotExist)
+
+		// Existing node has another parent.
+		assertErrorIs(t, cache.AddBranch(makeBranch("root", "partner-1")), ErrAlreadyExists)
+		assertErrorIs(t, cache.AddBranch(makeBranch("root", "partner-2", "partner-1")), ErrAlreadyExists)
+
+		// The cache already has a root.
+		assertErrorIs(t, cache.AddBranch(makeBranch("root2", "partner-2")), ErrRootAlreadyExists)
+
+		// Nothing is changed on error.
+		assertEqual(t, 3, cache.Len())
+		assertEqual(t, []string{"root", "sub-root", "partner-1"}, getLRUOrder(cache))
+	})
+
+	t.Run("expired nodes are not reaped on validation error", func(t *testing.T) {
+		now := time.Now()
+		cache := NewCache[string, int](10)
+		cache.now = func() time.Time { return now }
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.AddWithTTL("sub-root", 2, "root", time.Minute))
+		assertNoError(t, cache.Add("partner-1", 3, "root"))
+		now = now.Add(time.Minute)
+
+		assertErrorIs(t, cache.AddBranch(makeBranch("root", "sub-root", "partner-1")), ErrAlreadyExists)
+		assertEqual(t, 3, cache.Len())
+
+		// The expired node is replaced by the new one.
+		assertNoError(t, cache.AddBranch(makeBranch("root", "sub-root", "partner-2")))
+		assertEqual(t, makeBranch("root", "sub-root", "partner-2"), cache.PeekBranch("partner-2"))
+		assertEqual(t, 4, cache.Len())
+	})
+
+	t.Run("eviction never removes branch nodes", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, int](4, WithOnEvict(func(node CacheNode[string, int]) {
+			evicted = append(evicted, node.Key)
+		}))
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("other-1", 2, "root"))
+		assertNoError(t, cache.Add("other-2", 3, "root"))
+
+		branch := makeBranch("root", "sub-root", "partner-1")
+		assertNoError(t, cache.AddBranch(branch))
+		assertEqual(t, []string{"other-1"}, evicted)
+		assertEqual(t, []string{"root", "sub-root", "partner-1", "other-2"}, getLRUOrder(cache))
+
+		// The branch alone exceeds the capacity.
+		evicted = nil
+		branch = makeBranch("root", "a", "b", "c", "d")
+		assertNoError(t, cache.AddBranch(branch))
+		assertEqual(t, []string{"other-2", "partner-1", "sub-root"}, evicted)
+		assertEqual(t, []string{"root", "a", "b", "c", "d"}, getLRUOrder(cache))
+	})
+}
+
+func TestCache_AddOrUpdateBranch(t *testing.T) {
+	t.Run("updates and reparents existing nodes", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root", 2, "root"))
+		assertNoError(t, cache.Add("partner-1", 3, "sub-root"))
+		assertNoError(t, cache.Add("customer-1", 4, "partner-1"))
+
+		branch := []CacheNode[string, int]{
+			{Key: "root", Value: 10},
+			{Key: "partner-1", Value: 30, ParentKey: "root"},
+			{Key: "sub-root", Value: 20, ParentKey: "partner-1"},
+			{Key: "customer-2", Value: 50, ParentKey: "sub-root"},
+		}
+		assertNoError(t, cache.AddOrUpdateBranch(branch))
+		assertEqual(t, branch, cache.PeekBranch("customer-2"))
+
+		// The subtree of the reparented node is moved with it.
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "root", Value: 10},
+			{Key: "partner-1", Value: 30, ParentKey: "root"},
+			{Key: "customer-1", Value: 4, ParentKey: "partner-1"},
+		}, cache.PeekBranch("customer-1"))
+		assertEqual(t, 5, cache.Len())
+	})
+
+	t.Run("cycle detection", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root", 2, "root"))
+		assertNoError(t, cache.Add("partner-1", 3, "sub-root"))
+
+		branch := []CacheNode[string, int]{
+			{Key: "customer-1", Value: 4, ParentKey: "partner-1"},
+			{Key: "sub-root", Value: 5, ParentKey: "customer-1"},
+		}
+		assertErrorIs(t, cache.AddOrUpdateBranch(branch), ErrCycleDetected)
+		assertEqual(t, 3, cache.Len())
+		_, ok := cache.Peek("customer-1")
+		assertFalse(t, ok)
+	})
+}
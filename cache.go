@@ -2,8 +2,12 @@ package lrutree
 
 import (
 	"container/list"
+	"context"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -11,6 +15,8 @@ var (
 	ErrParentNotExist    = errors.New("parent node does not exist")
 	ErrAlreadyExists     = errors.New("node already exists")
 	ErrCycleDetected     = errors.New("cycle detected")
+	ErrInvalidBranch     = errors.New("invalid branch")
+	ErrNodeNotExist      = errors.New("node does not exist")
 )
 
 // StatsCollector is an interface for collecting cache metrics and statistics.
@@ -24,10 +30,17 @@ type StatsCollector interface {
 	// IncMisses increments the total number of not found keys in the cache.
 	IncMisses()
 
-	// AddEvictions increments the total number of evicted entries.
+	// AddEvictions increments the total number of entries evicted because of the capacity limit.
 	AddEvictions(int)
 }
 
+// CostStatsCollector is an optional interface that may be implemented by StatsCollector
+// to receive the total cost of entries in the cache (see WithCostFunc).
+type CostStatsCollector interface {
+	// SetCost sets the total cost of entries in the cache.
+	SetCost(int64)
+}
+
 // Cache is a hierarchical cache with LRU (Least Recently Used) eviction policy.
 //
 // It maintains parent-child relationships between nodes in a tree structure while
@@ -37,20 +50,59 @@ type StatsCollector interface {
 //   - Each node has a unique key and is identified by that key.
 //   - Nodes form a tree structure with parent-child relationships.
 //   - Each node (except root) has exactly one parent and possibly multiple children.
+//   - There is a single root node, unless WithMultipleRoots is used (then the cache holds a forest of trees).
 //   - When a node is accessed, both it and all its ancestors are marked as recently used.
-//   - When eviction occurs, the least recently used node is removed. It guarantees the evicted node is a leaf.
+//   - When eviction occurs, the least recently used node is removed (or the node selected by the EvictionPolicy).
+//     It guarantees the evicted node is a leaf. Pinned nodes are never evicted.
 //   - If a node is present in the cache, all its ancestors up to the root are guaranteed to be present.
+//   - Nodes may have a TTL. An expired node is treated as missing, and ancestors never expire before their descendants.
 //
 // This cache is particularly useful for hierarchical data where accessing a child
 // implies that its ancestors are also valuable and should remain in cache.
 type Cache[K comparable, V any] struct {
-	maxEntries int
-	onEvict    func(node CacheNode[K, V])
-	stats      StatsCollector
-	mu         sync.RWMutex
-	keysMap    map[K]*treeNode[K, V]
-	lruList    *list.List
-	root       *treeNode[K, V]
+	maxEntries      int
+	onEvict         func(node CacheNode[K, V])
+	onRemove        func(node CacheNode[K, V], reason RemovalReason)
+	stats           StatsCollector
+	costStats       CostStatsCollector
+	extStats        ExtendedStatsCollector
+	maxCost         int64
+	costFunc        func(key K, val V) int64
+	totalCost       int64
+	defaultTTL      time.Duration
+	expirationMode  ExpirationMode
+	janitorInterval time.Duration
+	janitorStop     chan struct{}
+	janitorDone     chan struct{}
+	expirations     *expirationQueue[K, V] // Nodes ordered by expiration times, maintained only for the janitor.
+	closeOnce       sync.Once
+	now             func() time.Time
+	loader          Loader[K, V]
+	loadMu          sync.Mutex
+	loadCalls       map[K]*loadCall[K, V]
+	refreshAfter    time.Duration
+	onRefreshError  func(key K, err error)
+	refreshing      map[K]struct{} // Keys being refreshed in background. Guarded by loadMu.
+	refreshCtx      context.Context
+	refreshStop     context.CancelFunc
+	refreshWG       sync.WaitGroup
+	onInsert        func(key K)      // Called under the lock when a node is inserted. Used by ShardedCache.
+	onDelete        func(key K)      // Called under the lock when a node is deleted. Used by ShardedCache.
+	claimKey        func(key K) bool // Called under the lock before a new node is inserted. Used by ShardedCache.
+	rootReplica     bool             // The root node is a replica, so its removal is not reported. Used by ShardedCache.
+	accessBuf       *accessBuffer[K, V]
+	policy          EvictionPolicy[K]
+	pinnedCount     int
+	pinnedOverflow  bool
+	mu              sync.RWMutex
+	keysMap         map[K]*treeNode[K, V]
+	lruList         *list.List
+	roots           map[K]*treeNode[K, V]
+	multipleRoots   bool
+	negatives       map[K]*treeNode[K, V]        // Tombstones of nodes known to be absent (see AddNegative).
+	quotaNodes      map[*treeNode[K, V]]struct{} // Roots of subtrees with quotas (see SetSubtreeQuota).
+	resolversCount  int                          // Number of memo slots allocated by NewResolver.
+	memoGen         uint64                       // Incremented whenever memoized results may become stale (see Resolver).
 }
 
 // CacheNode represents a node in the cache with its key, value, and parent key.
@@ -62,11 +114,22 @@ type CacheNode[K comparable, V any] struct {
 }
 
 type treeNode[K comparable, V any] struct {
-	key      K
-	val      V
-	parent   *treeNode[K, V]
-	children map[K]*treeNode[K, V]
-	lruElem  *list.Element
+	key              K
+	val              V
+	parent           *treeNode[K, V]
+	children         map[K]*treeNode[K, V]
+	descendants      int // Number of nodes in the subtree excluding the node itself (see SubtreeSize).
+	lruElem          *list.Element
+	expiresAt        time.Time // Zero value means the node never expires.
+	updatedAt        time.Time // Time when the value was set (see WithRefreshAfter).
+	refreshFailedAt  time.Time // Time when the last reload failed (see WithRefreshAfter).
+	cost             int64
+	pinned           bool
+	quota            int                   // Maximum number of nodes in the subtree, 0 means no quota (see SetSubtreeQuota).
+	childrenComplete bool                  // Children in the cache are the complete child set (see MarkChildrenComplete).
+	absent           bool                  // The node is a tombstone of a node known to be absent (see AddNegative).
+	absentChildren   map[K]*treeNode[K, V] // Tombstones of children known to be absent.
+	memo             atomic.Pointer[[]any] // Results memoized by resolvers, indexed by their slots (see Resolver).
 }
 
 func newTreeNode[K comparable, V any](key K, val V, parent *treeNode[K, V]) *treeNode[K, V] {
@@ -83,9 +146,18 @@ func (n *treeNode[K, V]) removeFromParent() {
 		return
 	}
 	delete(n.parent.children, n.key)
+	n.parent.childrenComplete = false
+	n.parent.addDescendants(-(n.descendants + 1))
 	n.parent = nil
 }
 
+// addDescendants adds delta to the number of descendants of the node and all its ancestors.
+func (n *treeNode[K, V]) addDescendants(delta int) {
+	for p := n; p != nil; p = p.parent {
+		p.descendants += delta
+	}
+}
+
 func (n *treeNode[K, V]) parentKey() K {
 	if n.parent != nil {
 		return n.parent.key
@@ -94,8 +166,16 @@ func (n *treeNode[K, V]) parentKey() K {
 	return zeroKey
 }
 
+func (n *treeNode[K, V]) toCacheNode() CacheNode[K, V] {
+	return CacheNode[K, V]{Key: n.key, Value: n.val, ParentKey: n.parentKey()}
+}
+
 type CacheOption[K comparable, V any] func(*Cache[K, V])
 
+// WithOnEvict sets a callback that is called for every node evicted from the cache
+// because of the capacity limit or expiration.
+// The callback is invoked outside the cache lock.
+// See WithOnRemove for a callback that is called for all removed nodes.
 func WithOnEvict[K comparable, V any](onEvict func(node CacheNode[K, V])) CacheOption[K, V] {
 	return func(c *Cache[K, V]) {
 		c.onEvict = onEvict
@@ -103,23 +183,64 @@ func WithOnEvict[K comparable, V any](onEvict func(node CacheNode[K, V])) CacheO
 }
 
 // WithStatsCollector sets a stats collector for the cache.
+// If the collector also implements CostStatsCollector, it receives the total cost of entries.
+// If it implements ExtendedStatsCollector, it receives detailed counters and latencies of operations.
+// Stats is a ready-to-use collector that implements all of them.
 func WithStatsCollector[K comparable, V any](stats StatsCollector) CacheOption[K, V] {
 	return func(c *Cache[K, V]) {
 		c.stats = stats
 	}
 }
 
+// WithMaxCost limits the total cost of entries in the cache.
+// When the limit is exceeded, the least recently used leaf nodes are evicted until the total cost fits.
+// The limit is applied in addition to the maximum number of entries passed to NewCache (0 there means no limit).
+// The root node is never evicted, even if its cost alone exceeds the limit.
+// A node whose cost alone exceeds the limit is rejected by Add and AddOrUpdate with ErrCapacityExhausted.
+func WithMaxCost[K comparable, V any](maxCost int64) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.maxCost = maxCost
+	}
+}
+
+// WithCostFunc sets a function that calculates the cost of an entry.
+// The cost is calculated when the node is added and recalculated when its value is updated.
+// By default, every entry costs 1.
+func WithCostFunc[K comparable, V any](costFunc func(key K, val V) int64) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.costFunc = costFunc
+	}
+}
+
 // NewCache creates a new cache with the given maximum number of entries and eviction callback.
 func NewCache[K comparable, V any](maxEntries int, options ...CacheOption[K, V]) *Cache[K, V] {
 	c := &Cache[K, V]{
 		maxEntries: maxEntries,
 		keysMap:    make(map[K]*treeNode[K, V]),
+		roots:      make(map[K]*treeNode[K, V]),
+		negatives:  make(map[K]*treeNode[K, V]),
 		lruList:    list.New(),
 		stats:      nullStats{}, // Use null object by default
+		now:        time.Now,
 	}
 	for _, opt := range options {
 		opt(c)
 	}
+	if costStats, ok := c.stats.(CostStatsCollector); ok {
+		c.costStats = costStats
+	}
+	if extStats, ok := c.stats.(ExtendedStatsCollector); ok {
+		c.extStats = extStats
+	}
+	if c.janitorInterval > 0 {
+		c.startJanitor()
+	}
+	if c.accessBuf != nil {
+		c.startAccessBufferDrainer()
+	}
+	if c.refreshAfter > 0 && c.loader != nil {
+		c.refreshCtx, c.refreshStop = context.WithCancel(context.Background())
+	}
 	return c
 }
 
@@ -128,28 +249,46 @@ func NewCache[K comparable, V any](maxEntries int, options ...CacheOption[K, V])
 // This is useful for checking if a value exists without affecting its position in the eviction order.
 // Unlike Get(), this method doesn't mark the node as recently used.
 func (c *Cache[K, V]) Peek(key K) (CacheNode[K, V], bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	node, exists := c.keysMap[key]
-	if !exists {
-		c.stats.IncMisses()
-		return CacheNode[K, V]{}, false
-	}
+	defer c.observe(OpPeek)()
 
-	c.stats.IncHits()
-	return CacheNode[K, V]{Key: key, Value: node.val, ParentKey: node.parentKey()}, true
+	_, cacheNode, ok := c.peek(key)
+	return cacheNode, ok
 }
 
 // Get retrieves a value from the cache and updates LRU order.
 //
 // This method has a side effect of marking the node and all its ancestors as recently used,
 // moving them to the front of the LRU list and protecting them from immediate eviction.
+// If WithBufferedPromotion is used, the LRU order is updated lazily (see its documentation for details).
+// If WithRefreshAfter is used and the value is stale, it's returned immediately and reloaded in the background.
 func (c *Cache[K, V]) Get(key K) (CacheNode[K, V], bool) {
+	defer c.observe(OpGet)()
+
+	var staleNode *treeNode[K, V]
+	defer func() {
+		if staleNode != nil {
+			c.refreshAsync(key, staleNode)
+		}
+	}()
+
+	if c.accessBuf != nil {
+		var cacheNode CacheNode[K, V]
+		var ok bool
+		cacheNode, staleNode, ok = c.getBuffered(key)
+		return cacheNode, ok
+	}
+
+	var reapedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(reapedNodes) }()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	now := c.now()
 	node, exists := c.keysMap[key]
+	if exists && c.reapIfExpired(node, now, &reapedNodes) {
+		exists = false
+	}
 	if !exists {
 		c.stats.IncMisses()
 		return CacheNode[K, V]{}, false
@@ -157,7 +296,10 @@ func (c *Cache[K, V]) Get(key K) (CacheNode[K, V], bool) {
 
 	// Update LRU order for the node and all its ancestors.
 	for n := node; n != nil; n = n.parent {
-		c.lruList.MoveToFront(n.lruElem)
+		c.promote(n)
+	}
+	if c.isStale(node, now) {
+		staleNode = node
 	}
 
 	c.stats.IncHits()
@@ -165,6 +307,7 @@ func (c *Cache[K, V]) Get(key K) (CacheNode[K, V], bool) {
 }
 
 // Len returns the number of items currently stored in the cache.
+// Expired nodes that have not been reaped yet are included, while tombstones added by AddNegative are not.
 func (c *Cache[K, V]) Len() int {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -172,23 +315,43 @@ func (c *Cache[K, V]) Len() int {
 	return len(c.keysMap)
 }
 
+// Cost returns the total cost of items currently stored in the cache.
+// If no cost function is set, every item costs 1.
+func (c *Cache[K, V]) Cost() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.totalCost
+}
+
 // AddRoot initializes the cache with a root node.
 //
 // The root node serves as the ancestor for all other nodes in the cache.
 // Only one root node is allowed per cache instance.
 // Attempting to add a second root will result in an error.
+//
+// If WithMultipleRoots is used, every call adds a new root of a separate tree,
+// and ErrAlreadyExists is returned if a node with the given key already exists.
+// Adding a root may evict leaves of other trees if the cache is full.
 func (c *Cache[K, V]) AddRoot(key K, val V) error {
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.root != nil {
+	if !c.multipleRoots && len(c.roots) != 0 {
 		return ErrRootAlreadyExists
 	}
-	c.root = newTreeNode(key, val, nil)
-	c.root.lruElem = c.lruList.PushFront(c.root)
-	c.keysMap[key] = c.root
+	if _, exists := c.keysMap[key]; exists {
+		return ErrAlreadyExists
+	}
+	c.insertNode(key, val, nil)
 
-	c.stats.SetAmount(len(c.keysMap))
+	c.evictIfNeeded(&evictedNodes, nil)
+
+	c.reportInserts(1)
+	c.reportAmount()
 	return nil
 }
 
@@ -197,45 +360,71 @@ func (c *Cache[K, V]) AddRoot(key K, val V) error {
 // This method creates a parent-child relationship between the new node and
 // the existing parent node. It also updates the LRU order of the parent chain
 // to protect ancestors from eviction. If adding the new node exceeds the cache
-// capacity, the least recently used node will be evicted.
+// capacity (number of entries or total cost), the least recently used nodes will be evicted until it fits.
+// The node expires after the default TTL set by WithTTL, if any.
 //
 // If parentKey is not found in the cache, ErrParentNotExist is returned.
 // If the node with the given key already exists, ErrAlreadyExists is returned.
+// If the capacity is exhausted by pinned nodes (see WithPinnedOverflow) or the cost of the node alone
+// exceeds the maximum cost (see WithMaxCost), ErrCapacityExhausted is returned.
 func (c *Cache[K, V]) Add(key K, val V, parentKey K) error {
-	var evictedNode CacheNode[K, V]
-	var evicted bool
-	defer func() {
-		if evicted && c.onEvict != nil {
-			c.onEvict(evictedNode)
-		}
-	}()
+	return c.add(key, val, parentKey, c.defaultTTL, false)
+}
+
+// AddWithTTL works like Add, but the node expires after the given TTL.
+// A non-positive TTL means the node never expires.
+//
+// Depending on the ExpirationMode, the TTL of the node or its ancestors may be adjusted
+// to guarantee that ancestors never expire before their descendants.
+func (c *Cache[K, V]) AddWithTTL(key K, val V, parentKey K, ttl time.Duration) error {
+	return c.add(key, val, parentKey, ttl, false)
+}
+
+func (c *Cache[K, V]) add(key K, val V, parentKey K, ttl time.Duration, pinned bool) error {
+	defer c.observe(OpAdd)()
+
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	now := c.now()
+
 	parent, parentExists := c.keysMap[parentKey]
+	if parentExists && c.reapIfExpired(parent, now, &evictedNodes) {
+		parentExists = false
+	}
 	if !parentExists {
 		return ErrParentNotExist
 	}
 
-	if _, exists := c.keysMap[key]; exists {
+	if existingNode, exists := c.keysMap[key]; exists && !c.reapIfExpired(existingNode, now, &evictedNodes) {
+		return ErrAlreadyExists
+	}
+	if err := c.checkCost(key, val); err != nil {
+		return err
+	}
+	if !c.claimKeys(key) {
 		return ErrAlreadyExists
 	}
 
-	node := newTreeNode(key, val, parent)
-	c.keysMap[key] = node
-	node.lruElem = c.lruList.PushFront(node)
-	parent.children[key] = node
+	node := c.insertNode(key, val, parent)
+	c.setExpiration(node, expirationTime(now, ttl))
+	c.setPinned(node, pinned)
 
 	for n := node.parent; n != nil; n = n.parent {
-		c.lruList.MoveToFront(n.lruElem)
+		c.promote(n)
 	}
 
-	if c.maxEntries > 0 && c.lruList.Len() > c.maxEntries {
-		evictedNode, evicted = c.evict()
+	if err := c.evictToFit(node, &evictedNodes); err != nil {
+		c.removeSubtree(node, nil)
+		c.reportAmount()
+		return err
 	}
 
-	c.stats.SetAmount(len(c.keysMap))
+	c.reportInserts(1)
+	c.reportAmount()
 
 	return nil
 }
@@ -246,57 +435,83 @@ func (c *Cache[K, V]) Add(key K, val V, parentKey K) error {
 // update scenarios. If the node already exists, it can be reparented to a new parent
 // and its value can be updated. This method includes cycle detection to prevent
 // creating loops in the tree structure (ErrCycleDetected is returned in such cases).
+// The old value of an updated node is reported via the WithOnRemove callback with RemovalReplaced reason.
 // If parentKey is not found in the cache, ErrParentNotExist is returned.
+// If a new node can't be added because the capacity is exhausted by pinned nodes, ErrCapacityExhausted is returned.
+// It's also returned if the cost of the value alone exceeds the maximum cost (see WithMaxCost),
+// in which case an existing node is left intact.
+// The expiration time of the node is reset according to the default TTL set by WithTTL, if any.
 func (c *Cache[K, V]) AddOrUpdate(key K, val V, parentKey K) error {
-	var evictedNode CacheNode[K, V]
-	var evicted bool
-	defer func() {
-		if evicted && c.onEvict != nil {
-			c.onEvict(evictedNode)
-		}
-	}()
+	return c.addOrUpdate(key, val, parentKey, c.defaultTTL)
+}
+
+// AddOrUpdateWithTTL works like AddOrUpdate, but the node expires after the given TTL.
+// A non-positive TTL means the node never expires.
+func (c *Cache[K, V]) AddOrUpdateWithTTL(key K, val V, parentKey K, ttl time.Duration) error {
+	return c.addOrUpdate(key, val, parentKey, ttl)
+}
+
+func (c *Cache[K, V]) addOrUpdate(key K, val V, parentKey K, ttl time.Duration) error {
+	defer c.observe(OpAddOrUpdate)()
+
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	now := c.now()
+
 	parent, parentExists := c.keysMap[parentKey]
+	if parentExists && c.reapIfExpired(parent, now, &evictedNodes) {
+		parentExists = false
+	}
 	if !parentExists {
 		return ErrParentNotExist
 	}
 
+	if err := c.checkCost(key, val); err != nil {
+		return err
+	}
+
 	node, exists := c.keysMap[key]
+	if exists && c.reapIfExpired(node, now, &evictedNodes) {
+		exists = false
+	}
+	isNew := !exists
 	if exists {
-		if node.parent != parent {
-			// We need to check for cycles before moving the node to the new parent.
-			for par := parent; par != nil; par = par.parent {
-				if par == node {
-					return ErrCycleDetected
-				}
-			}
-			// Before updating the parent, remove the node from the current parent's children.
-			node.removeFromParent()
-			node.parent = parent
-			parent.children[key] = node
+		if _, err := c.updateNode(node, parent, val, expirationTime(now, ttl), &evictedNodes); err != nil {
+			return err
 		}
-		node.val = val
-		c.lruList.MoveToFront(node.lruElem)
+		c.promote(node)
 	} else {
 		// Add the new node to the cache.
-		node = newTreeNode(key, val, parent)
-		c.keysMap[key] = node
-		node.lruElem = c.lruList.PushFront(node)
-		parent.children[key] = node
+		if !c.claimKeys(key) {
+			return ErrAlreadyExists
+		}
+		node = c.insertNode(key, val, parent)
+		c.setExpiration(node, expirationTime(now, ttl))
 	}
 
 	for n := node.parent; n != nil; n = n.parent {
-		c.lruList.MoveToFront(n.lruElem)
+		c.promote(n)
 	}
 
-	if c.maxEntries > 0 && c.lruList.Len() > c.maxEntries {
-		evictedNode, evicted = c.evict()
+	// Updating the value may increase its cost, so several nodes may be evicted.
+	if err := c.evictToFit(node, &evictedNodes); err != nil {
+		if isNew {
+			c.removeSubtree(node, nil)
+			c.reportAmount()
+			return err
+		}
+		// The existing node is kept updated, even if it has to be evicted to fit the capacity.
+		c.evictIfNeeded(&evictedNodes, nil)
+	}
+	if isNew {
+		c.reportInserts(1)
 	}
 
-	c.stats.SetAmount(len(c.keysMap))
+	c.reportAmount()
 
 	return nil
 }
@@ -308,13 +523,20 @@ func (c *Cache[K, V]) AddOrUpdate(key K, val V, parentKey K) error {
 // If the key does not exist, an empty slice is returned.
 // Unlike GetBranch(), this method doesn't mark the nodes as recently used.
 func (c *Cache[K, V]) PeekBranch(key K) []CacheNode[K, V] {
+	defer c.observe(OpPeekBranch)()
+
+	_, branch := c.peekBranch(key)
+	return branch
+}
+
+func (c *Cache[K, V]) peekBranch(key K) (*treeNode[K, V], []CacheNode[K, V]) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	node, exists := c.keysMap[key]
-	if !exists {
+	if !exists || node.isExpired(c.now()) {
 		c.stats.IncMisses()
-		return nil
+		return nil, nil
 	}
 
 	depth := 0
@@ -330,7 +552,7 @@ func (c *Cache[K, V]) PeekBranch(key K) []CacheNode[K, V] {
 
 	c.stats.IncHits()
 
-	return branch
+	return node, branch
 }
 
 // GetBranch returns the path from the root to the specified key as a slice of BranchNodes.
@@ -339,10 +561,22 @@ func (c *Cache[K, V]) PeekBranch(key K) []CacheNode[K, V] {
 // If the key does not exist, an empty slice is returned.
 // Method updates LRU order for all nodes in the branch.
 func (c *Cache[K, V]) GetBranch(key K) []CacheNode[K, V] {
+	defer c.observe(OpGetBranch)()
+
+	if c.accessBuf != nil {
+		return c.getBranchBuffered(key)
+	}
+
+	var reapedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(reapedNodes) }()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	node, exists := c.keysMap[key]
+	if exists && c.reapIfExpired(node, c.now(), &reapedNodes) {
+		exists = false
+	}
 	if !exists {
 		c.stats.IncMisses()
 		return nil
@@ -357,7 +591,7 @@ func (c *Cache[K, V]) GetBranch(key K) []CacheNode[K, V] {
 	for n := node; n != nil; n = n.parent {
 		i--
 		branch[i] = CacheNode[K, V]{Key: n.key, Value: n.val, ParentKey: n.parentKey()}
-		c.lruList.MoveToFront(n.lruElem)
+		c.promote(n)
 	}
 
 	c.stats.IncHits()
@@ -372,13 +606,27 @@ func (c *Cache[K, V]) GetBranch(key K) []CacheNode[K, V] {
 // proceeding upward to the root. Each node visited is marked as recently used.
 // The provided callback function receives the node's key, value, and its parent's key.
 //
-// Note: This operation is performed under a lock and will block other cache operations.
+// Note: This operation is performed under a lock and will block other cache operations
+// (under the read lock if WithBufferedPromotion is used).
 // The callback should execute quickly to avoid holding the lock for too long.
 func (c *Cache[K, V]) TraverseToRoot(key K, f func(key K, val V, parentKey K)) {
+	defer c.observe(OpTraverseToRoot)()
+
+	if c.accessBuf != nil {
+		c.traverseToRootBuffered(key, f)
+		return
+	}
+
+	var reapedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(reapedNodes) }()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	node, exists := c.keysMap[key]
+	if exists && c.reapIfExpired(node, c.now(), &reapedNodes) {
+		exists = false
+	}
 	if !exists {
 		c.stats.IncMisses()
 		return
@@ -387,7 +635,7 @@ func (c *Cache[K, V]) TraverseToRoot(key K, f func(key K, val V, parentKey K)) {
 	defer func() {
 		// We need to update LRU in defer to ensure that the order is correct even if f panics.
 		for n := node; n != nil; n = n.parent {
-			c.lruList.MoveToFront(n.lruElem)
+			c.promote(n)
 		}
 	}()
 
@@ -402,6 +650,31 @@ func (c *Cache[K, V]) TraverseToRoot(key K, f func(key K, val V, parentKey K)) {
 	c.stats.IncHits()
 }
 
+// PeekToRoot walks the path from the specified node up to the root node,
+// calling the provided function for each node along the way, without updating the LRU order.
+//
+// Unlike TraverseToRoot(), this method doesn't mark the nodes as recently used
+// and is performed under the read lock, so it doesn't block other readers.
+// The callback should execute quickly to avoid holding the lock for too long.
+func (c *Cache[K, V]) PeekToRoot(key K, f func(key K, val V, parentKey K)) {
+	defer c.observe(OpPeekToRoot)()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	node, exists := c.keysMap[key]
+	if !exists || node.isExpired(c.now()) {
+		c.stats.IncMisses()
+		return
+	}
+
+	for n := node; n != nil; n = n.parent {
+		f(n.key, n.val, n.parentKey())
+	}
+
+	c.stats.IncHits()
+}
+
 // TraverseSubtreeOption represents options for the TraverseSubtree method.
 type TraverseSubtreeOption func(*traverseOptions)
 
@@ -417,26 +690,48 @@ func WithMaxDepth(depth int) TraverseSubtreeOption {
 
 type traverseOptions struct {
 	maxDepth int // -1 means unlimited
+	order    TraversalOrder
+	childCmp any // func(a, b K) int set by Cache.WithChildOrder, nil means unspecified order
 }
 
 // TraverseSubtree performs a depth-first traversal of all nodes in the subtree
 // rooted at the specified node, with optional depth limitation.
 //
 // This method visits the specified node and all its descendants in a pre-order depth-first traversal.
-// Each node visited is marked as recently used.
+// Each node visited is marked as recently used. Expired descendants are skipped along with their subtrees.
 // The provided callback function receives the node's key, value, and its parent's key.
+// Use WalkSubtree to stop the traversal early or to skip descending into some nodes.
 //
 // Options:
 //   - WithMaxDepth(n): Limits traversal to n levels deep.
+//   - WithTraversalOrder(order): Changes the order of traversal (pre-order by default).
+//   - cache.WithChildOrder(cmp): Visits children of every node in the order defined by cmp.
 //
 // Note: This operation is performed under a lock and will block other cache operations.
 // For large subtrees, this can have performance implications.
 func (c *Cache[K, V]) TraverseSubtree(key K, f func(key K, val V, parentKey K), options ...TraverseSubtreeOption) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.observe(OpTraverseSubtree)()
+
+	c.traverseSubtree(key, func(key K, val V, parentKey K) TraverseAction {
+		f(key, val, parentKey)
+		return TraverseContinue
+	}, options)
+}
+
+// PeekSubtree performs a traversal of all nodes in the subtree rooted at the specified node
+// without updating the LRU order. It supports the same options as TraverseSubtree.
+//
+// Unlike TraverseSubtree(), this method doesn't mark the nodes as recently used
+// and is performed under the read lock, so it doesn't block other readers (e.g. periodic audits of the whole tree).
+func (c *Cache[K, V]) PeekSubtree(key K, f func(key K, val V, parentKey K), options ...TraverseSubtreeOption) {
+	defer c.observe(OpPeekSubtree)()
 
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now()
 	node, exists := c.keysMap[key]
-	if !exists {
+	if !exists || node.isExpired(now) {
 		c.stats.IncMisses()
 		return
 	}
@@ -448,32 +743,10 @@ func (c *Cache[K, V]) TraverseSubtree(key K, f func(key K, val V, parentKey K),
 		opt(&opts)
 	}
 
-	defer func() {
-		// We need to update LRU in defer to ensure that the order is correct even if f panics.
-		for n := node.parent; n != nil; n = n.parent {
-			c.lruList.MoveToFront(n.lruElem)
-		}
-	}()
-
-	var traverse func(n *treeNode[K, V], currentDepth int)
-	traverse = func(n *treeNode[K, V], currentDepth int) {
-		defer c.lruList.MoveToFront(n.lruElem)
-		var parentKey K
-		if n.parent != nil {
-			parentKey = n.parent.key
-		}
-		f(n.key, n.val, parentKey)
-
-		// Check if we need to continue traversing deeper
-		if opts.maxDepth >= 0 && currentDepth >= opts.maxDepth {
-			return
-		}
-
-		for _, child := range n.children {
-			traverse(child, currentDepth+1)
-		}
-	}
-	traverse(node, 0) // Start at depth 0 (root of subtree)
+	walkTree(node, now, opts, func(n *treeNode[K, V]) TraverseAction {
+		f(n.key, n.val, n.parentKey())
+		return TraverseContinue
+	}, func(*treeNode[K, V]) {})
 
 	c.stats.IncHits()
 }
@@ -482,48 +755,354 @@ func (c *Cache[K, V]) TraverseSubtree(key K, f func(key K, val V, parentKey K),
 //
 // This method performs a recursive removal of the specified node and its entire subtree.
 // It returns the total number of nodes removed from the cache.
-func (c *Cache[K, V]) Remove(key K) (removedCount int) {
+// Removed nodes are reported via the WithOnRemove callback with RemovalExplicit reason, descendants before their parents.
+func (c *Cache[K, V]) Remove(key K) int {
+	return c.remove(key, false)
+}
+
+func (c *Cache[K, V]) remove(key K, rootOnly bool) (removedCount int) {
+	defer c.observe(OpRemove)()
+
+	var removedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(removedNodes) }()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	node, exists := c.keysMap[key]
-	if !exists {
+	if !exists && !rootOnly {
+		if negNode, isNegative := c.negatives[key]; isNegative {
+			c.deleteNegative(negNode)
+		}
+	}
+	if !exists || (rootOnly && node.parent != nil) {
 		return 0
 	}
 
+	var onRemove func(n *treeNode[K, V])
+	if c.onRemove != nil {
+		onRemove = func(n *treeNode[K, V]) {
+			if n.parent != nil || !c.rootReplica {
+				removedNodes = append(removedNodes, removedNode[K, V]{n.toCacheNode(), RemovalExplicit})
+			}
+		}
+	}
+	removedCount = c.removeSubtree(node, onRemove)
+
+	if c.extStats != nil {
+		c.extStats.AddRemovals(removedCount)
+	}
+	c.reportAmount()
+
+	return removedCount
+}
+
+// removeSubtree deletes the node and all its descendants from the cache.
+// Descendants are removed before their parents, and onRemove (if not nil) is called for each removed node
+// while it is still attached to its parent.
+func (c *Cache[K, V]) removeSubtree(node *treeNode[K, V], onRemove func(n *treeNode[K, V])) int {
+	removedCount := 0
 	var removeRecursively func(n *treeNode[K, V])
 	removeRecursively = func(n *treeNode[K, V]) {
-		delete(c.keysMap, n.key)
-		n.parent = nil
-		removedCount++
-		c.lruList.Remove(n.lruElem)
 		for _, child := range n.children {
 			removeRecursively(child)
 		}
+		if onRemove != nil {
+			onRemove(n)
+		}
+		c.deleteNode(n)
 		n.children = nil
+		if n != node {
+			n.parent = nil
+		}
+		removedCount++
 	}
 	removeRecursively(node)
 
 	node.removeFromParent()
 
-	c.stats.SetAmount(len(c.keysMap))
-
 	return removedCount
 }
 
-func (c *Cache[K, V]) evict() (CacheNode[K, V], bool) {
-	tailElem := c.lruList.Back()
-	if tailElem == nil {
-		return CacheNode[K, V]{}, false
+// insertNode creates a new node, registers it in the cache and puts it at the front of the LRU list.
+// A node without a parent becomes a root.
+func (c *Cache[K, V]) insertNode(key K, val V, parent *treeNode[K, V]) *treeNode[K, V] {
+	if negNode, exists := c.negatives[key]; exists {
+		c.deleteNegative(negNode)
 	}
+	node := newTreeNode(key, val, parent)
+	node.updatedAt = c.now()
+	c.keysMap[key] = node
+	node.lruElem = c.lruList.PushFront(node)
+	if parent != nil {
+		parent.children[key] = node
+		parent.addDescendants(1)
+	} else {
+		c.roots[key] = node
+	}
+	if c.policy != nil {
+		c.policy.OnInsert(key)
+	}
+	node.cost = c.calcCost(key, val)
+	c.totalCost += node.cost
+	if c.onInsert != nil {
+		c.onInsert(key)
+	}
+	return node
+}
 
-	c.lruList.Remove(tailElem)
-	node := tailElem.Value.(*treeNode[K, V])
-	parentKey := node.parentKey()
+// claimKeys reserves keys for new nodes that are going to be inserted, so they can't be inserted into
+// another shard of ShardedCache concurrently. If any key can't be reserved, the keys reserved by the call
+// are released and false is returned. It must be called under the lock.
+func (c *Cache[K, V]) claimKeys(keys ...K) bool {
+	if c.claimKey == nil {
+		return true
+	}
+	for i, key := range keys {
+		if !c.claimKey(key) {
+			for _, claimedKey := range keys[:i] {
+				if _, exists := c.keysMap[claimedKey]; !exists && c.onDelete != nil {
+					c.onDelete(claimedKey)
+				}
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// deleteNode unregisters the node (with tombstones of its absent children) from the cache.
+// It doesn't touch parent-child links.
+func (c *Cache[K, V]) deleteNode(node *treeNode[K, V]) {
+	for _, negNode := range node.absentChildren {
+		c.deleteNegative(negNode)
+	}
 	delete(c.keysMap, node.key)
+	if node.parent == nil {
+		delete(c.roots, node.key)
+	}
+	c.lruList.Remove(node.lruElem)
+	c.totalCost -= node.cost
+	c.setPinned(node, false)
+	if node.quota != 0 {
+		delete(c.quotaNodes, node)
+	}
+	if c.policy != nil {
+		c.policy.OnRemove(node.key)
+	}
+	if c.onDelete != nil {
+		c.onDelete(node.key)
+	}
+}
+
+// promote marks the node as recently used.
+func (c *Cache[K, V]) promote(node *treeNode[K, V]) {
+	c.lruList.MoveToFront(node.lruElem)
+	if c.policy != nil {
+		c.policy.OnAccess(node.key)
+	}
+}
+
+// setValue updates the value of the node and recalculates its cost.
+func (c *Cache[K, V]) setValue(node *treeNode[K, V], val V) {
+	node.val = val
+	node.updatedAt = c.now()
+	c.updateCost(node)
+	c.invalidateMemo(node)
+}
+
+// updateCost recalculates the cost of the node.
+func (c *Cache[K, V]) updateCost(node *treeNode[K, V]) {
+	newCost := c.calcCost(node.key, node.val)
+	c.totalCost += newCost - node.cost
+	node.cost = newCost
+}
+
+func (c *Cache[K, V]) calcCost(key K, val V) int64 {
+	if c.costFunc == nil {
+		return 1
+	}
+	return c.costFunc(key, val)
+}
+
+// checkCost returns ErrCapacityExhausted if the cost of the entry alone exceeds the maximum cost,
+// so it can't fit the cache even if all other nodes are evicted.
+func (c *Cache[K, V]) checkCost(key K, val V) error {
+	if c.maxCost <= 0 {
+		return nil
+	}
+	if cost := c.calcCost(key, val); cost > c.maxCost {
+		return fmt.Errorf("%w: cost %d exceeds the maximum cost %d", ErrCapacityExhausted, cost, c.maxCost)
+	}
+	return nil
+}
+
+func (c *Cache[K, V]) overCapacity() bool {
+	return (c.maxEntries > 0 && c.lruList.Len() > c.maxEntries) || (c.maxCost > 0 && c.totalCost > c.maxCost)
+}
+
+// updateNode sets the new value and expiration time of the existing node and moves it under the parent
+// if it has another one. The replaced value is appended to removed (see trackReplaced).
+// It returns ErrCycleDetected (leaving the node intact) if the parent is the node itself or its descendant.
+func (c *Cache[K, V]) updateNode(
+	node, parent *treeNode[K, V], val V, expiresAt time.Time, removed *[]removedNode[K, V],
+) (reparented bool, err error) {
+	oldNode := node.toCacheNode()
+	reparented = node.parent != parent
+	if reparented {
+		// We need to check for cycles before moving the node to the new parent.
+		if err = c.checkCycle(node, parent); err != nil {
+			return false, err
+		}
+		c.setParent(node, parent)
+	}
+	c.trackReplaced(oldNode, removed)
+	c.setValue(node, val)
+	c.setExpiration(node, expiresAt)
+	c.reportUpdate(reparented)
+	return reparented, nil
+}
+
+// checkCycle returns ErrCycleDetected if the node can't be moved under the parent,
+// because the parent is the node itself or its descendant.
+func (c *Cache[K, V]) checkCycle(node, parent *treeNode[K, V]) error {
+	if parent == node || isDescendant(parent, node) {
+		c.reportCycleRejection()
+		return ErrCycleDetected
+	}
+	return nil
+}
+
+// setParent moves the node (with its subtree) to the new parent.
+func (c *Cache[K, V]) setParent(node, parent *treeNode[K, V]) {
+	if node.parent == nil {
+		delete(c.roots, node.key) // The root of a tree is moved under another tree.
+	}
+	// Before updating the parent, remove the node from the current parent's children.
+	node.removeFromParent()
+	node.parent = parent
+	parent.children[node.key] = node
+	parent.addDescendants(node.descendants + 1)
+	c.invalidateMemo(node)
+}
+
+// evictIfNeeded evicts the least recently used nodes until the cache fits its capacity and subtree quotas.
+// Nodes from the protected set are never evicted, so the cache may stay over capacity.
+// Evicted nodes are appended to evicted (if not nil).
+func (c *Cache[K, V]) evictIfNeeded(evicted *[]removedNode[K, V], protected map[*treeNode[K, V]]struct{}) {
+	overQuota := c.overQuota()
+	if len(overQuota) != 0 || c.overCapacity() {
+		// Apply all recorded accesses so that eviction takes them into account.
+		c.drainAccessBuffer()
+	}
+	evictedCount := 0
+	evictVictim := func(victim *treeNode[K, V]) {
+		if victim.absent {
+			c.deleteNegative(victim) // Tombstones are not reported.
+			return
+		}
+		evictedNode := c.evictNode(victim)
+		evictedCount++
+		if evicted != nil {
+			*evicted = append(*evicted, removedNode[K, V]{evictedNode, RemovalCapacity})
+		}
+	}
+	// Quotas are enforced by evicting nodes only within the subtrees that exceed them.
+	for _, quotaNode := range overQuota {
+		for quotaNode.descendants+1 > quotaNode.quota {
+			victim, ok := c.evict(protected, quotaNode, false) // Tombstones don't count against quotas.
+			if !ok {
+				break
+			}
+			evictVictim(victim)
+		}
+	}
+	for c.overCapacity() {
+		// Tombstones have no cost, so evicting them helps only when the number of entries is exceeded.
+		tombstones := c.maxEntries > 0 && c.lruList.Len() > c.maxEntries
+		victim, ok := c.evict(protected, nil, tombstones)
+		if !ok {
+			break
+		}
+		evictVictim(victim)
+	}
+	if evictedCount != 0 {
+		c.stats.AddEvictions(evictedCount)
+	}
+}
+
+// evict selects the least recently used leaf node or tombstone (or the one selected by the eviction policy)
+// that is not protected. The root node is never selected.
+// If scope is not nil, only nodes of its subtree are selected, and tombstones are selected only if allowed
+// (see isEvictable).
+func (c *Cache[K, V]) evict(
+	protected map[*treeNode[K, V]]struct{}, scope *treeNode[K, V], tombstones bool,
+) (*treeNode[K, V], bool) {
+	if c.policy != nil {
+		return c.evictByPolicy(protected, scope, tombstones)
+	}
+
+	// Parents always precede their descendants in the LRU list, so the tail is a leaf.
+	// Scanning further is needed only when the tail is protected or pinned, or it's out of scope.
+	for elem := c.lruList.Back(); elem != nil; elem = elem.Prev() {
+		node := elem.Value.(*treeNode[K, V])
+		if !c.isEvictable(node, protected, scope, tombstones) {
+			continue
+		}
+
+		return node, true
+	}
+	return nil, false
+}
+
+func (c *Cache[K, V]) evictByPolicy(
+	protected map[*treeNode[K, V]]struct{}, scope *treeNode[K, V], tombstones bool,
+) (*treeNode[K, V], bool) {
+	lookup := func(key K) (*treeNode[K, V], bool) {
+		if node, exists := c.keysMap[key]; exists {
+			return node, true
+		}
+		node, exists := c.negatives[key]
+		return node, exists
+	}
+	key, ok := c.policy.Victim(func(key K) bool {
+		node, exists := lookup(key)
+		return exists && c.isEvictable(node, protected, scope, tombstones)
+	})
+	if !ok {
+		return nil, false
+	}
+	node, _ := lookup(key)
+	return node, true
+}
+
+// isEvictable reports whether the node is a leaf (or a tombstone) that is not a root, not pinned and not protected.
+// Tombstones are evictable only if tombstones is true, and if scope is not nil, the node must be a descendant of scope.
+func (c *Cache[K, V]) isEvictable(
+	node *treeNode[K, V], protected map[*treeNode[K, V]]struct{}, scope *treeNode[K, V], tombstones bool,
+) bool {
+	if node.parent == nil || node.pinned || len(node.children) != 0 || (node.absent && !tombstones) {
+		return false
+	}
+	if _, isProtected := protected[node]; isProtected {
+		return false
+	}
+	return scope == nil || isDescendant(node, scope)
+}
+
+// evictNode removes the leaf node from the cache.
+func (c *Cache[K, V]) evictNode(node *treeNode[K, V]) CacheNode[K, V] {
+	parentKey := node.parentKey()
+	c.deleteNode(node)
 	node.removeFromParent()
+	return CacheNode[K, V]{Key: node.key, Value: node.val, ParentKey: parentKey}
+}
 
-	return CacheNode[K, V]{Key: node.key, Value: node.val, ParentKey: parentKey}, true
+func (c *Cache[K, V]) reportAmount() {
+	c.stats.SetAmount(len(c.keysMap))
+	if c.costStats != nil {
+		c.costStats.SetCost(c.totalCost)
+	}
 }
 
 // nullStats is a null object implementation of the StatsCollector interface.
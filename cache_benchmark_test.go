@@ -134,6 +134,38 @@ func BenchmarkCache_Get_Concurrent(b *testing.B) {
 	}
 }
 
+func BenchmarkCache_Get_Concurrent_BufferedPromotion(b *testing.B) {
+	const chainsNum = 10_000
+	depths := []int{5, 10, 50} // root is the 1st level
+	goroutineCounts := []int{32, 64, 128}
+	for _, depth := range depths {
+		cache, leaves := generateTreeForBench(b, depth, chainsNum, 0, WithBufferedPromotion[string, int](0))
+		for _, numGoroutines := range goroutineCounts {
+			b.Run(fmt.Sprintf("depth=%d/goroutines=%d", depth, numGoroutines), func(b *testing.B) {
+				opsPerGoroutine := b.N / numGoroutines
+				var wg sync.WaitGroup
+				wg.Add(numGoroutines)
+				b.ResetTimer()
+				for g := 0; g < numGoroutines; g++ {
+					go func(goroutineID int) {
+						defer wg.Done()
+						for i := 0; i < opsPerGoroutine; i++ {
+							nodeIdx := (goroutineID*opsPerGoroutine + i) % len(leaves)
+							key := leaves[nodeIdx]
+							if _, found := cache.Get(key); !found {
+								// Using panic instead of b.Fatalf because b.Fatalf isn't goroutine-safe
+								panic(fmt.Sprintf("key %s not found in cache", key))
+							}
+						}
+					}(g)
+				}
+				wg.Wait()
+			})
+		}
+		cache.Close()
+	}
+}
+
 func BenchmarkCache_Peek_Concurrent(b *testing.B) {
 	const chainsNum = 10_000
 	depths := []int{5, 10, 50} // root is the 1st level
@@ -193,17 +225,20 @@ func BenchmarkCache_Peek_Concurrent(b *testing.B) {
 //   - maxDepth: The maximum depth of the tree (including root)
 //   - chainsNum: The number of parallel chains to create
 //   - maxEntries: The maximum capacity of the cache. If 0, defaults to (maxDepth*chainsNum + 1)
+//   - options: Options for the cache
 //
 // Returns:
 //   - The initialized cache
 //   - A slice containing the leaf node keys (nodes at maxDepth-1)
-func generateTreeForBench(b *testing.B, maxDepth int, chainsNum int, maxEntries int) (*Cache[string, int], []string) {
+func generateTreeForBench(
+	b *testing.B, maxDepth int, chainsNum int, maxEntries int, options ...CacheOption[string, int],
+) (*Cache[string, int], []string) {
 	b.Helper()
 
 	if maxEntries == 0 {
 		maxEntries = maxDepth*chainsNum + 1
 	}
-	cache := NewCache[string, int](maxEntries)
+	cache := NewCache[string, int](maxEntries, options...)
 	rootKey := "root"
 	if err := cache.AddRoot(rootKey, 0); err != nil {
 		b.Fatal(err)
@@ -3,9 +3,11 @@ package lrutree
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestCache_AddRoot(t *testing.T) {
@@ -718,6 +720,79 @@ func TestCache_TraverseSubtree_WithMaxDepth(t *testing.T) {
 	})
 }
 
+func TestCache_PeekToRoot(t *testing.T) {
+	stats := &Stats{}
+	cache := NewCache[string, int](10, WithStatsCollector[string, int](stats))
+	assertNoError(t, cache.AddRoot("root", 1))
+	assertNoError(t, cache.Add("child1", 2, "root"))
+	assertNoError(t, cache.Add("grandchild1", 3, "child1"))
+	assertNoError(t, cache.Add("child2", 4, "root"))
+	lruOrder := getLRUOrder(cache)
+
+	var traversed []CacheNode[string, int]
+	cache.PeekToRoot("grandchild1", func(key string, val int, parentKey string) {
+		traversed = append(traversed, CacheNode[string, int]{Key: key, Value: val, ParentKey: parentKey})
+	})
+	assertEqual(t, []CacheNode[string, int]{
+		{Key: "grandchild1", Value: 3, ParentKey: "child1"},
+		{Key: "child1", Value: 2, ParentKey: "root"},
+		{Key: "root", Value: 1, ParentKey: ""},
+	}, traversed)
+	assertEqual(t, lruOrder, getLRUOrder(cache))
+
+	traversed = nil
+	cache.PeekToRoot("nonexistent", func(key string, val int, parentKey string) {
+		traversed = append(traversed, CacheNode[string, int]{Key: key, Value: val, ParentKey: parentKey})
+	})
+	assertEqual(t, 0, len(traversed))
+
+	snapshot := stats.Snapshot()
+	assertEqual(t, uint64(1), snapshot.Hits)
+	assertEqual(t, uint64(1), snapshot.Misses)
+	assertEqual(t, uint64(2), snapshot.Latencies[OpPeekToRoot].Count)
+}
+
+func TestCache_PeekSubtree(t *testing.T) {
+	now := time.Now()
+	stats := &Stats{}
+	cache := NewCache[string, int](10, WithStatsCollector[string, int](stats))
+	cache.now = func() time.Time { return now }
+	assertNoError(t, cache.AddRoot("root", 1))
+	assertNoError(t, cache.Add("child1", 2, "root"))
+	assertNoError(t, cache.Add("grandchild1", 3, "child1"))
+	assertNoError(t, cache.Add("child2", 4, "root"))
+	assertNoError(t, cache.AddWithTTL("child3", 5, "root", time.Minute))
+	assertNoError(t, cache.Add("grandchild3", 6, "child3"))
+	now = now.Add(time.Minute)
+	lruOrder := getLRUOrder(cache)
+
+	var traversed []string
+	cache.PeekSubtree("root", func(key string, val int, parentKey string) {
+		traversed = append(traversed, key)
+	}, cache.WithChildOrder(strings.Compare))
+	// Expired nodes are skipped, but not removed.
+	assertEqual(t, []string{"root", "child1", "grandchild1", "child2"}, traversed)
+	assertEqual(t, lruOrder, getLRUOrder(cache))
+	assertEqual(t, 6, cache.Len())
+
+	traversed = nil
+	cache.PeekSubtree("root", func(key string, val int, parentKey string) {
+		traversed = append(traversed, key)
+	}, cache.WithChildOrder(strings.Compare), WithTraversalOrder(TraverseBreadthFirst), WithMaxDepth(1))
+	assertEqual(t, []string{"root", "child1", "child2"}, traversed)
+
+	traversed = nil
+	cache.PeekSubtree("child3", func(key string, val int, parentKey string) {
+		traversed = append(traversed, key)
+	})
+	assertEqual(t, 0, len(traversed))
+
+	snapshot := stats.Snapshot()
+	assertEqual(t, uint64(2), snapshot.Hits)
+	assertEqual(t, uint64(1), snapshot.Misses)
+	assertEqual(t, uint64(3), snapshot.Latencies[OpPeekSubtree].Count)
+}
+
 func TestConcurrency(t *testing.T) {
 	cache := NewCache[string, int](100_000)
 	assertNoError(t, cache.AddRoot("root", 1))
@@ -917,12 +992,22 @@ func TestCache_Stats(t *testing.T) {
 		assertNoError(t, cache.Add("child3", 4, "root"))
 		assertEqual(t, int32(3), stats.amount.Load()) // Still 3 items
 		assertEqual(t, "child1", lastEvicted.Key)     // child1 was evicted
+		assertEqual(t, int32(1), stats.evictions.Load())
 
 		// Update LRU order and add another node to cause another eviction
 		_, ok := cache.Get("child2")
 		assertTrue(t, ok)
 		assertNoError(t, cache.Add("child4", 5, "root"))
 		assertEqual(t, "child3", lastEvicted.Key) // child3 should be evicted now
+		assertEqual(t, int32(2), stats.evictions.Load())
+
+		// Updating a node may evict other nodes as well.
+		assertNoError(t, cache.AddOrUpdate("child5", 6, "child4"))
+		assertEqual(t, int32(3), stats.evictions.Load())
+
+		// Explicit removals are not evictions.
+		assertEqual(t, 2, cache.Remove("child4"))
+		assertEqual(t, int32(3), stats.evictions.Load())
 	})
 
 	t.Run("subtree operations", func(t *testing.T) {
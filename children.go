@@ -0,0 +1,169 @@
+package lrutree
+
+import (
+	"errors"
+)
+
+// ErrInvalidChildren is returned by AddChildren when the children contain duplicate keys.
+var ErrInvalidChildren = errors.New("invalid children")
+
+// MarkChildrenComplete records that the children of the node present in the cache are its complete child set
+// (e.g. all entries of a directory were loaded), so they can be listed by ChildrenIfComplete.
+//
+// The marker is cleared as soon as any child leaves the node: it's evicted, removed, expired or moved
+// to another parent. Adding new children keeps the marker.
+// It returns false if the node doesn't exist.
+func (c *Cache[K, V]) MarkChildrenComplete(key K) bool {
+	var reapedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(reapedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node, exists := c.keysMap[key]
+	if !exists || c.reapIfExpired(node, c.now(), &reapedNodes) {
+		return false
+	}
+	node.childrenComplete = true
+	return true
+}
+
+// AddChildren sets the complete child set of the parent node and marks it as complete (see MarkChildrenComplete).
+//
+// Missing children are added, existing ones are updated (and moved under the parent if they have another parent),
+// like in AddOrUpdate. ParentKey of the given nodes is ignored. Current children of the parent that are not
+// in the given set are removed with their subtrees (reported via WithOnRemove with RemovalExplicit reason).
+//
+// The parent, its ancestors and all the children are marked as recently used. Eviction happens only once
+// and never evicts the parent and the children, so the cache may hold more entries than its capacity
+// if the children alone exceed it.
+//
+// If the parent doesn't exist, ErrParentNotExist is returned.
+// If the children contain duplicate keys, ErrInvalidChildren is returned.
+// If one of the children is the parent itself or its ancestor, ErrCycleDetected is returned.
+func (c *Cache[K, V]) AddChildren(parentKey K, children []CacheNode[K, V]) error {
+	defer c.observe(OpAddChildren)()
+
+	childKeys := make(map[K]struct{}, len(children))
+	for _, child := range children {
+		if _, exists := childKeys[child.Key]; exists {
+			return ErrInvalidChildren
+		}
+		childKeys[child.Key] = struct{}{}
+	}
+
+	var removedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(removedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	lookup := func(key K) *treeNode[K, V] {
+		node, exists := c.keysMap[key]
+		if !exists || c.reapIfExpired(node, now, &removedNodes) {
+			return nil
+		}
+		return node
+	}
+
+	parent := lookup(parentKey)
+	if parent == nil {
+		return ErrParentNotExist
+	}
+	for n := parent; n != nil; n = n.parent {
+		if _, exists := childKeys[n.key]; exists {
+			c.reportCycleRejection()
+			return ErrCycleDetected
+		}
+	}
+
+	// Add and move the requested children first, so the ones that are currently in subtrees of stale children
+	// are moved with their own subtrees before the stale children are removed.
+	protected := make(map[*treeNode[K, V]]struct{}, len(children)+1)
+	protected[parent] = struct{}{}
+	insertedCount := 0
+	for _, child := range children {
+		node := lookup(child.Key)
+		if node == nil {
+			node = c.insertNode(child.Key, child.Value, parent)
+			insertedCount++
+		} else {
+			c.trackReplaced(node.toCacheNode(), &removedNodes)
+			reparented := node.parent != parent
+			if reparented {
+				c.setParent(node, parent)
+			}
+			c.setValue(node, child.Value)
+			c.reportUpdate(reparented)
+		}
+		c.setExpiration(node, expirationTime(now, c.defaultTTL))
+		c.promote(node)
+		protected[node] = struct{}{}
+	}
+
+	removedCount := 0
+	for key, child := range parent.children {
+		if _, exists := childKeys[key]; exists {
+			continue
+		}
+		removedCount += c.removeSubtree(child, func(n *treeNode[K, V]) {
+			removedNodes = append(removedNodes, removedNode[K, V]{n.toCacheNode(), RemovalExplicit})
+		})
+	}
+	if c.extStats != nil && removedCount != 0 {
+		c.extStats.AddRemovals(removedCount)
+	}
+
+	for n := parent; n != nil; n = n.parent {
+		c.promote(n)
+	}
+	parent.childrenComplete = true
+
+	c.evictIfNeeded(&removedNodes, protected)
+
+	c.reportInserts(insertedCount)
+	c.reportAmount()
+
+	return nil
+}
+
+// ChildrenIfComplete returns the children of the node if its child set is known to be complete
+// (see MarkChildrenComplete and AddChildren). The order of children is unspecified.
+// It returns false if the node doesn't exist, its child set is not marked as complete, or some children have expired.
+//
+// On success, the node, its ancestors and its children are marked as recently used, and a hit is reported.
+// Otherwise, a miss is reported.
+func (c *Cache[K, V]) ChildrenIfComplete(key K) ([]CacheNode[K, V], bool) {
+	var reapedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(reapedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	node, exists := c.keysMap[key]
+	if !exists || c.reapIfExpired(node, now, &reapedNodes) || !node.childrenComplete {
+		c.stats.IncMisses()
+		return nil, false
+	}
+	children := make([]CacheNode[K, V], 0, len(node.children))
+	for _, child := range node.children {
+		if child.isExpired(now) {
+			c.stats.IncMisses()
+			return nil, false
+		}
+		children = append(children, child.toCacheNode())
+	}
+
+	for _, child := range node.children {
+		c.promote(child)
+	}
+	for n := node; n != nil; n = n.parent {
+		c.promote(n)
+	}
+
+	c.stats.IncHits()
+	return children, true
+}
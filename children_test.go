@@ -0,0 +1,219 @@
+package lrutree
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+func sortedChildKeys(children []CacheNode[string, int]) []string {
+	keys := make([]string, 0, len(children))
+	for _, child := range children {
+		keys = append(keys, child.Key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestCache_ChildrenIfComplete(t *testing.T) {
+	newCache := func(options ...CacheOption[string, int]) *Cache[string, int] {
+		cache := NewCache[string, int](10, options...)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("dir", 1, "root"))
+		assertNoError(t, cache.Add("file1", 11, "dir"))
+		assertNoError(t, cache.Add("file2", 12, "dir"))
+		return cache
+	}
+
+	t.Run("marker", func(t *testing.T) {
+		stats := &Stats{}
+		cache := newCache(WithStatsCollector[string, int](stats))
+		_, ok := cache.ChildrenIfComplete("dir")
+		assertFalse(t, ok)
+
+		assertTrue(t, cache.MarkChildrenComplete("dir"))
+		assertFalse(t, cache.MarkChildrenComplete("nonexistent"))
+		children, ok := cache.ChildrenIfComplete("dir")
+		assertTrue(t, ok)
+		assertEqual(t, []string{"file1", "file2"}, sortedChildKeys(children))
+		for _, child := range children {
+			assertEqual(t, "dir", child.ParentKey)
+		}
+
+		// A leaf with a complete (empty) child set.
+		assertTrue(t, cache.MarkChildrenComplete("file1"))
+		children, ok = cache.ChildrenIfComplete("file1")
+		assertTrue(t, ok)
+		assertEqual(t, 0, len(children))
+
+		// Adding a new child keeps the marker.
+		assertNoError(t, cache.Add("file3", 13, "dir"))
+		children, ok = cache.ChildrenIfComplete("dir")
+		assertTrue(t, ok)
+		assertEqual(t, []string{"file1", "file2", "file3"}, sortedChildKeys(children))
+
+		snapshot := stats.Snapshot()
+		assertEqual(t, uint64(3), snapshot.Hits)
+		assertEqual(t, uint64(1), snapshot.Misses)
+	})
+
+	t.Run("marker is cleared when a child leaves", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			leave func(cache *Cache[string, int])
+		}{
+			{"remove", func(cache *Cache[string, int]) { cache.Remove("file1") }},
+			{"move", func(cache *Cache[string, int]) { assertNoError(t, cache.Move("file1", "root")) }},
+			{"reparent", func(cache *Cache[string, int]) { assertNoError(t, cache.AddOrUpdate("file1", 0, "root")) }},
+			{"evict", func(cache *Cache[string, int]) {
+				cache.Get("file2")
+				for i := 0; i < 7; i++ {
+					assertNoError(t, cache.Add(string(rune('a'+i)), i, "root"))
+				}
+			}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cache := newCache()
+				assertTrue(t, cache.MarkChildrenComplete("dir"))
+				tt.leave(cache)
+				_, ok := cache.ChildrenIfComplete("dir")
+				assertFalse(t, ok)
+			})
+		}
+	})
+
+	t.Run("expired child", func(t *testing.T) {
+		now := time.Now()
+		cache := newCache()
+		cache.now = func() time.Time { return now }
+		assertNoError(t, cache.AddWithTTL("file3", 13, "dir", time.Minute))
+		assertTrue(t, cache.MarkChildrenComplete("dir"))
+		now = now.Add(time.Minute)
+		_, ok := cache.ChildrenIfComplete("dir")
+		assertFalse(t, ok)
+	})
+
+	t.Run("listing protects children from eviction", func(t *testing.T) {
+		cache := newCache()
+		assertNoError(t, cache.Add("other", 2, "root"))
+		assertTrue(t, cache.MarkChildrenComplete("dir"))
+		_, ok := cache.ChildrenIfComplete("dir")
+		assertTrue(t, ok)
+		lruOrder := getLRUOrder(cache)
+		assertEqual(t, []string{"root", "dir"}, lruOrder[:2])
+		assertEqual(t, []string{"file1", "file2"}, slices.Sorted(slices.Values(lruOrder[2:4])))
+		assertEqual(t, "other", lruOrder[4])
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		cache := newCache()
+		assertTrue(t, cache.MarkChildrenComplete("dir"))
+		var buf bytes.Buffer
+		assertNoError(t, cache.WriteSnapshot(&buf, GobCodec{}))
+		restored, err := RestoreCache[string, int](&buf, GobCodec{}, 10)
+		assertNoError(t, err)
+		children, ok := restored.ChildrenIfComplete("dir")
+		assertTrue(t, ok)
+		assertEqual(t, []string{"file1", "file2"}, sortedChildKeys(children))
+		_, ok = restored.ChildrenIfComplete("root")
+		assertFalse(t, ok)
+	})
+}
+
+func TestCache_AddChildren(t *testing.T) {
+	t.Run("sets complete child set", func(t *testing.T) {
+		var removed []string
+		cache := NewCache[string, int](10, WithOnRemove(func(node CacheNode[string, int], reason RemovalReason) {
+			removed = append(removed, node.Key+":"+reason.String())
+		}))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("dir", 1, "root"))
+		assertNoError(t, cache.Add("stale", 10, "dir"))
+		assertNoError(t, cache.Add("stale-child", 100, "stale"))
+		assertNoError(t, cache.Add("file1", 11, "dir"))
+		assertNoError(t, cache.Add("other-dir", 2, "root"))
+		assertNoError(t, cache.Add("file2", 0, "other-dir"))
+
+		assertNoError(t, cache.AddChildren("dir", []CacheNode[string, int]{
+			{Key: "file1", Value: 111},
+			{Key: "file2", Value: 12},
+			{Key: "file3", Value: 13},
+		}))
+		children, ok := cache.ChildrenIfComplete("dir")
+		assertTrue(t, ok)
+		assertEqual(t, []string{"file1", "file2", "file3"}, sortedChildKeys(children))
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "root", Value: 0},
+			{Key: "dir", Value: 1, ParentKey: "root"},
+			{Key: "file2", Value: 12, ParentKey: "dir"},
+		}, cache.PeekBranch("file2"))
+		node, _ := cache.Peek("file1")
+		assertEqual(t, 111, node.Value)
+		_, ok = cache.Peek("stale-child")
+		assertFalse(t, ok)
+		assertEqual(t, []string{"file1:Replaced", "file2:Replaced", "stale-child:Removed", "stale:Removed"}, removed)
+		// The child set of the previous parent of "file2" is not complete anymore.
+		_, ok = cache.ChildrenIfComplete("other-dir")
+		assertFalse(t, ok)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("children are moved out of stale children", func(t *testing.T) {
+		var removed []string
+		cache := NewCache[string, int](10, WithOnRemove(func(node CacheNode[string, int], reason RemovalReason) {
+			removed = append(removed, node.Key+":"+reason.String())
+		}))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("p", 1, "root"))
+		assertNoError(t, cache.Add("old", 2, "p"))
+		assertNoError(t, cache.Add("g", 3, "old"))
+		assertNoError(t, cache.Add("gg", 4, "g"))
+
+		assertNoError(t, cache.AddChildren("p", []CacheNode[string, int]{{Key: "g", Value: 30}}))
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "root", Value: 0},
+			{Key: "p", Value: 1, ParentKey: "root"},
+			{Key: "g", Value: 30, ParentKey: "p"},
+			{Key: "gg", Value: 4, ParentKey: "g"},
+		}, cache.PeekBranch("gg"))
+		_, ok := cache.Peek("old")
+		assertFalse(t, ok)
+		assertEqual(t, []string{"g:Replaced", "old:Removed"}, removed)
+		assertEqual(t, 4, cache.Len())
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("children are not evicted", func(t *testing.T) {
+		cache := NewCache[string, int](4)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("dir", 1, "root"))
+		assertNoError(t, cache.Add("other", 2, "root"))
+		assertNoError(t, cache.AddChildren("dir", []CacheNode[string, int]{{Key: "a"}, {Key: "b"}}))
+		assertEqual(t, 4, cache.Len())
+		_, ok := cache.Peek("other")
+		assertFalse(t, ok)
+		_, ok = cache.ChildrenIfComplete("dir")
+		assertTrue(t, ok)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("dir", 1, "root"))
+
+		assertErrorIs(t, cache.AddChildren("nonexistent", nil), ErrParentNotExist)
+		assertErrorIs(t, cache.AddChildren("dir", []CacheNode[string, int]{{Key: "a"}, {Key: "a"}}), ErrInvalidChildren)
+		assertErrorIs(t, cache.AddChildren("dir", []CacheNode[string, int]{{Key: "root"}}), ErrCycleDetected)
+		assertErrorIs(t, cache.AddChildren("dir", []CacheNode[string, int]{{Key: "dir"}}), ErrCycleDetected)
+		assertEqual(t, 2, cache.Len())
+
+		// An empty child set is valid.
+		assertNoError(t, cache.AddChildren("dir", nil))
+		children, ok := cache.ChildrenIfComplete("dir")
+		assertTrue(t, ok)
+		assertEqual(t, 0, len(children))
+	})
+}
@@ -0,0 +1,151 @@
+package lrutree
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// mockCostStats implements StatsCollector and CostStatsCollector for testing.
+type mockCostStats struct {
+	mockStats
+	cost atomic.Int64
+}
+
+func (m *mockCostStats) SetCost(val int64) {
+	m.cost.Store(val)
+}
+
+func TestCache_WithMaxCost(t *testing.T) {
+	costFunc := func(key string, val []byte) int64 {
+		return int64(len(val))
+	}
+
+	t.Run("evicts until total cost fits", func(t *testing.T) {
+		var evicted []string
+		stats := &mockCostStats{}
+		cache := NewCache[string, []byte](0,
+			WithMaxCost[string, []byte](10),
+			WithCostFunc(costFunc),
+			WithStatsCollector[string, []byte](stats),
+			WithOnEvict(func(node CacheNode[string, []byte]) {
+				evicted = append(evicted, node.Key)
+			}),
+		)
+
+		assertNoError(t, cache.AddRoot("root", make([]byte, 1)))
+		assertNoError(t, cache.Add("child1", make([]byte, 2), "root"))
+		assertNoError(t, cache.Add("child2", make([]byte, 3), "root"))
+		assertNoError(t, cache.Add("child3", make([]byte, 4), "root"))
+		assertEqual(t, int64(10), cache.Cost())
+		assertEqual(t, int64(10), stats.cost.Load())
+		assertNil(t, evicted)
+
+		// Adding a heavy node evicts several least recently used leaves.
+		assertNoError(t, cache.Add("child4", make([]byte, 5), "root"))
+		assertEqual(t, []string{"child1", "child2"}, evicted)
+		assertEqual(t, int64(10), cache.Cost())
+		assertEqual(t, int64(10), stats.cost.Load())
+	})
+
+	t.Run("update recalculates cost", func(t *testing.T) {
+		var evicted []string
+		stats := &mockCostStats{}
+		cache := NewCache[string, []byte](0,
+			WithMaxCost[string, []byte](10),
+			WithCostFunc(costFunc),
+			WithStatsCollector[string, []byte](stats),
+			WithOnEvict(func(node CacheNode[string, []byte]) {
+				evicted = append(evicted, node.Key)
+			}),
+		)
+
+		assertNoError(t, cache.AddRoot("root", nil))
+		assertNoError(t, cache.Add("child1", make([]byte, 2), "root"))
+		assertNoError(t, cache.Add("child2", make([]byte, 2), "root"))
+		assertNoError(t, cache.Add("child3", make([]byte, 2), "root"))
+		assertNoError(t, cache.Add("child4", make([]byte, 2), "root"))
+		assertEqual(t, int64(8), cache.Cost())
+
+		// Shrinking the value doesn't evict anything.
+		assertNoError(t, cache.AddOrUpdate("child4", make([]byte, 1), "root"))
+		assertEqual(t, int64(7), cache.Cost())
+		assertNil(t, evicted)
+
+		// Growing the value evicts several nodes.
+		assertNoError(t, cache.AddOrUpdate("child4", make([]byte, 7), "root"))
+		assertEqual(t, []string{"child1", "child2"}, evicted)
+		assertEqual(t, int64(9), cache.Cost())
+		assertEqual(t, int64(9), stats.cost.Load())
+		assertEqual(t, []string{"root", "child4", "child3"}, getLRUOrder(cache))
+
+		assertEqual(t, 2, cache.Remove("child3")+cache.Remove("child4"))
+		assertEqual(t, int64(0), cache.Cost())
+		assertEqual(t, int64(0), stats.cost.Load())
+	})
+
+	t.Run("root is never evicted", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, []byte](0,
+			WithMaxCost[string, []byte](3),
+			WithCostFunc(costFunc),
+			WithOnEvict(func(node CacheNode[string, []byte]) {
+				evicted = append(evicted, node.Key)
+			}),
+		)
+		assertNoError(t, cache.AddRoot("root", make([]byte, 5)))
+		assertNoError(t, cache.Add("child", make([]byte, 1), "root"))
+		assertEqual(t, []string{"child"}, evicted)
+		assertEqual(t, 1, cache.Len())
+		assertEqual(t, int64(5), cache.Cost())
+	})
+
+	t.Run("node exceeding the maximum cost is rejected", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, []byte](0,
+			WithMaxCost[string, []byte](100),
+			WithCostFunc(costFunc),
+			WithOnEvict(func(node CacheNode[string, []byte]) {
+				evicted = append(evicted, node.Key)
+			}),
+		)
+		assertNoError(t, cache.AddRoot("root", nil))
+		for i := 0; i < 9; i++ {
+			assertNoError(t, cache.Add(fmt.Sprintf("child%d", i), make([]byte, 10), "root"))
+		}
+
+		assertErrorIs(t, cache.Add("big", make([]byte, 150), "root"), ErrCapacityExhausted)
+		assertErrorIs(t, cache.AddOrUpdate("big", make([]byte, 150), "root"), ErrCapacityExhausted)
+		_, ok := cache.Peek("big")
+		assertFalse(t, ok)
+
+		// The existing node keeps its value.
+		assertErrorIs(t, cache.AddOrUpdate("child0", make([]byte, 101), "root"), ErrCapacityExhausted)
+		node, _ := cache.Peek("child0")
+		assertEqual(t, 10, len(node.Value))
+
+		assertNil(t, evicted)
+		assertEqual(t, 10, cache.Len())
+		assertEqual(t, int64(90), cache.Cost())
+	})
+
+	t.Run("both limits are applied", func(t *testing.T) {
+		cache := NewCache[string, []byte](3, WithMaxCost[string, []byte](100), WithCostFunc(costFunc))
+		assertNoError(t, cache.AddRoot("root", nil))
+		for _, key := range []string{"child1", "child2", "child3"} {
+			assertNoError(t, cache.Add(key, make([]byte, 1), "root"))
+		}
+		assertEqual(t, []string{"root", "child3", "child2"}, getLRUOrder(cache))
+		assertEqual(t, int64(2), cache.Cost())
+	})
+
+	t.Run("default cost is 1", func(t *testing.T) {
+		cache := NewCache[string, int](0, WithMaxCost[string, int](3))
+		assertNoError(t, cache.AddRoot("root", 0))
+		for _, key := range []string{"child1", "child2", "child3"} {
+			assertNoError(t, cache.Add(key, 1, "root"))
+		}
+		assertEqual(t, 3, cache.Len())
+		assertEqual(t, int64(3), cache.Cost())
+	})
+}
@@ -0,0 +1,42 @@
+package lrutree
+
+// WithMultipleRoots enables the forest mode: AddRoot may be called several times to add independent trees
+// that share the capacity and the LRU order of the cache.
+//
+// Root nodes are never evicted (like the single root node), so a tree stays in the cache at least as its root
+// until it's removed by RemoveRoot or Remove. Other methods work within the tree of the given node
+// (e.g. TraverseToRoot stops at the root of the node's tree, and TraverseSubtree of a root visits only its tree).
+// The root of a tree may be moved under a node of another tree by AddOrUpdate, and then it stops being a root.
+//
+// This option is not supported by ShardedCache.
+func WithMultipleRoots[K comparable, V any]() CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.multipleRoots = true
+	}
+}
+
+// Roots returns all root nodes ordered from the most recently used one.
+// It doesn't update the LRU order and ignores the expiration (root nodes never expire).
+func (c *Cache[K, V]) Roots() []CacheNode[K, V] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.roots) == 0 {
+		return nil
+	}
+	// Roots are promoted on every access to their trees, so they are usually close to the front of the LRU list.
+	roots := make([]CacheNode[K, V], 0, len(c.roots))
+	for elem := c.lruList.Front(); elem != nil && len(roots) < len(c.roots); elem = elem.Next() {
+		if node := elem.Value.(*treeNode[K, V]); node.parent == nil {
+			roots = append(roots, node.toCacheNode())
+		}
+	}
+	return roots
+}
+
+// RemoveRoot deletes the root node with its whole tree from the cache.
+// It works like Remove, but does nothing (and returns 0) if the node with the given key is not a root.
+// It returns the total number of nodes removed from the cache.
+func (c *Cache[K, V]) RemoveRoot(key K) int {
+	return c.remove(key, true)
+}
@@ -0,0 +1,153 @@
+package lrutree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCache_MultipleRoots(t *testing.T) {
+	t.Run("independent trees share the capacity", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, int](4,
+			WithMultipleRoots[string, int](),
+			WithOnEvict(func(node CacheNode[string, int]) {
+				evicted = append(evicted, node.Key)
+			}),
+		)
+		assertNoError(t, cache.AddRoot("tenant1", 1))
+		assertNoError(t, cache.AddRoot("tenant2", 2))
+		assertErrorIs(t, cache.AddRoot("tenant1", 3), ErrAlreadyExists)
+		assertNoError(t, cache.Add("t1-child", 11, "tenant1"))
+		assertNoError(t, cache.Add("t2-child", 21, "tenant2"))
+		assertErrorIs(t, cache.AddRoot("t1-child", 3), ErrAlreadyExists)
+		assertEqual(t, []CacheNode[string, int]{{Key: "tenant2", Value: 2}, {Key: "tenant1", Value: 1}}, cache.Roots())
+
+		_, ok := cache.Get("t1-child")
+		assertTrue(t, ok)
+		assertEqual(t, []CacheNode[string, int]{{Key: "tenant1", Value: 1}, {Key: "tenant2", Value: 2}}, cache.Roots())
+
+		// Leaves of all trees compete for the same capacity. Roots are never evicted.
+		assertNoError(t, cache.AddRoot("tenant3", 3))
+		assertEqual(t, []string{"t2-child"}, evicted)
+		assertNoError(t, cache.Add("t3-child", 31, "tenant3"))
+		assertEqual(t, []string{"t2-child", "t1-child"}, evicted)
+		assertEqual(t, 4, cache.Len())
+	})
+
+	t.Run("traversals work per tree", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithMultipleRoots[string, int]())
+		assertNoError(t, cache.AddRoot("tenant1", 1))
+		assertNoError(t, cache.AddRoot("tenant2", 2))
+		assertNoError(t, cache.Add("a", 11, "tenant1"))
+		assertNoError(t, cache.Add("b", 12, "a"))
+		assertNoError(t, cache.Add("c", 21, "tenant2"))
+
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "tenant1", Value: 1},
+			{Key: "a", Value: 11, ParentKey: "tenant1"},
+			{Key: "b", Value: 12, ParentKey: "a"},
+		}, cache.GetBranch("b"))
+
+		var keys []string
+		cache.TraverseSubtree("tenant2", func(key string, val int, parentKey string) {
+			keys = append(keys, key)
+		})
+		assertEqual(t, []string{"tenant2", "c"}, keys)
+
+		keys = nil
+		cache.TraverseToRoot("b", func(key string, val int, parentKey string) {
+			keys = append(keys, key)
+		})
+		assertEqual(t, []string{"b", "a", "tenant1"}, keys)
+	})
+
+	t.Run("RemoveRoot", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithMultipleRoots[string, int]())
+		assertNoError(t, cache.AddRoot("tenant1", 1))
+		assertNoError(t, cache.AddRoot("tenant2", 2))
+		assertNoError(t, cache.Add("a", 11, "tenant1"))
+		assertNoError(t, cache.Add("b", 12, "a"))
+
+		assertEqual(t, 0, cache.RemoveRoot("a"))
+		assertEqual(t, 0, cache.RemoveRoot("nonexistent"))
+		assertEqual(t, 3, cache.RemoveRoot("tenant1"))
+		assertEqual(t, []CacheNode[string, int]{{Key: "tenant2", Value: 2}}, cache.Roots())
+		assertEqual(t, 1, cache.Len())
+
+		assertEqual(t, 1, cache.RemoveRoot("tenant2"))
+		assertNil(t, cache.Roots())
+	})
+
+	t.Run("root can be moved under another tree", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithMultipleRoots[string, int]())
+		assertNoError(t, cache.AddRoot("tenant1", 1))
+		assertNoError(t, cache.AddRoot("tenant2", 2))
+		assertNoError(t, cache.Add("a", 11, "tenant1"))
+		assertNoError(t, cache.AddOrUpdate("tenant2", 2, "a"))
+		assertEqual(t, []CacheNode[string, int]{{Key: "tenant1", Value: 1}}, cache.Roots())
+		assertErrorIs(t, cache.AddOrUpdate("tenant1", 1, "tenant2"), ErrCycleDetected)
+	})
+
+	t.Run("AddBranch starting from a root", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithMultipleRoots[string, int]())
+		assertNoError(t, cache.AddRoot("tenant1", 1))
+		assertNoError(t, cache.AddRoot("tenant2", 2))
+		assertNoError(t, cache.AddBranch([]CacheNode[string, int]{
+			{Key: "tenant2", Value: 2},
+			{Key: "a", Value: 21, ParentKey: "tenant2"},
+		}))
+		assertEqual(t, 3, cache.Len())
+
+		// A branch starting with a new node without a parent adds a new tree.
+		assertNoError(t, cache.AddBranch([]CacheNode[string, int]{
+			{Key: "tenant3", Value: 3},
+			{Key: "b", Value: 31, ParentKey: "tenant3"},
+		}))
+		assertEqual(t, 3, len(cache.Roots()))
+		assertEqual(t, 5, cache.Len())
+
+		// An existing node can't become a root.
+		assertErrorIs(t, cache.AddOrUpdateBranch([]CacheNode[string, int]{{Key: "a", Value: 21}}), ErrAlreadyExists)
+		assertErrorIs(t, cache.AddBranch([]CacheNode[string, int]{
+			{Key: "tenant4", Value: 4, ParentKey: "nonexistent"},
+		}), ErrParentNotExist)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("single root by default", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertErrorIs(t, cache.AddRoot("root2", 2), ErrRootAlreadyExists)
+		assertEqual(t, 0, cache.RemoveRoot("nonexistent"))
+		assertEqual(t, 1, cache.RemoveRoot("root"))
+		assertNoError(t, cache.AddRoot("root2", 2))
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithMultipleRoots[string, int]())
+		assertNoError(t, cache.AddRoot("tenant1", 1))
+		assertNoError(t, cache.AddRoot("tenant2", 2))
+		assertNoError(t, cache.Add("a", 11, "tenant1"))
+
+		var buf bytes.Buffer
+		assertNoError(t, cache.WriteSnapshot(&buf, JSONCodec{}))
+		data := buf.Bytes()
+
+		restored, err := RestoreCache[string, int](bytes.NewReader(data), JSONCodec{}, 10, WithMultipleRoots[string, int]())
+		assertNoError(t, err)
+		assertEqual(t, cache.Roots(), restored.Roots())
+		assertEqual(t, getLRUOrder(cache), getLRUOrder(restored))
+
+		_, err = RestoreCache[string, int](bytes.NewReader(data), JSONCodec{}, 10)
+		assertErrorIs(t, err, ErrInvalidSnapshot)
+	})
+}
+
+func TestShardedCache_MultipleRootsNotSupported(t *testing.T) {
+	cache := NewShardedCache[string, int](2, 10, WithShardOptions(WithMultipleRoots[string, int]()))
+	assertNoError(t, cache.AddRoot("root", 1))
+	assertErrorIs(t, cache.AddRoot("root2", 2), ErrRootAlreadyExists)
+	for _, shard := range cache.shards {
+		assertEqual(t, []CacheNode[string, int]{{Key: "root", Value: 1}}, shard.Roots())
+	}
+}
@@ -0,0 +1,145 @@
+package lrutree
+
+import (
+	"iter"
+	"time"
+)
+
+// Iterators returned by the methods below capture a consistent snapshot of the requested nodes
+// under the read lock when the iteration starts, and the lock is not held while the loop body runs.
+// So the loop body may call other methods of the cache, and breaking out of the loop early is cheap.
+// Changes made after the snapshot is taken are not visible to the iteration.
+//
+// Iterators don't mark nodes as recently used (like Peek), and expired nodes are skipped.
+// The order of siblings is unspecified.
+
+// All returns an iterator over the keys and values of all nodes in the cache.
+// Nodes are visited in pre-order depth-first order starting from the root(s), so parents always precede their descendants.
+func (c *Cache[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		nodes := func() []CacheNode[K, V] {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+
+			now := c.now()
+			nodes := make([]CacheNode[K, V], 0, len(c.keysMap))
+			for _, root := range c.roots {
+				nodes = appendSubtree(nodes, root, now)
+			}
+			return nodes
+		}()
+		yieldNodes(nodes, yield)
+	}
+}
+
+// ByRecency returns an iterator over the keys and values of all nodes in the cache
+// ordered from the most recently used to the least recently used one.
+// Since accessing a node marks its ancestors as recently used too, parents always precede their descendants.
+func (c *Cache[K, V]) ByRecency() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		nodes := func() []CacheNode[K, V] {
+			if c.accessBuf != nil {
+				// Pending accesses must be applied to get the actual order, which requires the exclusive lock.
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				c.drainAccessBuffer()
+			} else {
+				c.mu.RLock()
+				defer c.mu.RUnlock()
+			}
+
+			now := c.now()
+			nodes := make([]CacheNode[K, V], 0, len(c.keysMap))
+			for elem := c.lruList.Front(); elem != nil; elem = elem.Next() {
+				if node := elem.Value.(*treeNode[K, V]); !node.absent && !node.isExpired(now) {
+					nodes = append(nodes, node.toCacheNode())
+				}
+			}
+			return nodes
+		}()
+		yieldNodes(nodes, yield)
+	}
+}
+
+// Subtree returns an iterator over the keys and values of the node with the given key and all its descendants
+// in pre-order depth-first order (see TraverseSubtree). The iteration is empty if the node doesn't exist.
+func (c *Cache[K, V]) Subtree(key K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		nodes := c.collectFrom(key, func(node *treeNode[K, V], now time.Time) []CacheNode[K, V] {
+			return appendSubtree(nil, node, now)
+		})
+		yieldNodes(nodes, yield)
+	}
+}
+
+// Ancestors returns an iterator over the keys and values of the node with the given key and its ancestors,
+// from the node itself up to the root (see TraverseToRoot). The iteration is empty if the node doesn't exist.
+func (c *Cache[K, V]) Ancestors(key K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		nodes := c.collectFrom(key, func(node *treeNode[K, V], _ time.Time) []CacheNode[K, V] {
+			var nodes []CacheNode[K, V]
+			for n := node; n != nil; n = n.parent {
+				nodes = append(nodes, n.toCacheNode())
+			}
+			return nodes
+		})
+		yieldNodes(nodes, yield)
+	}
+}
+
+// Children returns an iterator over the keys and values of the direct children of the node with the given key.
+// The iteration is empty if the node doesn't exist or has no children.
+// Since children may be evicted independently, they may be only a part of the actual child set;
+// use ChildrenIfComplete to list children only when the child set is known to be complete.
+func (c *Cache[K, V]) Children(key K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		nodes := c.collectFrom(key, func(node *treeNode[K, V], now time.Time) []CacheNode[K, V] {
+			nodes := make([]CacheNode[K, V], 0, len(node.children))
+			for _, child := range node.children {
+				if !child.isExpired(now) {
+					nodes = append(nodes, child.toCacheNode())
+				}
+			}
+			return nodes
+		})
+		yieldNodes(nodes, yield)
+	}
+}
+
+// collectFrom looks up the node under the read lock and collects nodes starting from it.
+// Hits and misses are reported like in PeekBranch.
+func (c *Cache[K, V]) collectFrom(
+	key K, collect func(node *treeNode[K, V], now time.Time) []CacheNode[K, V],
+) []CacheNode[K, V] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now()
+	node, exists := c.keysMap[key]
+	if !exists || node.isExpired(now) {
+		c.stats.IncMisses()
+		return nil
+	}
+	c.stats.IncHits()
+	return collect(node, now)
+}
+
+// appendSubtree appends the node and its non-expired descendants in pre-order.
+func appendSubtree[K comparable, V any](nodes []CacheNode[K, V], node *treeNode[K, V], now time.Time) []CacheNode[K, V] {
+	if node.isExpired(now) {
+		return nodes
+	}
+	nodes = append(nodes, node.toCacheNode())
+	for _, child := range node.children {
+		nodes = appendSubtree(nodes, child, now)
+	}
+	return nodes
+}
+
+func yieldNodes[K comparable, V any](nodes []CacheNode[K, V], yield func(K, V) bool) {
+	for _, node := range nodes {
+		if !yield(node.Key, node.Value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package lrutree
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCache_Iterators(t *testing.T) {
+	newCache := func() *Cache[string, int] {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Add("a1", 11, "a"))
+		assertNoError(t, cache.Add("a2", 12, "a"))
+		assertNoError(t, cache.Add("b", 2, "root"))
+		assertNoError(t, cache.Add("b1", 21, "b"))
+		return cache
+	}
+
+	collectKeys := func(seq func(yield func(string, int) bool)) []string {
+		var keys []string
+		for k := range seq {
+			keys = append(keys, k)
+		}
+		return keys
+	}
+
+	t.Run("All", func(t *testing.T) {
+		cache := newCache()
+		assertEqual(t, map[string]int{"root": 0, "a": 1, "a1": 11, "a2": 12, "b": 2, "b1": 21}, maps.Collect(cache.All()))
+		keys := collectKeys(cache.All())
+		assertEqual(t, "root", keys[0])
+		assertTrue(t, slices.Index(keys, "a") < slices.Index(keys, "a1"))
+		assertTrue(t, slices.Index(keys, "b") < slices.Index(keys, "b1"))
+		assertEqual(t, 0, len(maps.Collect(NewCache[string, int](10).All())))
+	})
+
+	t.Run("ByRecency", func(t *testing.T) {
+		cache := newCache()
+		cache.Get("a1")
+		assertEqual(t, getLRUOrder(cache), collectKeys(cache.ByRecency()))
+		assertEqual(t, []string{"root", "a", "a1", "b", "b1", "a2"}, collectKeys(cache.ByRecency()))
+	})
+
+	t.Run("Subtree", func(t *testing.T) {
+		cache := newCache()
+		assertEqual(t, map[string]int{"a": 1, "a1": 11, "a2": 12}, maps.Collect(cache.Subtree("a")))
+		assertEqual(t, "a", collectKeys(cache.Subtree("a"))[0])
+		assertEqual(t, []string{"b1"}, collectKeys(cache.Subtree("b1")))
+		assertEqual(t, 0, len(collectKeys(cache.Subtree("nonexistent"))))
+		// Iteration doesn't affect the LRU order.
+		assertEqual(t, []string{"root", "b", "b1", "a", "a2", "a1"}, getLRUOrder(cache))
+	})
+
+	t.Run("Ancestors", func(t *testing.T) {
+		cache := newCache()
+		assertEqual(t, []string{"a2", "a", "root"}, collectKeys(cache.Ancestors("a2")))
+		assertEqual(t, []string{"root"}, collectKeys(cache.Ancestors("root")))
+		assertEqual(t, 0, len(collectKeys(cache.Ancestors("nonexistent"))))
+	})
+
+	t.Run("Children", func(t *testing.T) {
+		cache := newCache()
+		assertEqual(t, map[string]int{"a": 1, "b": 2}, maps.Collect(cache.Children("root")))
+		assertEqual(t, 0, len(collectKeys(cache.Children("a1"))))
+		assertEqual(t, 0, len(collectKeys(cache.Children("nonexistent"))))
+	})
+
+	t.Run("break and modification in loop body", func(t *testing.T) {
+		cache := newCache()
+		var visited []string
+		for k := range cache.Subtree("root") {
+			visited = append(visited, k)
+			// The lock is not held, so the cache may be modified in the loop body.
+			assertNoError(t, cache.Add(k+"-new", 0, k))
+			if len(visited) == 2 {
+				break
+			}
+		}
+		assertEqual(t, 2, len(visited))
+		assertEqual(t, 8, cache.Len())
+		assertEqual(t, 3, len(collectKeys(cache.Children("root")))) // "a", "b" and "root-new".
+	})
+
+	t.Run("expired nodes are skipped", func(t *testing.T) {
+		now := time.Now()
+		cache := newCache()
+		cache.now = func() time.Time { return now }
+		assertNoError(t, cache.AddWithTTL("c", 3, "root", time.Minute))
+		assertNoError(t, cache.Add("c1", 31, "c"))
+		now = now.Add(time.Minute)
+
+		assertEqual(t, 6, len(maps.Collect(cache.All())))
+		assertEqual(t, 6, len(collectKeys(cache.ByRecency())))
+		assertEqual(t, []string{"a", "b"}, slices.Sorted(maps.Keys(maps.Collect(cache.Children("root")))))
+		assertEqual(t, 0, len(collectKeys(cache.Ancestors("c1"))))
+		assertEqual(t, 0, len(collectKeys(cache.Subtree("c"))))
+	})
+
+	t.Run("ByRecency with buffered promotion", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithBufferedPromotion[string, int](16))
+		defer cache.Close()
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Add("b", 2, "root"))
+		cache.Get("a")
+		assertEqual(t, []string{"root", "a", "b"}, collectKeys(cache.ByRecency()))
+	})
+}
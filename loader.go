@@ -0,0 +1,175 @@
+package lrutree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrLoaderNotSet is returned by GetOrLoad when the cache was created without WithLoader.
+var ErrLoaderNotSet = errors.New("loader is not set")
+
+// ErrLoaderPanicked is returned by GetOrLoad when the loader panics. It's wrapped with the panic value.
+var ErrLoaderPanicked = errors.New("loader panicked")
+
+// Loader loads nodes that are missing in the cache from an underlying data source (e.g. database).
+type Loader[K comparable, V any] interface {
+	// Load returns the value of the node with the given key and the key of its parent.
+	Load(ctx context.Context, key K) (val V, parentKey K, err error)
+}
+
+// LoaderFunc is an adapter to allow the use of ordinary functions as Loader.
+type LoaderFunc[K comparable, V any] func(ctx context.Context, key K) (val V, parentKey K, err error)
+
+// Load calls f(ctx, key).
+func (f LoaderFunc[K, V]) Load(ctx context.Context, key K) (val V, parentKey K, err error) {
+	return f(ctx, key)
+}
+
+// WithLoader sets a loader that is used by GetOrLoad to fetch missing nodes.
+func WithLoader[K comparable, V any](loader Loader[K, V]) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.loader = loader
+	}
+}
+
+// loadCall represents an in-flight or completed load of a branch for a single key.
+type loadCall[K comparable, V any] struct {
+	done    chan struct{}
+	node    CacheNode[K, V]
+	err     error
+	waiters int                // Number of callers waiting for the result. Guarded by loadMu.
+	cancel  context.CancelFunc // Cancels the context of the load.
+}
+
+// GetOrLoad retrieves a node from the cache like Get does, or loads it using the loader set by WithLoader.
+//
+// If the node is missing, it's loaded together with all its missing ancestors (up to the nearest
+// ancestor that is present in the cache), and the whole branch is inserted into the cache atomically.
+// Concurrent calls for the same key are de-duplicated, so the loader is called only once per requested key
+// (calls for different keys may load their common missing ancestors independently).
+// The shared load is canceled only when contexts of all callers waiting for it are done,
+// while a caller whose context is done stops waiting and gets the error of its context.
+// The root node is never loaded and must be added by AddRoot.
+//
+// ErrLoaderNotSet is returned if the cache has no loader.
+// ErrKnownAbsent is returned without calling the loader if the node is known to be absent (see AddNegative).
+// ErrCycleDetected is returned if the loader reports parents that form a cycle.
+// ErrParentNotExist is returned if the nearest cached ancestor was removed while the branch was being loaded,
+// and ErrAlreadyExists is returned if a node of the branch was concurrently added under another parent.
+// ErrLoaderPanicked is returned if the loader panics. Errors returned by the loader are passed through.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K) (CacheNode[K, V], error) {
+	defer c.observe(OpGetOrLoad)()
+
+	switch cacheNode, status := c.Lookup(key); status {
+	case LookupHit:
+		return cacheNode, nil
+	case LookupAbsent:
+		return CacheNode[K, V]{}, ErrKnownAbsent
+	}
+	if c.loader == nil {
+		return CacheNode[K, V]{}, ErrLoaderNotSet
+	}
+	return c.loadOnce(ctx, key, func(ctx context.Context) (CacheNode[K, V], error) {
+		branch, err := c.loadBranch(ctx, key, c.contains)
+		if err != nil {
+			return CacheNode[K, V]{}, err
+		}
+		return c.addBranch(branch, false)
+	})
+}
+
+// loadOnce calls load for the key, de-duplicating concurrent calls for the same key.
+// The load runs in its own goroutine, so every caller may stop waiting for it when its context is done.
+func (c *Cache[K, V]) loadOnce(
+	ctx context.Context, key K, load func(ctx context.Context) (CacheNode[K, V], error),
+) (CacheNode[K, V], error) {
+	c.loadMu.Lock()
+	call, ok := c.loadCalls[key]
+	if !ok {
+		// The load is shared by all callers, so it's detached from the context of the first one.
+		loadCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &loadCall[K, V]{done: make(chan struct{}), cancel: cancel}
+		if c.loadCalls == nil {
+			c.loadCalls = make(map[K]*loadCall[K, V])
+		}
+		c.loadCalls[key] = call
+		go c.runLoad(loadCtx, key, call, load)
+	}
+	call.waiters++
+	c.loadMu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.node, call.err
+	case <-ctx.Done():
+		c.loadMu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// Nobody waits for the result anymore, so the load is canceled,
+			// and callers that come later start a new one instead of joining it.
+			call.cancel()
+			if c.loadCalls[key] == call {
+				delete(c.loadCalls, key)
+			}
+		}
+		c.loadMu.Unlock()
+		return CacheNode[K, V]{}, ctx.Err()
+	}
+}
+
+func (c *Cache[K, V]) runLoad(
+	ctx context.Context, key K, call *loadCall[K, V], load func(ctx context.Context) (CacheNode[K, V], error),
+) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.node, call.err = CacheNode[K, V]{}, fmt.Errorf("%w: %v", ErrLoaderPanicked, r)
+		}
+		c.loadMu.Lock()
+		if c.loadCalls[key] == call {
+			delete(c.loadCalls, key)
+		}
+		c.loadMu.Unlock()
+		call.cancel()
+		close(call.done)
+	}()
+
+	call.node, call.err = load(ctx)
+}
+
+// loadBranch loads the node with the given key and all its ancestors that are missing in the cache
+// (contains reports whether the node is present).
+// The returned branch is ordered from the topmost loaded ancestor to the node itself.
+func (c *Cache[K, V]) loadBranch(ctx context.Context, key K, contains func(key K) bool) ([]CacheNode[K, V], error) {
+	var branch []CacheNode[K, V]
+	visited := make(map[K]struct{})
+	for k := key; ; {
+		visited[k] = struct{}{}
+		val, parentKey, err := c.loader.Load(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		branch = append(branch, CacheNode[K, V]{Key: k, Value: val, ParentKey: parentKey})
+		if contains(parentKey) {
+			break
+		}
+		if _, ok := visited[parentKey]; ok {
+			c.reportCycleRejection()
+			return nil, ErrCycleDetected
+		}
+		k = parentKey
+	}
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+	return branch, nil
+}
+
+// contains reports whether the non-expired node with the given key is present in the cache.
+func (c *Cache[K, V]) contains(key K) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	node, exists := c.keysMap[key]
+	return exists && !node.isExpired(c.now())
+}
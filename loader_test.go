@@ -0,0 +1,280 @@
+package lrutree
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mockLoader struct {
+	nodes   map[string]CacheNode[string, int]
+	calls   atomic.Int32
+	release chan struct{} // If not nil, Load blocks until it's closed.
+}
+
+func (l *mockLoader) Load(ctx context.Context, key string) (int, string, error) {
+	l.calls.Add(1)
+	if l.release != nil {
+		select {
+		case <-l.release:
+		case <-ctx.Done():
+			return 0, "", ctx.Err()
+		}
+	}
+	node, ok := l.nodes[key]
+	if !ok {
+		return 0, "", errNotFoundInDB
+	}
+	return node.Value, node.ParentKey, nil
+}
+
+var errNotFoundInDB = errors.New("not found in DB")
+
+func newMockLoader() *mockLoader {
+	return &mockLoader{nodes: map[string]CacheNode[string, int]{
+		"sub-root":   {Key: "sub-root", Value: 2, ParentKey: "root"},
+		"partner-1":  {Key: "partner-1", Value: 3, ParentKey: "sub-root"},
+		"customer-1": {Key: "customer-1", Value: 4, ParentKey: "partner-1"},
+		"customer-2": {Key: "customer-2", Value: 5, ParentKey: "partner-1"},
+		"cycle-1":    {Key: "cycle-1", Value: 6, ParentKey: "cycle-2"},
+		"cycle-2":    {Key: "cycle-2", Value: 7, ParentKey: "cycle-1"},
+	}}
+}
+
+func TestCache_GetOrLoad(t *testing.T) {
+	t.Run("loads missing ancestors", func(t *testing.T) {
+		loader := newMockLoader()
+		cache := NewCache[string, int](10, WithLoader[string, int](loader))
+		assertNoError(t, cache.AddRoot("root", 1))
+
+		cacheNode, err := cache.GetOrLoad(context.Background(), "customer-1")
+		assertNoError(t, err)
+		assertEqual(t, CacheNode[string, int]{Key: "customer-1", Value: 4, ParentKey: "partner-1"}, cacheNode)
+		assertEqual(t, int32(3), loader.calls.Load())
+		assertEqual(t, []string{"root", "sub-root", "partner-1", "customer-1"}, getLRUOrder(cache))
+
+		// Only the missing node is loaded when its parent is cached.
+		cacheNode, err = cache.GetOrLoad(context.Background(), "customer-2")
+		assertNoError(t, err)
+		assertEqual(t, CacheNode[string, int]{Key: "customer-2", Value: 5, ParentKey: "partner-1"}, cacheNode)
+		assertEqual(t, int32(4), loader.calls.Load())
+		assertEqual(t, []string{"root", "sub-root", "partner-1", "customer-2", "customer-1"}, getLRUOrder(cache))
+
+		// Cached node is returned without loading and is marked as recently used.
+		cacheNode, err = cache.GetOrLoad(context.Background(), "customer-1")
+		assertNoError(t, err)
+		assertEqual(t, CacheNode[string, int]{Key: "customer-1", Value: 4, ParentKey: "partner-1"}, cacheNode)
+		assertEqual(t, int32(4), loader.calls.Load())
+		assertEqual(t, []string{"root", "sub-root", "partner-1", "customer-1", "customer-2"}, getLRUOrder(cache))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 1))
+		_, err := cache.GetOrLoad(context.Background(), "sub-root")
+		assertErrorIs(t, err, ErrLoaderNotSet)
+
+		loader := newMockLoader()
+		cache = NewCache[string, int](10, WithLoader[string, int](loader))
+		assertNoError(t, cache.AddRoot("root", 1))
+
+		_, err = cache.GetOrLoad(context.Background(), "nonexistent")
+		assertErrorIs(t, err, errNotFoundInDB)
+
+		_, err = cache.GetOrLoad(context.Background(), "cycle-1")
+		assertErrorIs(t, err, ErrCycleDetected)
+
+		assertEqual(t, 1, cache.Len())
+	})
+
+	t.Run("concurrent loads are de-duplicated", func(t *testing.T) {
+		loader := newMockLoader()
+		loader.release = make(chan struct{})
+		cache := NewCache[string, int](10, WithLoader[string, int](LoaderFunc[string, int](loader.Load)))
+		assertNoError(t, cache.AddRoot("root", 1))
+
+		const goroutines = 10
+		results := make(chan CacheNode[string, int], goroutines)
+		var wg sync.WaitGroup
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cacheNode, err := cache.GetOrLoad(context.Background(), "sub-root")
+				if err != nil {
+					panic(err)
+				}
+				results <- cacheNode
+			}()
+		}
+		waitForLoadWaiters(cache, "sub-root", goroutines)
+		close(loader.release)
+		wg.Wait()
+		close(results)
+
+		for cacheNode := range results {
+			assertEqual(t, CacheNode[string, int]{Key: "sub-root", Value: 2, ParentKey: "root"}, cacheNode)
+		}
+		assertEqual(t, int32(1), loader.calls.Load())
+		assertEqual(t, 2, cache.Len())
+	})
+
+	t.Run("waiting is canceled by context", func(t *testing.T) {
+		loader := newMockLoader()
+		loader.release = make(chan struct{})
+		cache := NewCache[string, int](10, WithLoader[string, int](loader))
+		assertNoError(t, cache.AddRoot("root", 1))
+
+		leaderDone := make(chan error)
+		go func() {
+			_, err := cache.GetOrLoad(context.Background(), "sub-root")
+			leaderDone <- err
+		}()
+		for loader.calls.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := cache.GetOrLoad(ctx, "sub-root")
+		assertErrorIs(t, err, context.DeadlineExceeded)
+
+		close(loader.release)
+		assertNoError(t, <-leaderDone)
+	})
+
+	t.Run("load is not canceled while someone waits for it", func(t *testing.T) {
+		loader := newMockLoader()
+		loader.release = make(chan struct{})
+		cache := NewCache[string, int](10, WithLoader[string, int](loader))
+		assertNoError(t, cache.AddRoot("root", 1))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		leaderDone := make(chan error)
+		go func() {
+			_, err := cache.GetOrLoad(ctx, "sub-root")
+			leaderDone <- err
+		}()
+		waitForLoadWaiters(cache, "sub-root", 1)
+		waiterDone := make(chan error)
+		go func() {
+			_, err := cache.GetOrLoad(context.Background(), "sub-root")
+			waiterDone <- err
+		}()
+		waitForLoadWaiters(cache, "sub-root", 2)
+
+		// The first caller leaves, but the load goes on for the other one.
+		cancel()
+		assertErrorIs(t, <-leaderDone, context.Canceled)
+		close(loader.release)
+		assertNoError(t, <-waiterDone)
+		assertEqual(t, int32(1), loader.calls.Load())
+		_, ok := cache.Peek("sub-root")
+		assertTrue(t, ok)
+	})
+
+	t.Run("load is canceled when all callers leave", func(t *testing.T) {
+		loader := newMockLoader()
+		loader.release = make(chan struct{})
+		cache := NewCache[string, int](10, WithLoader[string, int](loader))
+		assertNoError(t, cache.AddRoot("root", 1))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := cache.GetOrLoad(ctx, "sub-root")
+		assertErrorIs(t, err, context.Canceled)
+
+		// The next call starts a new load instead of joining the canceled one.
+		close(loader.release)
+		_, err = cache.GetOrLoad(context.Background(), "sub-root")
+		assertNoError(t, err)
+	})
+
+	t.Run("loader panics", func(t *testing.T) {
+		release := make(chan struct{})
+		cache := NewCache[string, int](10, WithLoader[string, int](LoaderFunc[string, int](
+			func(ctx context.Context, key string) (int, string, error) {
+				<-release
+				panic("boom")
+			},
+		)))
+		assertNoError(t, cache.AddRoot("root", 1))
+
+		const goroutines = 3
+		errs := make(chan error, goroutines)
+		for i := 0; i < goroutines; i++ {
+			go func() {
+				_, err := cache.GetOrLoad(context.Background(), "sub-root")
+				errs <- err
+			}()
+		}
+		waitForLoadWaiters(cache, "sub-root", goroutines)
+		close(release)
+		for i := 0; i < goroutines; i++ {
+			err := <-errs
+			assertErrorIs(t, err, ErrLoaderPanicked)
+			assertEqual(t, "loader panicked: boom", err.Error())
+		}
+		assertEqual(t, 1, cache.Len())
+	})
+
+	t.Run("branch inserted concurrently", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root", 2, "root"))
+
+		// The beginning of the branch is already cached.
+		cacheNode, err := cache.addBranch([]CacheNode[string, int]{
+			{Key: "sub-root", Value: 20, ParentKey: "root"},
+			{Key: "partner-1", Value: 3, ParentKey: "sub-root"},
+		}, false)
+		assertNoError(t, err)
+		assertEqual(t, CacheNode[string, int]{Key: "partner-1", Value: 3, ParentKey: "sub-root"}, cacheNode)
+		sub, _ := cache.Peek("sub-root")
+		assertEqual(t, 2, sub.Value)
+
+		// The node of the branch is cached under another parent.
+		_, err = cache.addBranch([]CacheNode[string, int]{
+			{Key: "partner-2", Value: 4, ParentKey: "root"},
+			{Key: "partner-1", Value: 3, ParentKey: "partner-2"},
+		}, false)
+		assertErrorIs(t, err, ErrAlreadyExists)
+		_, err = cache.addBranch([]CacheNode[string, int]{
+			{Key: "sub-root", Value: 4, ParentKey: "partner-1"},
+		}, false)
+		assertErrorIs(t, err, ErrAlreadyExists)
+		assertEqual(t, 3, cache.Len())
+
+		// The nearest cached ancestor was removed.
+		_, err = cache.addBranch([]CacheNode[string, int]{
+			{Key: "customer-1", Value: 5, ParentKey: "nonexistent"},
+		}, false)
+		assertErrorIs(t, err, ErrParentNotExist)
+
+		// The nearest cached ancestor was removed along with the root, so the cache is empty.
+		cache.Remove("root")
+		_, err = cache.addBranch([]CacheNode[string, int]{
+			{Key: "partner-1", Value: 3, ParentKey: "sub-root"},
+		}, false)
+		assertErrorIs(t, err, ErrParentNotExist)
+		assertEqual(t, 0, cache.Len())
+	})
+}
+
+// waitForLoadWaiters waits until the given number of callers wait for the load of the key.
+func waitForLoadWaiters[K comparable, V any](c *Cache[K, V], key K, waiters int) {
+	for {
+		c.loadMu.Lock()
+		call, ok := c.loadCalls[key]
+		joined := ok && call.waiters == waiters
+		c.loadMu.Unlock()
+		if joined {
+			return
+		}
+		runtime.Gosched()
+	}
+}
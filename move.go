@@ -0,0 +1,118 @@
+package lrutree
+
+// Move relocates the node with its whole subtree under the new parent without changing values.
+//
+// The node and its descendants keep their positions in the LRU order, while the new parent and its ancestors
+// are marked as recently used (like in Add). Expiration times are adjusted according to the ExpirationMode,
+// so the node still never outlives its new ancestors.
+// If the new parent is inside a subtree with a quota (see SetSubtreeQuota), nodes may be evicted to fit it.
+//
+// ErrNodeNotExist is returned if the node doesn't exist, and ErrParentNotExist is returned if the new parent
+// doesn't exist. ErrCycleDetected is returned if the new parent is the node itself or its descendant.
+func (c *Cache[K, V]) Move(key K, newParentKey K) error {
+	defer c.observe(OpMove)()
+
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	node, exists := c.keysMap[key]
+	if !exists || c.reapIfExpired(node, now, &evictedNodes) {
+		return ErrNodeNotExist
+	}
+	parent, parentExists := c.keysMap[newParentKey]
+	if !parentExists || c.reapIfExpired(parent, now, &evictedNodes) {
+		return ErrParentNotExist
+	}
+
+	if node.parent != parent {
+		if err := c.checkCycle(node, parent); err != nil {
+			return err
+		}
+		c.setParent(node, parent)
+		c.setExpiration(node, node.expiresAt)
+		if c.extStats != nil {
+			c.extStats.IncReparents()
+		}
+	}
+
+	for n := parent; n != nil; n = n.parent {
+		c.promote(n)
+	}
+
+	c.evictIfNeeded(&evictedNodes, nil)
+
+	c.reportAmount()
+
+	return nil
+}
+
+// Rename changes the key of the node, keeping its value, children, expiration time and position in the LRU order.
+// Children of the node are reported with the new parent key afterwards.
+//
+// If an EvictionPolicy is set, the node is re-registered in it under the new key (so its policy-specific
+// state, e.g. access frequency, is reset). If a cost function is set, the cost of the node is recalculated,
+// which may cause eviction of other nodes.
+//
+// ErrNodeNotExist is returned if the node doesn't exist, and ErrAlreadyExists is returned
+// if a node with the new key already exists.
+func (c *Cache[K, V]) Rename(oldKey K, newKey K) error {
+	defer c.observe(OpRename)()
+
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	node, exists := c.keysMap[oldKey]
+	if !exists || c.reapIfExpired(node, now, &evictedNodes) {
+		return ErrNodeNotExist
+	}
+	if oldKey == newKey {
+		return nil
+	}
+	if existingNode, exists := c.keysMap[newKey]; exists && !c.reapIfExpired(existingNode, now, &evictedNodes) {
+		return ErrAlreadyExists
+	}
+	if negNode, exists := c.negatives[newKey]; exists {
+		c.deleteNegative(negNode)
+	}
+
+	delete(c.keysMap, oldKey)
+	c.keysMap[newKey] = node
+	if node.parent != nil {
+		delete(node.parent.children, oldKey)
+		node.parent.children[newKey] = node
+	} else {
+		delete(c.roots, oldKey)
+		c.roots[newKey] = node
+	}
+	node.key = newKey
+	c.invalidateMemo(node)
+
+	if c.policy != nil {
+		c.policy.OnRemove(oldKey)
+		c.policy.OnInsert(newKey)
+	}
+	if c.onDelete != nil {
+		c.onDelete(oldKey)
+	}
+	if c.onInsert != nil {
+		c.onInsert(newKey)
+	}
+
+	// The cost may depend on the key, so it's recalculated.
+	c.updateCost(node)
+	c.evictIfNeeded(&evictedNodes, nil)
+
+	c.reportAmount()
+
+	return nil
+}
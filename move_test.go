@@ -0,0 +1,143 @@
+package lrutree
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_Move(t *testing.T) {
+	t.Run("moves subtree without touching values", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("docs", 1, "root"))
+		assertNoError(t, cache.Add("folder", 2, "docs"))
+		assertNoError(t, cache.Add("file", 3, "folder"))
+		assertNoError(t, cache.Add("archive", 4, "root"))
+		assertEqual(t, []string{"root", "archive", "docs", "folder", "file"}, getLRUOrder(cache))
+
+		assertNoError(t, cache.Move("folder", "archive"))
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "root", Value: 0},
+			{Key: "archive", Value: 4, ParentKey: "root"},
+			{Key: "folder", Value: 2, ParentKey: "archive"},
+			{Key: "file", Value: 3, ParentKey: "folder"},
+		}, cache.PeekBranch("file"))
+		// The moved subtree keeps its position in the LRU order.
+		assertEqual(t, []string{"root", "archive", "docs", "folder", "file"}, getLRUOrder(cache))
+
+		// "docs" becomes a leaf and may be evicted now.
+		assertEqual(t, 0, len(cache.keysMap["docs"].children))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Add("b", 2, "a"))
+
+		assertErrorIs(t, cache.Move("nonexistent", "root"), ErrNodeNotExist)
+		assertErrorIs(t, cache.Move("a", "nonexistent"), ErrParentNotExist)
+		assertErrorIs(t, cache.Move("a", "b"), ErrCycleDetected)
+		assertErrorIs(t, cache.Move("a", "a"), ErrCycleDetected)
+		assertErrorIs(t, cache.Move("root", "b"), ErrCycleDetected)
+		assertNoError(t, cache.Move("b", "a")) // The same parent.
+		assertEqual(t, 3, len(cache.PeekBranch("b")))
+	})
+
+	t.Run("expiration is capped by the new parent", func(t *testing.T) {
+		now := time.Now()
+		cache := NewCache[string, int](10)
+		cache.now = func() time.Time { return now }
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.AddWithTTL("short", 1, "root", time.Minute))
+		assertNoError(t, cache.Add("a", 2, "root"))
+		assertNoError(t, cache.Add("b", 3, "a"))
+
+		assertNoError(t, cache.Move("a", "short"))
+		now = now.Add(time.Minute)
+		for _, key := range []string{"short", "a", "b"} {
+			_, ok := cache.Peek(key)
+			assertFalse(t, ok)
+		}
+	})
+}
+
+func TestCache_Rename(t *testing.T) {
+	t.Run("keeps children and LRU position", func(t *testing.T) {
+		stats := &mockStats{}
+		cache := NewCache[string, int](10, WithStatsCollector[string, int](stats))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("folder", 1, "root"))
+		assertNoError(t, cache.Add("file1", 2, "folder"))
+		assertNoError(t, cache.Add("file2", 3, "folder"))
+		assertNoError(t, cache.Add("other", 4, "root"))
+		lruOrder := getLRUOrder(cache)
+
+		assertNoError(t, cache.Rename("folder", "renamed"))
+		_, ok := cache.Peek("folder")
+		assertFalse(t, ok)
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "root", Value: 0},
+			{Key: "renamed", Value: 1, ParentKey: "root"},
+			{Key: "file1", Value: 2, ParentKey: "renamed"},
+		}, cache.PeekBranch("file1"))
+		for i := range lruOrder {
+			if lruOrder[i] == "folder" {
+				lruOrder[i] = "renamed"
+			}
+		}
+		assertEqual(t, lruOrder, getLRUOrder(cache))
+		assertEqual(t, int32(5), stats.amount.Load())
+
+		// Nodes can still be added under the renamed node.
+		assertNoError(t, cache.Add("file3", 5, "renamed"))
+		assertErrorIs(t, cache.Add("file4", 6, "folder"), ErrParentNotExist)
+	})
+
+	t.Run("root", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Rename("root", "new-root"))
+		assertEqual(t, []CacheNode[string, int]{{Key: "new-root", Value: 0}}, cache.Roots())
+		assertEqual(t, CacheNode[string, int]{Key: "a", Value: 1, ParentKey: "new-root"}, cache.PeekBranch("a")[1])
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Add("b", 2, "root"))
+		assertErrorIs(t, cache.Rename("nonexistent", "c"), ErrNodeNotExist)
+		assertErrorIs(t, cache.Rename("a", "b"), ErrAlreadyExists)
+		assertNoError(t, cache.Rename("a", "a"))
+	})
+
+	t.Run("cost is recalculated", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, int](0,
+			WithMaxCost[string, int](10),
+			WithCostFunc(func(key string, val int) int64 { return int64(len(key)) }),
+			WithOnEvict(func(node CacheNode[string, int]) {
+				evicted = append(evicted, node.Key)
+			}),
+		)
+		assertNoError(t, cache.AddRoot("r", 0))
+		assertNoError(t, cache.Add("aa", 1, "r"))
+		assertNoError(t, cache.Add("bb", 2, "r"))
+		assertEqual(t, int64(5), cache.Cost())
+		assertNoError(t, cache.Rename("bb", "bbbbbbbb"))
+		assertEqual(t, []string{"aa"}, evicted)
+		assertEqual(t, int64(9), cache.Cost())
+	})
+
+	t.Run("eviction policy", func(t *testing.T) {
+		cache := NewCache[string, int](3, WithEvictionPolicy[string, int](NewLFUPolicy[string]))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Rename("a", "b"))
+		assertNoError(t, cache.Add("c", 2, "root"))
+		assertNoError(t, cache.Add("d", 3, "root"))
+		assertEqual(t, 3, cache.Len())
+	})
+}
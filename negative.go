@@ -0,0 +1,132 @@
+package lrutree
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrKnownAbsent is returned by GetOrLoad when the node is known to be absent (see AddNegative),
+// so the loader is not called.
+var ErrKnownAbsent = errors.New("node is known to be absent")
+
+// LookupStatus is the result of Lookup.
+type LookupStatus int
+
+const (
+	// LookupMiss means that nothing is known about the node.
+	LookupMiss LookupStatus = iota
+
+	// LookupHit means that the node is present in the cache.
+	LookupHit
+
+	// LookupAbsent means that the node is known to be absent under its parent (see AddNegative).
+	LookupAbsent
+)
+
+// AddNegative records that the node with the given key doesn't exist under the parent
+// (e.g. a lookup in the underlying data source found nothing), so repeated lookups don't have to go there.
+//
+// The record is a lightweight tombstone: it has no value, it's not visible to other methods,
+// and it doesn't count in Len and Cost, but it takes a place in the LRU list and counts against
+// the maximum number of entries, so it may be evicted like a leaf child of the parent
+// (only when the number of entries is exceeded, since evicting it doesn't reduce the cost).
+// It's also removed when it expires after the given TTL (a non-positive TTL means that it never expires),
+// when the parent is removed, when Remove is called for the key, and when a real node with the key is added.
+// Adding a tombstone for the key that already has one replaces it.
+//
+// The parent and its ancestors are marked as recently used.
+// If the parent doesn't exist, ErrParentNotExist is returned.
+// If the node with the given key exists, ErrAlreadyExists is returned.
+func (c *Cache[K, V]) AddNegative(key K, parentKey K, ttl time.Duration) error {
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	parent, parentExists := c.keysMap[parentKey]
+	if !parentExists || c.reapIfExpired(parent, now, &evictedNodes) {
+		return ErrParentNotExist
+	}
+	if existingNode, exists := c.keysMap[key]; exists && !c.reapIfExpired(existingNode, now, &evictedNodes) {
+		return ErrAlreadyExists
+	}
+	if negNode, exists := c.negatives[key]; exists {
+		c.deleteNegative(negNode)
+	}
+
+	negNode := &treeNode[K, V]{key: key, parent: parent, absent: true}
+	if parent.absentChildren == nil {
+		parent.absentChildren = make(map[K]*treeNode[K, V])
+	}
+	parent.absentChildren[key] = negNode
+	c.negatives[key] = negNode
+	c.setExpiresAt(negNode, expirationTime(now, ttl))
+	negNode.lruElem = c.lruList.PushFront(negNode)
+	if c.policy != nil {
+		c.policy.OnInsert(key)
+	}
+
+	for n := parent; n != nil; n = n.parent {
+		c.promote(n)
+	}
+
+	c.evictIfNeeded(&evictedNodes, nil)
+
+	c.reportAmount()
+
+	return nil
+}
+
+// Lookup works like Get, but also reports whether the missing node is known to be absent (see AddNegative).
+//
+// For a known absent node, LookupAbsent is returned with the CacheNode that has only Key and ParentKey set.
+// The tombstone, its parent and ancestors are marked as recently used then. Stats count it as a miss.
+func (c *Cache[K, V]) Lookup(key K) (CacheNode[K, V], LookupStatus) {
+	if cacheNode, ok := c.Get(key); ok {
+		return cacheNode, LookupHit
+	}
+	if cacheNode, ok := c.getNegative(key); ok {
+		return cacheNode, LookupAbsent
+	}
+	return CacheNode[K, V]{}, LookupMiss
+}
+
+func (c *Cache[K, V]) getNegative(key K) (CacheNode[K, V], bool) {
+	var reapedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(reapedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	negNode, exists := c.negatives[key]
+	if !exists {
+		return CacheNode[K, V]{}, false
+	}
+	now := c.now()
+	if negNode.isExpired(now) {
+		c.deleteNegative(negNode)
+		return CacheNode[K, V]{}, false
+	}
+	if c.reapIfExpired(negNode.parent, now, &reapedNodes) { // The tombstone is removed along with the parent.
+		return CacheNode[K, V]{}, false
+	}
+
+	for n := negNode; n != nil; n = n.parent {
+		c.promote(n)
+	}
+
+	return CacheNode[K, V]{Key: key, ParentKey: negNode.parent.key}, true
+}
+
+// deleteNegative removes the tombstone from the cache.
+func (c *Cache[K, V]) deleteNegative(negNode *treeNode[K, V]) {
+	delete(c.negatives, negNode.key)
+	delete(negNode.parent.absentChildren, negNode.key)
+	c.lruList.Remove(negNode.lruElem)
+	if c.policy != nil {
+		c.policy.OnRemove(negNode.key)
+	}
+}
@@ -0,0 +1,175 @@
+package lrutree
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCache_AddNegative(t *testing.T) {
+	newCache := func(maxEntries int, options ...CacheOption[string, int]) *Cache[string, int] {
+		cache := NewCache[string, int](maxEntries, options...)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("dir", 1, "root"))
+		assertNoError(t, cache.Add("file", 2, "dir"))
+		return cache
+	}
+
+	t.Run("lookup", func(t *testing.T) {
+		stats := &Stats{}
+		cache := newCache(10, WithStatsCollector[string, int](stats))
+		assertNoError(t, cache.AddNegative("typo", "dir", 0))
+
+		cacheNode, status := cache.Lookup("typo")
+		assertEqual(t, LookupAbsent, status)
+		assertEqual(t, CacheNode[string, int]{Key: "typo", ParentKey: "dir"}, cacheNode)
+		cacheNode, status = cache.Lookup("file")
+		assertEqual(t, LookupHit, status)
+		assertEqual(t, CacheNode[string, int]{Key: "file", Value: 2, ParentKey: "dir"}, cacheNode)
+		_, status = cache.Lookup("unknown")
+		assertEqual(t, LookupMiss, status)
+
+		// Tombstones are not visible to other methods.
+		_, ok := cache.Get("typo")
+		assertFalse(t, ok)
+		_, ok = cache.Peek("typo")
+		assertFalse(t, ok)
+		assertEqual(t, 0, len(cache.PeekBranch("typo")))
+		assertEqual(t, 3, cache.Len())
+		assertEqual(t, int64(3), cache.Cost())
+		for key := range cache.ByRecency() {
+			assertTrue(t, key != "typo")
+		}
+		assertErrorIs(t, cache.Add("child", 3, "typo"), ErrParentNotExist)
+
+		snapshot := stats.Snapshot()
+		assertEqual(t, uint64(1), snapshot.Hits)
+		assertEqual(t, uint64(5), snapshot.Misses)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cache := newCache(10)
+		assertErrorIs(t, cache.AddNegative("typo", "nonexistent", 0), ErrParentNotExist)
+		assertErrorIs(t, cache.AddNegative("file", "dir", 0), ErrAlreadyExists)
+		assertErrorIs(t, cache.AddNegative("file", "root", 0), ErrAlreadyExists)
+	})
+
+	t.Run("cleared when node is added", func(t *testing.T) {
+		cache := newCache(10)
+		assertNoError(t, cache.AddNegative("new", "dir", 0))
+		assertNoError(t, cache.Add("new", 3, "root"))
+		cacheNode, status := cache.Lookup("new")
+		assertEqual(t, LookupHit, status)
+		assertEqual(t, "root", cacheNode.ParentKey)
+
+		assertNoError(t, cache.AddNegative("renamed", "dir", 0))
+		assertNoError(t, cache.Rename("new", "renamed"))
+		_, status = cache.Lookup("renamed")
+		assertEqual(t, LookupHit, status)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("replaced", func(t *testing.T) {
+		cache := newCache(10)
+		assertNoError(t, cache.AddNegative("typo", "dir", 0))
+		assertNoError(t, cache.AddNegative("typo", "root", 0))
+		cacheNode, status := cache.Lookup("typo")
+		assertEqual(t, LookupAbsent, status)
+		assertEqual(t, "root", cacheNode.ParentKey)
+		assertEqual(t, 4, cache.lruList.Len())
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		cache := newCache(10)
+		assertNoError(t, cache.AddNegative("typo1", "dir", 0))
+		assertNoError(t, cache.AddNegative("typo2", "dir", 0))
+		assertEqual(t, 0, cache.Remove("typo1"))
+		_, status := cache.Lookup("typo1")
+		assertEqual(t, LookupMiss, status)
+
+		// Tombstones are removed along with their parent.
+		assertEqual(t, 2, cache.Remove("dir"))
+		_, status = cache.Lookup("typo2")
+		assertEqual(t, LookupMiss, status)
+		assertEqual(t, 1, cache.lruList.Len())
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		now := time.Now()
+		cache := newCache(10, WithJanitor[string, int](time.Hour)) // The janitor is run manually.
+		defer cache.Close()
+		cache.now = func() time.Time { return now }
+		assertNoError(t, cache.AddNegative("typo1", "dir", time.Minute))
+		assertNoError(t, cache.AddNegative("typo2", "dir", time.Minute))
+		assertNoError(t, cache.AddNegative("typo3", "dir", 2*time.Minute))
+		now = now.Add(time.Minute)
+
+		_, status := cache.Lookup("typo1")
+		assertEqual(t, LookupMiss, status)
+		assertEqual(t, 5, cache.lruList.Len())
+		cache.reapExpired()
+		assertEqual(t, 4, cache.lruList.Len())
+		_, status = cache.Lookup("typo3")
+		assertEqual(t, LookupAbsent, status)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("evicted", func(t *testing.T) {
+		cache := newCache(5)
+		assertNoError(t, cache.AddNegative("typo1", "dir", 0))
+		assertNoError(t, cache.AddNegative("typo2", "dir", 0))
+		cache.Get("file")
+		cache.Lookup("typo1")
+		assertNoError(t, cache.Add("other", 3, "root"))
+
+		// The least recently used entry is the tombstone, and it's evicted silently.
+		_, status := cache.Lookup("typo2")
+		assertEqual(t, LookupMiss, status)
+		_, status = cache.Lookup("typo1")
+		assertEqual(t, LookupAbsent, status)
+		assertEqual(t, 4, cache.Len())
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("kept when only cost is exceeded", func(t *testing.T) {
+		cache := newCache(10, WithMaxCost[string, int](3), WithCostFunc(func(key string, val int) int64 {
+			return int64(val)
+		}))
+		assertNoError(t, cache.AddNegative("typo", "dir", 0))
+		cache.Get("file")
+		assertNoError(t, cache.Add("other", 1, "root"))
+
+		// The tombstone is the least recently used entry, but evicting it wouldn't reduce the cost.
+		_, status := cache.Lookup("typo")
+		assertEqual(t, LookupAbsent, status)
+		_, ok := cache.Peek("file")
+		assertFalse(t, ok)
+		assertEqual(t, int64(2), cache.Cost())
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("not persisted in snapshot", func(t *testing.T) {
+		cache := newCache(10)
+		assertNoError(t, cache.AddNegative("typo", "dir", 0))
+		var buf bytes.Buffer
+		assertNoError(t, cache.WriteSnapshot(&buf, GobCodec{}))
+		restored, err := RestoreCache[string, int](&buf, GobCodec{}, 10)
+		assertNoError(t, err)
+		assertEqual(t, 3, restored.Len())
+		_, status := restored.Lookup("typo")
+		assertEqual(t, LookupMiss, status)
+	})
+
+	t.Run("GetOrLoad", func(t *testing.T) {
+		loader := newMockLoader()
+		cache := NewCache[string, int](10, WithLoader[string, int](loader))
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.AddNegative("nonexistent", "root", 0))
+		_, err := cache.GetOrLoad(context.Background(), "nonexistent")
+		assertErrorIs(t, err, ErrKnownAbsent)
+		assertEqual(t, int32(0), loader.calls.Load())
+	})
+}
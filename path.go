@@ -0,0 +1,176 @@
+package lrutree
+
+// AddPath inserts the node addressed by the path of keys from the root (index 0) to the node itself (last index),
+// creating missing intermediate nodes on the way, so the caller doesn't have to add the path level by level.
+//
+// The node itself gets leafVal, and values of missing intermediate nodes are provided by the fill callback,
+// which receives the path prefix from the root to the node being created (the slice must not be retained).
+// If fill is nil, intermediate nodes get the zero value. Existing intermediate nodes are kept as is.
+// If the cache has no root yet, the root node is created as well (a new root of a separate tree if WithMultipleRoots is used).
+//
+// If the path is empty or contains duplicate keys, ErrInvalidBranch is returned.
+// If the first key is not the root and another root already exists, ErrRootAlreadyExists is returned.
+// If the node itself or any node of the path exists in the cache under another parent, ErrAlreadyExists is returned.
+// Validation is done before any changes (expired nodes are treated as missing, but not reaped),
+// so on error the cache is left unmodified.
+//
+// fill is called without holding the lock after the path is validated, so it may call methods of the cache
+// (e.g. to load values from elsewhere). If nodes of the path are removed concurrently, it's called for them as well,
+// and if they are added concurrently, values returned for them are discarded.
+//
+// All nodes of the path are marked as recently used, and new nodes expire after the default TTL set by WithTTL, if any.
+// Like in AddBranch, eviction happens once after the whole path is inserted and never evicts the nodes of the path.
+func (c *Cache[K, V]) AddPath(path []K, leafVal V, fill func(prefix []K) V) error {
+	defer c.observe(OpAddPath)()
+
+	if len(path) == 0 {
+		return ErrInvalidBranch
+	}
+	pathKeys := make(map[K]struct{}, len(path))
+	for _, key := range path {
+		if _, exists := pathKeys[key]; exists {
+			return ErrInvalidBranch
+		}
+		pathKeys[key] = struct{}{}
+	}
+
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
+
+	// Values of intermediate nodes are computed without holding the lock, so the path is validated again
+	// after fill is called, until values of all missing nodes are known.
+	values := make([]V, len(path))
+	values[len(path)-1] = leafVal
+	filledFrom := len(path) - 1 // Values of nodes starting from this index are known.
+	var existingCount int
+	for {
+		c.mu.Lock()
+		var err error
+		if existingCount, err = c.checkPath(path); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+		if fill == nil || existingCount >= filledFrom {
+			break
+		}
+		c.mu.Unlock()
+		for i := existingCount; i < filledFrom; i++ {
+			values[i] = fill(path[: i+1 : i+1])
+		}
+		filledFrom = existingCount
+	}
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	var parent *treeNode[K, V]
+	if existingCount != 0 {
+		parent = c.keysMap[path[existingCount-1]]
+	}
+	protected := make(map[*treeNode[K, V]]struct{}, len(path))
+	for n := parent; n != nil; n = n.parent {
+		protected[n] = struct{}{}
+	}
+	for i := existingCount; i < len(path); i++ {
+		// Missing nodes may still be present in the cache as expired ones.
+		if node, exists := c.keysMap[path[i]]; exists {
+			c.reapIfExpired(node, now, &evictedNodes)
+		}
+		node := c.insertNode(path[i], values[i], parent)
+		if parent != nil {
+			c.setExpiration(node, expirationTime(now, c.defaultTTL))
+		}
+		protected[node] = struct{}{}
+		parent = node
+	}
+
+	for n := parent; n != nil; n = n.parent {
+		c.promote(n)
+	}
+
+	c.evictIfNeeded(&evictedNodes, protected)
+
+	c.reportInserts(len(path) - existingCount)
+	c.reportAmount()
+
+	return nil
+}
+
+// checkPath validates the path for AddPath against the cache state and returns the number of nodes
+// at the beginning of the path that are present in the cache. Expired nodes are treated as missing.
+// It must be called under the lock.
+func (c *Cache[K, V]) checkPath(path []K) (int, error) {
+	// Resolve the longest prefix of the path that is present in the cache.
+	var parent *treeNode[K, V]
+	existingCount := 0
+	for ; existingCount < len(path); existingCount++ {
+		node := c.peekNode(path[existingCount])
+		if node == nil {
+			break
+		}
+		if node.parent != parent {
+			return 0, ErrAlreadyExists
+		}
+		parent = node
+	}
+	if existingCount == len(path) {
+		return 0, ErrAlreadyExists
+	}
+	if existingCount == 0 && !c.multipleRoots && len(c.roots) != 0 {
+		return 0, ErrRootAlreadyExists
+	}
+	// The rest of the path must be new.
+	for _, key := range path[existingCount+1:] {
+		if c.peekNode(key) != nil {
+			return 0, ErrAlreadyExists
+		}
+	}
+	return existingCount, nil
+}
+
+// GetPath retrieves the node addressed by the path of keys from the root (index 0) to the node itself (last index).
+//
+// The node is resolved by walking down from the root through the children of each node of the path,
+// so it's found only if the structure of the cache matches the path: a node with the last key
+// that exists under another parent is not returned.
+// Like Get, it marks the node and all its ancestors as recently used.
+func (c *Cache[K, V]) GetPath(path []K) (CacheNode[K, V], bool) {
+	defer c.observe(OpGetPath)()
+
+	var reapedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(reapedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node := c.resolvePath(path)
+	if node != nil && c.reapIfExpired(node, c.now(), &reapedNodes) {
+		node = nil
+	}
+	if node == nil {
+		c.stats.IncMisses()
+		return CacheNode[K, V]{}, false
+	}
+
+	for n := node; n != nil; n = n.parent {
+		c.promote(n)
+	}
+
+	c.stats.IncHits()
+	return node.toCacheNode(), true
+}
+
+// resolvePath walks down from the root along the path and returns the node it addresses, or nil if there is no such node.
+func (c *Cache[K, V]) resolvePath(path []K) *treeNode[K, V] {
+	if len(path) == 0 {
+		return nil
+	}
+	node := c.roots[path[0]]
+	for _, key := range path[1:] {
+		if node == nil {
+			return nil
+		}
+		node = node.children[key]
+	}
+	return node
+}
@@ -0,0 +1,194 @@
+package lrutree
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache_AddPath(t *testing.T) {
+	fillPath := func(prefix []string) int {
+		return len(prefix)
+	}
+
+	t.Run("creates missing ancestors", func(t *testing.T) {
+		var filled []string
+		fill := func(prefix []string) int {
+			filled = append(filled, strings.Join(prefix, "/"))
+			return len(prefix)
+		}
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddPath([]string{"org", "eng", "frontend"}, 100, fill))
+		assertEqual(t, []string{"org", "org/eng"}, filled)
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "org", Value: 1},
+			{Key: "eng", Value: 2, ParentKey: "org"},
+			{Key: "frontend", Value: 100, ParentKey: "eng"},
+		}, cache.PeekBranch("frontend"))
+
+		// Existing ancestors are kept as is.
+		filled = nil
+		assertNoError(t, cache.AddPath([]string{"org", "eng", "backend", "api"}, 200, fill))
+		assertEqual(t, []string{"org/eng/backend"}, filled)
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "org", Value: 1},
+			{Key: "eng", Value: 2, ParentKey: "org"},
+			{Key: "backend", Value: 3, ParentKey: "eng"},
+			{Key: "api", Value: 200, ParentKey: "backend"},
+		}, cache.PeekBranch("api"))
+		assertEqual(t, []string{"org", "eng", "backend", "api", "frontend"}, getLRUOrder(cache))
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("nil fill", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("org", 1))
+		assertNoError(t, cache.AddPath([]string{"org", "eng", "frontend"}, 100, nil))
+		node, _ := cache.Peek("eng")
+		assertEqual(t, 0, node.Value)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddPath([]string{"org", "eng", "frontend"}, 100, fillPath))
+		assertNoError(t, cache.Add("sales", 4, "org"))
+
+		assertErrorIs(t, cache.AddPath(nil, 0, fillPath), ErrInvalidBranch)
+		assertErrorIs(t, cache.AddPath([]string{"org", "eng", "org"}, 0, fillPath), ErrInvalidBranch)
+		assertErrorIs(t, cache.AddPath([]string{"other", "eng"}, 0, fillPath), ErrRootAlreadyExists)
+		assertErrorIs(t, cache.AddPath([]string{"eng", "backend"}, 0, fillPath), ErrAlreadyExists)
+		assertErrorIs(t, cache.AddPath([]string{"org", "eng", "frontend"}, 0, fillPath), ErrAlreadyExists)
+		assertErrorIs(t, cache.AddPath([]string{"org", "sales", "frontend"}, 0, fillPath), ErrAlreadyExists)
+		assertErrorIs(t, cache.AddPath([]string{"org", "new", "frontend"}, 0, func([]string) int {
+			t.Fatal("fill must not be called")
+			return 0
+		}), ErrAlreadyExists)
+		assertEqual(t, 4, cache.Len())
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("fill may use the cache", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("org", 1))
+		assertNoError(t, cache.AddPath([]string{"org", "eng", "frontend"}, 100, func(prefix []string) int {
+			parent, _ := cache.Peek(prefix[len(prefix)-2])
+			return parent.Value + 1
+		}))
+		node, _ := cache.Peek("eng")
+		assertEqual(t, 2, node.Value)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("nodes removed during fill are filled again", func(t *testing.T) {
+		var filled []string
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("org", 1))
+		assertNoError(t, cache.AddPath([]string{"org", "eng", "frontend"}, 100, func(prefix []string) int {
+			filled = append(filled, strings.Join(prefix, "/"))
+			if len(filled) == 1 {
+				cache.Remove("org")
+			}
+			return len(prefix)
+		}))
+		assertEqual(t, []string{"org/eng", "org"}, filled)
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "org", Value: 1},
+			{Key: "eng", Value: 2, ParentKey: "org"},
+			{Key: "frontend", Value: 100, ParentKey: "eng"},
+		}, cache.PeekBranch("frontend"))
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("path changed during fill", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("org", 1))
+		assertErrorIs(t, cache.AddPath([]string{"org", "eng", "frontend"}, 100, func(prefix []string) int {
+			assertNoError(t, cache.Add("frontend", 0, "org"))
+			return len(prefix)
+		}), ErrAlreadyExists)
+		assertEqual(t, 2, cache.Len())
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("expired nodes are not reaped on validation error", func(t *testing.T) {
+		now := time.Now()
+		cache := NewCache[string, int](10)
+		cache.now = func() time.Time { return now }
+		assertNoError(t, cache.AddRoot("org", 1))
+		assertNoError(t, cache.AddWithTTL("eng", 2, "org", time.Minute))
+		assertNoError(t, cache.Add("sales", 3, "org"))
+		now = now.Add(time.Minute)
+		assertErrorIs(t, cache.AddPath([]string{"org", "eng", "sales"}, 0, fillPath), ErrAlreadyExists)
+		assertEqual(t, 3, cache.Len())
+
+		// Expired nodes are replaced on success.
+		assertNoError(t, cache.AddPath([]string{"org", "eng", "frontend"}, 100, func([]string) int { return 20 }))
+		node, _ := cache.Peek("eng")
+		assertEqual(t, 20, node.Value)
+		assertEqual(t, 4, cache.Len())
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("path is not evicted", func(t *testing.T) {
+		cache := NewCache[string, int](4)
+		assertNoError(t, cache.AddPath([]string{"org", "sales"}, 1, fillPath))
+		assertNoError(t, cache.AddPath([]string{"org", "eng", "backend", "api"}, 2, fillPath))
+		assertEqual(t, 4, cache.Len())
+		_, ok := cache.Peek("sales")
+		assertFalse(t, ok)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("new nodes expire", func(t *testing.T) {
+		now := time.Now()
+		cache := NewCache[string, int](10, WithTTL[string, int](time.Minute))
+		cache.now = func() time.Time { return now }
+		assertNoError(t, cache.AddPath([]string{"org", "eng", "frontend"}, 100, fillPath))
+		now = now.Add(time.Minute)
+		_, ok := cache.GetPath([]string{"org", "eng"})
+		assertFalse(t, ok)
+		_, ok = cache.GetPath([]string{"org"})
+		assertTrue(t, ok)
+	})
+
+	t.Run("multiple roots", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithMultipleRoots[string, int]())
+		assertNoError(t, cache.AddPath([]string{"tenant-1", "eng"}, 1, fillPath))
+		assertNoError(t, cache.AddPath([]string{"tenant-2", "sales"}, 2, fillPath))
+		_, ok := cache.GetPath([]string{"tenant-2", "sales"})
+		assertTrue(t, ok)
+		assertErrorIs(t, cache.AddPath([]string{"tenant-3", "eng"}, 3, fillPath), ErrAlreadyExists)
+	})
+}
+
+func TestCache_GetPath(t *testing.T) {
+	stats := &Stats{}
+	cache := NewCache[string, int](10, WithStatsCollector[string, int](stats))
+	assertNoError(t, cache.AddPath([]string{"org", "eng", "frontend"}, 100, nil))
+	assertNoError(t, cache.Add("sales", 4, "org"))
+
+	cacheNode, ok := cache.GetPath([]string{"org", "eng", "frontend"})
+	assertTrue(t, ok)
+	assertEqual(t, CacheNode[string, int]{Key: "frontend", Value: 100, ParentKey: "eng"}, cacheNode)
+	assertEqual(t, []string{"org", "eng", "frontend", "sales"}, getLRUOrder(cache))
+
+	cacheNode, ok = cache.GetPath([]string{"org"})
+	assertTrue(t, ok)
+	assertEqual(t, CacheNode[string, int]{Key: "org"}, cacheNode)
+
+	// The structure of the cache doesn't match the path.
+	for _, path := range [][]string{
+		nil,
+		{"eng", "frontend"},
+		{"org", "frontend"},
+		{"org", "sales", "frontend"},
+		{"org", "eng", "frontend", "nonexistent"},
+	} {
+		_, ok = cache.GetPath(path)
+		assertFalse(t, ok)
+	}
+
+	snapshot := stats.Snapshot()
+	assertEqual(t, uint64(2), snapshot.Hits)
+	assertEqual(t, uint64(5), snapshot.Misses)
+}
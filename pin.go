@@ -0,0 +1,116 @@
+package lrutree
+
+import (
+	"errors"
+)
+
+// ErrCapacityExhausted is returned when a node can't be added because it doesn't fit the capacity of the cache:
+// the capacity is exhausted by pinned nodes (and their ancestors), so nothing else can be evicted to make room for it,
+// or the cost of the node alone exceeds the maximum cost (see WithMaxCost).
+var ErrCapacityExhausted = errors.New("capacity is exhausted")
+
+// WithPinnedOverflow allows the cache to exceed its capacity when it's exhausted by pinned nodes.
+// New nodes are added anyway instead of failing with ErrCapacityExhausted,
+// and the excess is evicted as soon as nodes are unpinned.
+func WithPinnedOverflow[K comparable, V any]() CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.pinnedOverflow = true
+	}
+}
+
+// Pin marks the node as pinned, so it's never evicted because of the capacity limit.
+// Ancestors of a pinned node are implicitly protected too, since only leaves are evicted.
+// Pinned nodes are still removed by Remove and when they expire.
+// It returns false if the node doesn't exist.
+func (c *Cache[K, V]) Pin(key K) bool {
+	var reapedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(reapedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node, exists := c.keysMap[key]
+	if !exists || c.reapIfExpired(node, c.now(), &reapedNodes) {
+		return false
+	}
+	c.setPinned(node, true)
+	return true
+}
+
+// Unpin removes the pin from the node, so it may be evicted again.
+// If the cache exceeds its capacity (see WithPinnedOverflow), nodes are evicted until it fits.
+// It returns false if the node doesn't exist.
+func (c *Cache[K, V]) Unpin(key K) bool {
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node, exists := c.keysMap[key]
+	if !exists || c.reapIfExpired(node, c.now(), &evictedNodes) {
+		return false
+	}
+	c.setPinned(node, false)
+
+	c.evictIfNeeded(&evictedNodes, nil)
+
+	c.reportAmount()
+
+	return true
+}
+
+// AddPinned works like Add, but the node is pinned right away (see Pin), so it's not evicted
+// even if the cache is over capacity after adding it.
+// ErrCapacityExhausted is returned if the cache can't fit the node because of other pinned nodes
+// (unless WithPinnedOverflow is used).
+func (c *Cache[K, V]) AddPinned(key K, val V, parentKey K) error {
+	return c.add(key, val, parentKey, c.defaultTTL, true)
+}
+
+func (c *Cache[K, V]) setPinned(node *treeNode[K, V], pinned bool) {
+	if node.pinned == pinned {
+		return
+	}
+	node.pinned = pinned
+	if pinned {
+		c.pinnedCount++
+	} else {
+		c.pinnedCount--
+	}
+}
+
+// evictToFit evicts nodes until the cache fits its capacity after the node was added or updated.
+// If the cache has pinned nodes, the node itself is not evicted, and ErrCapacityExhausted is returned
+// if the cache still doesn't fit because of pinned nodes (unless WithPinnedOverflow is used).
+// If the node doesn't fit regardless of pins (its branch alone exceeds the capacity),
+// it's evicted like in a cache without pinned nodes.
+func (c *Cache[K, V]) evictToFit(node *treeNode[K, V], evicted *[]removedNode[K, V]) error {
+	if c.pinnedCount == 0 {
+		c.evictIfNeeded(evicted, nil)
+		return nil
+	}
+	c.evictIfNeeded(evicted, map[*treeNode[K, V]]struct{}{node: {}})
+	if !c.overCapacity() || c.pinnedOverflow {
+		return nil
+	}
+	if !node.pinned && c.branchExceedsCapacity(node) {
+		c.evictIfNeeded(evicted, nil)
+		return nil
+	}
+	return ErrCapacityExhausted
+}
+
+// branchExceedsCapacity reports whether the node doesn't fit the capacity even if all other nodes are evicted,
+// since neither the node's ancestors nor roots of other trees can be evicted to make room for it.
+func (c *Cache[K, V]) branchExceedsCapacity(node *treeNode[K, V]) bool {
+	entries, cost := len(c.roots), int64(0)
+	for _, root := range c.roots {
+		cost += root.cost
+	}
+	for n := node; n.parent != nil; n = n.parent {
+		entries++
+		cost += n.cost
+	}
+	return (c.maxEntries > 0 && entries > c.maxEntries) || (c.maxCost > 0 && cost > c.maxCost)
+}
@@ -0,0 +1,167 @@
+package lrutree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCache_Pin(t *testing.T) {
+	t.Run("pinned leaves and their ancestors are not evicted", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, int](4, WithOnEvict(func(node CacheNode[string, int]) {
+			evicted = append(evicted, node.Key)
+		}))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("tenant", 1, "root"))
+		assertNoError(t, cache.Add("everyone", 2, "tenant"))
+		assertNoError(t, cache.Add("child1", 3, "root"))
+		assertTrue(t, cache.Pin("everyone"))
+		assertFalse(t, cache.Pin("nonexistent"))
+
+		// "everyone" is the least recently used leaf, but it's pinned.
+		assertNoError(t, cache.Add("child2", 4, "root"))
+		assertEqual(t, []string{"child1"}, evicted)
+		assertNoError(t, cache.Add("child3", 5, "root"))
+		assertEqual(t, []string{"child1", "child2"}, evicted)
+		assertEqual(t, []string{"root", "child3", "tenant", "everyone"}, getLRUOrder(cache))
+
+		// After unpinning, the node may be evicted again.
+		assertTrue(t, cache.Unpin("everyone"))
+		assertFalse(t, cache.Unpin("nonexistent"))
+		assertNoError(t, cache.Add("child4", 6, "root"))
+		assertEqual(t, []string{"child1", "child2", "everyone"}, evicted)
+	})
+
+	t.Run("AddPinned", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, int](3, WithOnEvict(func(node CacheNode[string, int]) {
+			evicted = append(evicted, node.Key)
+		}))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.AddPinned("pinned", 1, "root"))
+		assertNoError(t, cache.Add("child1", 2, "root"))
+		assertNoError(t, cache.Add("child2", 3, "root"))
+		assertEqual(t, []string{"child1"}, evicted)
+		assertErrorIs(t, cache.AddPinned("pinned", 1, "root"), ErrAlreadyExists)
+		assertErrorIs(t, cache.AddPinned("child3", 1, "nonexistent"), ErrParentNotExist)
+	})
+
+	t.Run("capacity exhausted by pinned nodes", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, int](3, WithOnEvict(func(node CacheNode[string, int]) {
+			evicted = append(evicted, node.Key)
+		}))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.AddPinned("pinned1", 1, "root"))
+		assertNoError(t, cache.Add("child", 2, "root"))
+		assertNoError(t, cache.AddPinned("pinned2", 3, "root"))
+		assertEqual(t, []string{"child"}, evicted)
+
+		assertErrorIs(t, cache.Add("child", 4, "root"), ErrCapacityExhausted)
+		assertErrorIs(t, cache.AddPinned("pinned3", 5, "root"), ErrCapacityExhausted)
+		assertErrorIs(t, cache.AddOrUpdate("child", 4, "root"), ErrCapacityExhausted)
+		assertEqual(t, []string{"root", "pinned2", "pinned1"}, getLRUOrder(cache))
+		assertEqual(t, 3, cache.Len())
+
+		// Updating an existing node is allowed.
+		assertNoError(t, cache.AddOrUpdate("pinned1", 10, "root"))
+
+		// Removing a pinned node makes room for new nodes.
+		assertEqual(t, 1, cache.Remove("pinned2"))
+		assertNoError(t, cache.Add("child", 4, "root"))
+	})
+
+	t.Run("branch exceeding capacity regardless of pinned nodes", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, int](3, WithOnEvict(func(node CacheNode[string, int]) {
+			evicted = append(evicted, node.Key)
+		}))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.AddPinned("a", 1, "root"))
+		assertNoError(t, cache.Add("b", 2, "a"))
+
+		// The new node doesn't fit because of its own ancestors, so it's evicted like without pinned nodes.
+		assertNoError(t, cache.Add("c", 3, "b"))
+		assertEqual(t, []string{"c"}, evicted)
+		assertEqual(t, []string{"root", "a", "b"}, getLRUOrder(cache))
+
+		// A pinned new node can't be evicted, so its pin exhausts the capacity.
+		assertErrorIs(t, cache.AddPinned("c", 3, "b"), ErrCapacityExhausted)
+		assertEqual(t, 3, cache.Len())
+	})
+
+	t.Run("overflow with pinned nodes", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, int](3,
+			WithPinnedOverflow[string, int](),
+			WithOnEvict(func(node CacheNode[string, int]) {
+				evicted = append(evicted, node.Key)
+			}),
+		)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.AddPinned("pinned1", 1, "root"))
+		assertNoError(t, cache.AddPinned("pinned2", 2, "root"))
+		assertNoError(t, cache.Add("child", 3, "root"))
+		assertEqual(t, 4, cache.Len())
+		assertNil(t, evicted)
+
+		// Unpinned nodes are still evicted first.
+		assertNoError(t, cache.AddPinned("pinned3", 4, "root"))
+		assertEqual(t, []string{"child"}, evicted)
+		assertEqual(t, 4, cache.Len())
+
+		// The excess is evicted when nodes are unpinned.
+		assertTrue(t, cache.Unpin("pinned1"))
+		assertEqual(t, []string{"child", "pinned1"}, evicted)
+		assertEqual(t, 3, cache.Len())
+	})
+
+	t.Run("pinned node is removed explicitly", func(t *testing.T) {
+		cache := NewCache[string, int](2)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.AddPinned("pinned", 1, "root"))
+		assertEqual(t, 1, cache.Remove("pinned"))
+		assertEqual(t, 0, cache.pinnedCount)
+		assertNoError(t, cache.Add("child1", 2, "root"))
+		assertNoError(t, cache.Add("child2", 3, "root"))
+		assertEqual(t, 2, cache.Len())
+	})
+
+	t.Run("pins are kept in snapshots", func(t *testing.T) {
+		cache := NewCache[string, int](3)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.AddPinned("pinned", 1, "root"))
+		assertNoError(t, cache.Add("child", 2, "root"))
+
+		var buf bytes.Buffer
+		assertNoError(t, cache.WriteSnapshot(&buf, GobCodec{}))
+		restored, err := RestoreCache[string, int](&buf, GobCodec{}, 3)
+		assertNoError(t, err)
+		assertEqual(t, 1, restored.pinnedCount)
+		assertNoError(t, restored.Add("child2", 3, "root"))
+		_, ok := restored.Peek("pinned")
+		assertTrue(t, ok)
+	})
+}
+
+func TestShardedCache_Pin(t *testing.T) {
+	cache := NewShardedCache[string, int](2, 4, WithShardFunc[string, int](func(topKey string) int {
+		if topKey == "a" {
+			return 0
+		}
+		return 1
+	}))
+	assertNoError(t, cache.AddRoot("root", 0))
+	assertNoError(t, cache.AddPinned("a", 1, "root"))
+	assertNoError(t, cache.Add("b", 2, "root"))
+	assertNoError(t, cache.Add("a1", 3, "a"))
+	assertTrue(t, cache.Pin("root"))
+	assertTrue(t, cache.Pin("a1"))
+	assertFalse(t, cache.Pin("nonexistent"))
+
+	// Reparenting to another shard keeps the pins.
+	assertNoError(t, cache.AddOrUpdate("a1", 3, "b"))
+	assertEqual(t, 2, cache.shards[1].pinnedCount) // The root node is pinned in every shard.
+	assertTrue(t, cache.Unpin("a1"))
+	assertTrue(t, cache.Unpin("root"))
+}
@@ -0,0 +1,364 @@
+package lrutree
+
+import (
+	"container/list"
+)
+
+// EvictionPolicy selects leaf nodes to evict when the cache exceeds its capacity.
+//
+// The cache notifies the policy about every insertion, access and removal of a node.
+// When a node is accessed, the policy is notified about accesses to all its ancestors too,
+// so ancestors are always at least as "hot" as their descendants.
+// Only nodes that may be evicted (leaves that are not the root and are not protected by the current operation)
+// may be returned as victims, so the tree invariants hold regardless of the policy.
+//
+// Methods are called under the cache lock, so implementations don't need to be thread-safe,
+// but a policy instance must not be shared between caches.
+type EvictionPolicy[K comparable] interface {
+	// OnInsert is called when a new node is added to the cache.
+	OnInsert(key K)
+
+	// OnAccess is called when the node is accessed (marked as recently used).
+	OnAccess(key K)
+
+	// OnRemove is called when the node is removed from the cache for any reason (eviction, expiration, removal).
+	OnRemove(key K)
+
+	// Victim returns the key of the node that should be evicted.
+	// Only keys for which evictable returns true may be returned. If there is no such key, ok is false.
+	Victim(evictable func(key K) bool) (key K, ok bool)
+}
+
+// WithEvictionPolicy sets the policy that selects nodes to evict.
+// The newPolicy function is called once per cache, so the same option may be used for several caches
+// (e.g. for shards of ShardedCache).
+// By default, the least recently used leaf is evicted (this is faster than any pluggable policy,
+// since the LRU list is maintained by the cache anyway).
+func WithEvictionPolicy[K comparable, V any](newPolicy func() EvictionPolicy[K]) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.policy = newPolicy()
+	}
+}
+
+// NewLFUPolicy returns a policy that evicts the least frequently used leaf.
+// Ties are broken by recency, so among leaves with the same frequency the least recently used one is evicted.
+// Frequencies are counted while the node is in the cache.
+func NewLFUPolicy[K comparable]() EvictionPolicy[K] {
+	return &lfuPolicy[K]{
+		buckets: list.New(),
+		entries: make(map[K]*lfuEntry[K]),
+	}
+}
+
+type lfuBucket[K comparable] struct {
+	freq    uint64
+	entries *list.List // Entries with the same frequency from the most to the least recently used.
+}
+
+type lfuEntry[K comparable] struct {
+	key    K
+	bucket *list.Element // Element of the buckets list.
+	elem   *list.Element // Element of the bucket's entries list.
+}
+
+// lfuPolicy keeps a list of frequency buckets in ascending order of frequency,
+// so every operation takes O(1) time.
+type lfuPolicy[K comparable] struct {
+	buckets *list.List
+	entries map[K]*lfuEntry[K]
+}
+
+func (p *lfuPolicy[K]) OnInsert(key K) {
+	front := p.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket[K]).freq != 1 {
+		front = p.buckets.PushFront(&lfuBucket[K]{freq: 1, entries: list.New()})
+	}
+	entry := &lfuEntry[K]{key: key, bucket: front}
+	entry.elem = front.Value.(*lfuBucket[K]).entries.PushFront(entry)
+	p.entries[key] = entry
+}
+
+func (p *lfuPolicy[K]) OnAccess(key K) {
+	entry, ok := p.entries[key]
+	if !ok {
+		return
+	}
+	cur := entry.bucket.Value.(*lfuBucket[K])
+	next := entry.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket[K]).freq != cur.freq+1 {
+		next = p.buckets.InsertAfter(&lfuBucket[K]{freq: cur.freq + 1, entries: list.New()}, entry.bucket)
+	}
+	p.unlink(entry)
+	entry.bucket = next
+	entry.elem = next.Value.(*lfuBucket[K]).entries.PushFront(entry)
+}
+
+func (p *lfuPolicy[K]) OnRemove(key K) {
+	if entry, ok := p.entries[key]; ok {
+		p.unlink(entry)
+		delete(p.entries, key)
+	}
+}
+
+func (p *lfuPolicy[K]) Victim(evictable func(key K) bool) (K, bool) {
+	for b := p.buckets.Front(); b != nil; b = b.Next() {
+		if key, ok := lastEvictable(b.Value.(*lfuBucket[K]).entries, evictable, lfuEntryKey[K]); ok {
+			return key, true
+		}
+	}
+	var zeroKey K
+	return zeroKey, false
+}
+
+// unlink removes the entry from its bucket and drops the bucket if it becomes empty.
+func (p *lfuPolicy[K]) unlink(entry *lfuEntry[K]) {
+	bucket := entry.bucket.Value.(*lfuBucket[K])
+	bucket.entries.Remove(entry.elem)
+	if bucket.entries.Len() == 0 {
+		p.buckets.Remove(entry.bucket)
+	}
+}
+
+func lfuEntryKey[K comparable](v any) K {
+	return v.(*lfuEntry[K]).key
+}
+
+const defaultSLRUProtectedRatio = 0.8
+
+// NewSLRUPolicy returns a segmented LRU policy.
+//
+// New nodes are put into the probation segment and move to the protected segment on the second access,
+// so nodes that are accessed only once (e.g. by a scan) don't flush frequently used nodes from the cache.
+// When a victim is selected, the protected segment is trimmed to protectedRatio of all nodes
+// (0.8 if the ratio is not in (0, 1)), and the least recently used protected nodes return to the probation segment.
+// Victims are selected from the probation segment first, in the LRU order.
+func NewSLRUPolicy[K comparable](protectedRatio float64) EvictionPolicy[K] {
+	return newSLRUPolicy[K](protectedRatio)
+}
+
+type slruSegment int
+
+const (
+	segmentProbation slruSegment = iota
+	segmentProtected
+	segmentWindow // Used by W-TinyLFU only.
+)
+
+type segmentEntry[K comparable] struct {
+	key     K
+	segment slruSegment
+}
+
+func segmentEntryKey[K comparable](v any) K {
+	return v.(*segmentEntry[K]).key
+}
+
+type slruPolicy[K comparable] struct {
+	protectedRatio float64
+	probation      *list.List
+	protected      *list.List
+	entries        map[K]*list.Element
+}
+
+func newSLRUPolicy[K comparable](protectedRatio float64) *slruPolicy[K] {
+	if protectedRatio <= 0 || protectedRatio >= 1 {
+		protectedRatio = defaultSLRUProtectedRatio
+	}
+	return &slruPolicy[K]{
+		protectedRatio: protectedRatio,
+		probation:      list.New(),
+		protected:      list.New(),
+		entries:        make(map[K]*list.Element),
+	}
+}
+
+func (p *slruPolicy[K]) OnInsert(key K) {
+	p.entries[key] = p.probation.PushFront(&segmentEntry[K]{key: key, segment: segmentProbation})
+}
+
+func (p *slruPolicy[K]) OnAccess(key K) {
+	elem, ok := p.entries[key]
+	if !ok {
+		return
+	}
+	entry := elem.Value.(*segmentEntry[K])
+	if entry.segment == segmentProtected {
+		p.protected.MoveToFront(elem)
+		return
+	}
+	p.probation.Remove(elem)
+	entry.segment = segmentProtected
+	p.entries[key] = p.protected.PushFront(entry)
+}
+
+func (p *slruPolicy[K]) OnRemove(key K) {
+	elem, ok := p.entries[key]
+	if !ok {
+		return
+	}
+	if elem.Value.(*segmentEntry[K]).segment == segmentProtected {
+		p.protected.Remove(elem)
+	} else {
+		p.probation.Remove(elem)
+	}
+	delete(p.entries, key)
+}
+
+func (p *slruPolicy[K]) Victim(evictable func(key K) bool) (K, bool) {
+	// The protected segment is trimmed only when a victim is needed, so its size is relative to the full cache.
+	maxProtected := int(float64(len(p.entries)) * p.protectedRatio)
+	for p.protected.Len() > maxProtected {
+		demoted := p.protected.Remove(p.protected.Back()).(*segmentEntry[K])
+		demoted.segment = segmentProbation
+		p.entries[demoted.key] = p.probation.PushFront(demoted)
+	}
+
+	if key, ok := lastEvictable(p.probation, evictable, segmentEntryKey[K]); ok {
+		return key, true
+	}
+	return lastEvictable(p.protected, evictable, segmentEntryKey[K])
+}
+
+const (
+	defaultTinyLFUWindowRatio = 0.01
+	tinyLFUMaxFreq            = 15
+	tinyLFUMinSampleSize      = 1024
+)
+
+// NewTinyLFUPolicy returns a W-TinyLFU policy.
+//
+// New nodes are put into a small LRU admission window that holds windowRatio of all nodes
+// (0.01 if the ratio is not in (0, 1), at least one node). The rest of the cache is managed by SLRU.
+// When a victim is needed, nodes over the window limit leave the window: the least frequently used leaf
+// among them competes with the SLRU victim, and the one with the lower access frequency (estimated over
+// the recent history, including evicted keys) is evicted, while the others are admitted to SLRU.
+// So rarely used nodes (e.g. visited by a scan) are rejected soon after insertion
+// instead of flushing frequently used ones.
+//
+// Access frequencies are kept in a map with small saturating counters that are halved periodically,
+// so old accesses are forgotten and the history size is bounded.
+func NewTinyLFUPolicy[K comparable](windowRatio float64) EvictionPolicy[K] {
+	if windowRatio <= 0 || windowRatio >= 1 {
+		windowRatio = defaultTinyLFUWindowRatio
+	}
+	return &tinyLFUPolicy[K]{
+		windowRatio: windowRatio,
+		window:      list.New(),
+		windowElems: make(map[K]*list.Element),
+		main:        newSLRUPolicy[K](defaultSLRUProtectedRatio),
+		freqs:       make(map[K]uint8),
+	}
+}
+
+type tinyLFUPolicy[K comparable] struct {
+	windowRatio float64
+	window      *list.List
+	windowElems map[K]*list.Element
+	main        *slruPolicy[K]
+	freqs       map[K]uint8
+	samples     int
+}
+
+func (p *tinyLFUPolicy[K]) OnInsert(key K) {
+	p.incFreq(key)
+	p.windowElems[key] = p.window.PushFront(&segmentEntry[K]{key: key, segment: segmentWindow})
+}
+
+func (p *tinyLFUPolicy[K]) OnAccess(key K) {
+	p.incFreq(key)
+	if elem, ok := p.windowElems[key]; ok {
+		p.window.MoveToFront(elem)
+		return
+	}
+	p.main.OnAccess(key)
+}
+
+func (p *tinyLFUPolicy[K]) OnRemove(key K) {
+	if elem, ok := p.windowElems[key]; ok {
+		p.window.Remove(elem)
+		delete(p.windowElems, key)
+		return
+	}
+	p.main.OnRemove(key)
+}
+
+func (p *tinyLFUPolicy[K]) Victim(evictable func(key K) bool) (K, bool) {
+	maxWindow := int(float64(len(p.windowElems)+len(p.main.entries)) * p.windowRatio)
+	if maxWindow < 1 {
+		maxWindow = 1
+	}
+
+	// Nodes over the window limit leave the window. The coldest leaf among them is the admission candidate,
+	// and all others (including inner nodes that are hot by definition) are admitted to SLRU.
+	var overflow []K
+	for elem := p.window.Back(); elem != nil && len(overflow) < p.window.Len()-maxWindow; elem = elem.Prev() {
+		overflow = append(overflow, elem.Value.(*segmentEntry[K]).key)
+	}
+	var candidate K
+	hasCandidate := false
+	for _, key := range overflow {
+		if evictable(key) && (!hasCandidate || p.freqs[key] < p.freqs[candidate]) {
+			candidate, hasCandidate = key, true
+		}
+	}
+	for _, key := range overflow {
+		if !hasCandidate || key != candidate {
+			p.admit(key)
+		}
+	}
+
+	victim, ok := p.main.Victim(evictable)
+	if hasCandidate {
+		// The candidate is admitted only if it's used more frequently than the SLRU victim.
+		if !ok || p.freqs[candidate] <= p.freqs[victim] {
+			return candidate, true
+		}
+		p.admit(candidate)
+	}
+	if ok {
+		return victim, true
+	}
+	return lastEvictable(p.window, evictable, segmentEntryKey[K])
+}
+
+// admit moves the key from the admission window to the probation segment of SLRU.
+func (p *tinyLFUPolicy[K]) admit(key K) {
+	p.window.Remove(p.windowElems[key])
+	delete(p.windowElems, key)
+	p.main.OnInsert(key)
+}
+
+// incFreq increments the access frequency of the key.
+// All frequencies are halved when the number of samples reaches the limit proportional to the cache size.
+func (p *tinyLFUPolicy[K]) incFreq(key K) {
+	if p.freqs[key] < tinyLFUMaxFreq {
+		p.freqs[key]++
+	}
+	p.samples++
+	sampleSize := 10 * (len(p.windowElems) + len(p.main.entries))
+	if sampleSize < tinyLFUMinSampleSize {
+		sampleSize = tinyLFUMinSampleSize
+	}
+	if p.samples < sampleSize {
+		return
+	}
+	for k, freq := range p.freqs {
+		if freq >>= 1; freq == 0 {
+			delete(p.freqs, k)
+		} else {
+			p.freqs[k] = freq
+		}
+	}
+	p.samples /= 2
+}
+
+// lastEvictable returns the key of the last (least recently used) evictable element of the list.
+func lastEvictable[K comparable](l *list.List, evictable func(key K) bool, keyOf func(v any) K) (K, bool) {
+	for elem := l.Back(); elem != nil; elem = elem.Prev() {
+		if key := keyOf(elem.Value); evictable(key) {
+			return key, true
+		}
+	}
+	var zeroKey K
+	return zeroKey, false
+}
@@ -0,0 +1,149 @@
+package lrutree
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestCache_EvictionPolicy(t *testing.T) {
+	t.Run("LFU evicts the least frequently used leaf", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, int](4,
+			WithEvictionPolicy[string, int](NewLFUPolicy[string]),
+			WithOnEvict(func(node CacheNode[string, int]) {
+				evicted = append(evicted, node.Key)
+			}),
+		)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Add("b", 2, "root"))
+		assertNoError(t, cache.Add("c", 3, "root"))
+
+		// Among leaves with the same frequency, the least recently used one is evicted.
+		// Nodes of the branch are protected, so the new node is not evicted right away.
+		assertNoError(t, cache.AddBranch([]CacheNode[string, int]{{Key: "d", Value: 4, ParentKey: "root"}}))
+		assertEqual(t, []string{"a"}, evicted)
+
+		for _, key := range []string{"c", "c", "d", "d", "b"} {
+			_, ok := cache.Get(key)
+			assertTrue(t, ok)
+		}
+
+		// "b" is accessed less frequently than "c" and "d", even though it's the most recently used.
+		assertNoError(t, cache.AddBranch([]CacheNode[string, int]{{Key: "e", Value: 5, ParentKey: "root"}}))
+		assertEqual(t, []string{"a", "b"}, evicted)
+
+		// A new node is the least frequently used one, so it's evicted on the next insertion.
+		assertNoError(t, cache.Add("f", 6, "root"))
+		assertEqual(t, []string{"a", "b", "f"}, evicted)
+	})
+
+	t.Run("LFU never evicts inner nodes", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, int](4,
+			WithEvictionPolicy[string, int](NewLFUPolicy[string]),
+			WithOnEvict(func(node CacheNode[string, int]) {
+				evicted = append(evicted, node.Key)
+			}),
+		)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("parent", 1, "root"))
+		assertNoError(t, cache.Add("hot", 2, "root"))
+		for i := 0; i < 5; i++ {
+			_, ok := cache.Get("hot")
+			assertTrue(t, ok)
+		}
+		// Move the hot node under the parent, so the parent becomes an inner node
+		// with lower frequency than its child.
+		assertNoError(t, cache.AddOrUpdate("hot", 2, "parent"))
+		assertNoError(t, cache.Add("new", 3, "root"))
+		assertNoError(t, cache.Add("newer", 4, "root"))
+		assertEqual(t, []string{"new"}, evicted)
+		_, ok := cache.Peek("parent")
+		assertTrue(t, ok)
+	})
+
+	scanResistantPolicies := []struct {
+		name      string
+		newPolicy func() EvictionPolicy[string]
+	}{
+		{"SLRU", func() EvictionPolicy[string] { return NewSLRUPolicy[string](0) }},
+		{"W-TinyLFU", func() EvictionPolicy[string] { return NewTinyLFUPolicy[string](0) }},
+	}
+	for _, tt := range scanResistantPolicies {
+		t.Run(tt.name+" survives scans", func(t *testing.T) {
+			cache := NewCache[string, int](6, WithEvictionPolicy[string, int](tt.newPolicy))
+			assertNoError(t, cache.AddRoot("root", 0))
+			assertNoError(t, cache.Add("hot-parent", 1, "root"))
+			assertNoError(t, cache.Add("hot-1", 2, "hot-parent"))
+			assertNoError(t, cache.Add("hot-2", 3, "root"))
+			for i := 0; i < 3; i++ {
+				for _, key := range []string{"hot-1", "hot-2"} {
+					_, ok := cache.Get(key)
+					assertTrue(t, ok)
+				}
+			}
+
+			// Nodes that are added once (e.g. by a scan) don't flush frequently used ones.
+			for i := 0; i < 20; i++ {
+				assertNoError(t, cache.Add(fmt.Sprintf("scan-%d", i), i, "root"))
+			}
+			assertEqual(t, 6, cache.Len())
+			for _, key := range []string{"root", "hot-parent", "hot-1", "hot-2"} {
+				_, ok := cache.Peek(key)
+				assertTrue(t, ok)
+			}
+		})
+	}
+
+	t.Run("protected nodes are not evicted", func(t *testing.T) {
+		cache := NewCache[string, int](3, WithEvictionPolicy[string, int](NewLFUPolicy[string]))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		_, ok := cache.Get("a")
+		assertTrue(t, ok)
+		assertNoError(t, cache.AddBranch([]CacheNode[string, int]{
+			{Key: "b", Value: 2, ParentKey: "root"},
+			{Key: "c", Value: 3, ParentKey: "b"},
+		}))
+		assertEqual(t, 3, cache.Len())
+		_, ok = cache.Peek("a")
+		assertFalse(t, ok)
+		assertEqual(t, 3, len(cache.PeekBranch("c")))
+	})
+}
+
+func TestCache_EvictionPolicy_Invariants(t *testing.T) {
+	policies := []struct {
+		name      string
+		newPolicy func() EvictionPolicy[int]
+	}{
+		{"LFU", NewLFUPolicy[int]},
+		{"SLRU", func() EvictionPolicy[int] { return NewSLRUPolicy[int](0) }},
+		{"W-TinyLFU", func() EvictionPolicy[int] { return NewTinyLFUPolicy[int](0.1) }},
+	}
+	for _, tt := range policies {
+		t.Run(tt.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(42))
+			cache := NewCache[int, int](50, WithEvictionPolicy[int, int](tt.newPolicy))
+			assertNoError(t, cache.AddRoot(0, 0))
+			for i := 0; i < 5000; i++ {
+				key := rnd.Intn(200) + 1
+				switch op := rnd.Intn(10); {
+				case op < 5:
+					_ = cache.Add(key, i, rnd.Intn(key))
+				case op < 6:
+					_ = cache.AddOrUpdate(key, i, rnd.Intn(200))
+				case op < 7:
+					cache.Remove(key)
+				default:
+					cache.Get(key)
+				}
+
+				assertTrue(t, cache.Len() <= 50)
+				assertNoError(t, cache.Validate())
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package lrutree
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync"
+)
+
+const defaultAccessBufferSize = 64
+
+// WithBufferedPromotion makes Get, GetBranch and TraverseToRoot run under the read lock.
+//
+// Instead of moving accessed nodes to the front of the LRU list immediately (which requires the exclusive lock),
+// access events are recorded into striped buffers (bufferSize events per stripe, the number of stripes
+// depends on GOMAXPROCS) and applied to the LRU list later in batches:
+//   - synchronously before every eviction, so eviction decisions take all recorded accesses into account;
+//   - by a background goroutine as soon as a stripe is full.
+//
+// So the LRU order may lag behind by at most bufferSize events per stripe. Accesses are never dropped:
+// if a stripe is still full because the background drain lags behind, the reader waits for the exclusive lock
+// and drains the buffer itself, so under heavy contention readers are slowed down instead of losing accesses.
+// Since the read lock doesn't allow modifications, expired nodes are not removed lazily by these methods
+// (they are still reported as missing).
+//
+// Since readers run in parallel only with several CPUs, the option is not worth it with GOMAXPROCS=1.
+//
+// The background goroutine is stopped by Close.
+// A non-positive bufferSize means the default size (64).
+func WithBufferedPromotion[K comparable, V any](bufferSize int) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		if bufferSize <= 0 {
+			bufferSize = defaultAccessBufferSize
+		}
+		c.accessBuf = newAccessBuffer[K, V](bufferSize)
+	}
+}
+
+// accessBuffer collects access events that are applied to the LRU list later in batches.
+type accessBuffer[K comparable, V any] struct {
+	stripes  []accessStripe[K, V]
+	mask     uint32
+	size     int
+	drainReq chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+
+	drained []*treeNode[K, V] // Scratch space reused by drains (protected by the cache lock).
+}
+
+type accessStripe[K comparable, V any] struct {
+	mu     sync.Mutex
+	events []*treeNode[K, V]
+	_      [64]byte // Padding to prevent false sharing between stripes.
+}
+
+func newAccessBuffer[K comparable, V any](size int) *accessBuffer[K, V] {
+	stripesNum := 1
+	for stripesNum < runtime.GOMAXPROCS(0) {
+		stripesNum <<= 1
+	}
+	b := &accessBuffer[K, V]{
+		stripes:  make([]accessStripe[K, V], stripesNum),
+		mask:     uint32(stripesNum - 1),
+		size:     size,
+		drainReq: make(chan struct{}, 1),
+	}
+	for i := range b.stripes {
+		b.stripes[i].events = make([]*treeNode[K, V], 0, size)
+	}
+	return b
+}
+
+// record adds the access event to the buffer. It returns false if the stripe is full, so the event can't be recorded
+// until the buffer is drained. full reports whether the stripe is full after the call.
+func (b *accessBuffer[K, V]) record(node *treeNode[K, V]) (recorded bool, full bool) {
+	// The stripe is picked randomly, since the top-level functions of math/rand/v2 use per-thread state,
+	// so concurrent readers don't contend on a shared counter (and hot keys are spread over all stripes).
+	stripe := &b.stripes[rand.Uint32()&b.mask]
+	stripe.mu.Lock()
+	if len(stripe.events) < b.size {
+		stripe.events = append(stripe.events, node)
+		recorded = true
+	}
+	full = len(stripe.events) >= b.size
+	stripe.mu.Unlock()
+	return recorded, full
+}
+
+// recordAccess records the access to the node (and implicitly to all its ancestors).
+// It must be called without holding the cache lock.
+func (c *Cache[K, V]) recordAccess(node *treeNode[K, V]) {
+	recorded, full := c.accessBuf.record(node)
+	if !full {
+		return
+	}
+	if recorded {
+		// The stripe has just become full, so it's drained right away if the lock is free, or in background otherwise.
+		if c.mu.TryLock() {
+			c.drainAccessBuffer()
+			c.mu.Unlock()
+			return
+		}
+		select {
+		case c.accessBuf.drainReq <- struct{}{}:
+		default: // Drain is already requested.
+		}
+		return
+	}
+
+	// The drain lags behind, so the reader drains the buffer itself instead of dropping the access.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drainAccessBuffer()
+	if c.keysMap[node.key] == node {
+		for n := node; n != nil; n = n.parent {
+			c.promote(n)
+		}
+	}
+}
+
+// drainAccessBuffer applies all recorded access events to the LRU list. It must be called under the lock.
+func (c *Cache[K, V]) drainAccessBuffer() {
+	if c.accessBuf == nil {
+		return
+	}
+	b := c.accessBuf
+
+	events := b.drained[:0]
+	for i := range b.stripes {
+		stripe := &b.stripes[i]
+		stripe.mu.Lock()
+		events = append(events, stripe.events...)
+		for j := range stripe.events {
+			stripe.events[j] = nil
+		}
+		stripe.events = stripe.events[:0]
+		stripe.mu.Unlock()
+	}
+
+	// Events are applied in the order they were recorded (within a stripe), like unbuffered accesses would be.
+	// Nodes that were removed after the access was recorded are skipped.
+	for _, node := range events {
+		if c.keysMap[node.key] != node {
+			continue
+		}
+		for n := node; n != nil; n = n.parent {
+			c.promote(n)
+		}
+	}
+	// Release references to nodes, so removed nodes can be garbage collected.
+	for i := range events {
+		events[i] = nil
+	}
+	b.drained = events[:0]
+}
+
+func (c *Cache[K, V]) startAccessBufferDrainer() {
+	c.accessBuf.stop = make(chan struct{})
+	c.accessBuf.done = make(chan struct{})
+	go func() {
+		defer close(c.accessBuf.done)
+		for {
+			select {
+			case <-c.accessBuf.drainReq:
+				c.mu.Lock()
+				c.drainAccessBuffer()
+				c.mu.Unlock()
+			case <-c.accessBuf.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *Cache[K, V]) stopAccessBufferDrainer() {
+	close(c.accessBuf.stop)
+	<-c.accessBuf.done
+}
+
+// getBuffered is a version of Get that runs under the read lock and records the access into the buffer.
+// It also returns the node if its value is stale (see WithRefreshAfter).
+func (c *Cache[K, V]) getBuffered(key K) (cacheNode CacheNode[K, V], staleNode *treeNode[K, V], ok bool) {
+	node := func() *treeNode[K, V] {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+
+		now := c.now()
+		node, exists := c.keysMap[key]
+		if !exists || node.isExpired(now) {
+			c.stats.IncMisses()
+			return nil
+		}
+		c.stats.IncHits()
+		cacheNode = node.toCacheNode()
+		if c.isStale(node, now) {
+			staleNode = node
+		}
+		return node
+	}()
+	if node == nil {
+		return CacheNode[K, V]{}, nil, false
+	}
+	c.recordAccess(node)
+	return cacheNode, staleNode, true
+}
+
+func (c *Cache[K, V]) peek(key K) (*treeNode[K, V], CacheNode[K, V], bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	node, exists := c.keysMap[key]
+	if !exists || node.isExpired(c.now()) {
+		c.stats.IncMisses()
+		return nil, CacheNode[K, V]{}, false
+	}
+
+	c.stats.IncHits()
+	return node, node.toCacheNode(), true
+}
+
+// getBranchBuffered is a version of GetBranch that runs under the read lock and records the access into the buffer.
+func (c *Cache[K, V]) getBranchBuffered(key K) []CacheNode[K, V] {
+	node, branch := c.peekBranch(key)
+	if node != nil {
+		c.recordAccess(node)
+	}
+	return branch
+}
+
+// traverseToRootBuffered is a version of TraverseToRoot that runs under the read lock
+// and records the access into the buffer.
+func (c *Cache[K, V]) traverseToRootBuffered(key K, f func(key K, val V, parentKey K)) {
+	var node *treeNode[K, V]
+	defer func() {
+		// Record the access in defer to ensure that the order is updated even if f panics.
+		if node != nil {
+			c.recordAccess(node)
+		}
+	}()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var exists bool
+	if node, exists = c.keysMap[key]; !exists || node.isExpired(c.now()) {
+		node = nil
+		c.stats.IncMisses()
+		return
+	}
+
+	for n := node; n != nil; n = n.parent {
+		f(n.key, n.val, n.parentKey())
+	}
+
+	c.stats.IncHits()
+}
@@ -0,0 +1,241 @@
+package lrutree
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_BufferedPromotion(t *testing.T) {
+	t.Run("promotion is deferred until drain", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithBufferedPromotion[string, int](100))
+		defer cache.Close()
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root-1", 2, "root"))
+		assertNoError(t, cache.Add("partner-1", 3, "sub-root-1"))
+		assertNoError(t, cache.Add("sub-root-2", 4, "root"))
+		assertEqual(t, []string{"root", "sub-root-2", "sub-root-1", "partner-1"}, getLRUOrder(cache))
+
+		cacheNode, ok := cache.Get("partner-1")
+		assertTrue(t, ok)
+		assertEqual(t, CacheNode[string, int]{Key: "partner-1", Value: 3, ParentKey: "sub-root-1"}, cacheNode)
+		_, ok = cache.Get("nonexistent")
+		assertFalse(t, ok)
+		assertEqual(t, []string{"root", "sub-root-2", "sub-root-1", "partner-1"}, getLRUOrder(cache))
+
+		assertEqual(t, []string{"root", "sub-root-1", "partner-1", "sub-root-2"}, drainedLRUOrder(cache))
+	})
+
+	t.Run("GetBranch and TraverseToRoot", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithBufferedPromotion[string, int](100))
+		defer cache.Close()
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root-1", 2, "root"))
+		assertNoError(t, cache.Add("partner-1", 3, "sub-root-1"))
+		assertNoError(t, cache.Add("sub-root-2", 4, "root"))
+		assertNoError(t, cache.Add("partner-2", 5, "sub-root-2"))
+
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "root", Value: 1},
+			{Key: "sub-root-1", Value: 2, ParentKey: "root"},
+			{Key: "partner-1", Value: 3, ParentKey: "sub-root-1"},
+		}, cache.GetBranch("partner-1"))
+		assertNil(t, cache.GetBranch("nonexistent"))
+		assertEqual(t, []string{"root", "sub-root-1", "partner-1", "sub-root-2", "partner-2"}, drainedLRUOrder(cache))
+
+		var traversed []string
+		cache.TraverseToRoot("partner-2", func(key string, val int, parentKey string) {
+			traversed = append(traversed, key)
+		})
+		assertEqual(t, []string{"partner-2", "sub-root-2", "root"}, traversed)
+		cache.TraverseToRoot("nonexistent", func(key string, val int, parentKey string) {
+			t.Fatal("callback should not be called")
+		})
+		assertEqual(t, []string{"root", "sub-root-2", "partner-2", "sub-root-1", "partner-1"}, drainedLRUOrder(cache))
+
+		// The access is recorded even if the callback panics.
+		func() {
+			defer func() { assertEqual(t, "test panic", recover()) }()
+			cache.TraverseToRoot("partner-1", func(key string, val int, parentKey string) {
+				panic("test panic")
+			})
+		}()
+		assertEqual(t, []string{"root", "sub-root-1", "partner-1", "sub-root-2", "partner-2"}, drainedLRUOrder(cache))
+	})
+
+	t.Run("eviction takes recorded accesses into account", func(t *testing.T) {
+		var evicted []string
+		cache := NewCache[string, int](4,
+			WithBufferedPromotion[string, int](100),
+			WithOnEvict(func(node CacheNode[string, int]) {
+				evicted = append(evicted, node.Key)
+			}),
+		)
+		defer cache.Close()
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root-1", 2, "root"))
+		assertNoError(t, cache.Add("sub-root-2", 3, "root"))
+		assertNoError(t, cache.Add("sub-root-3", 4, "root"))
+
+		_, _ = cache.Get("sub-root-1")
+		assertNoError(t, cache.Add("sub-root-4", 5, "root"))
+		assertEqual(t, []string{"sub-root-2"}, evicted)
+	})
+
+	t.Run("removed nodes are skipped", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithBufferedPromotion[string, int](100))
+		defer cache.Close()
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root-1", 2, "root"))
+		assertNoError(t, cache.Add("partner-1", 3, "sub-root-1"))
+		assertNoError(t, cache.Add("sub-root-2", 4, "root"))
+
+		_, _ = cache.Get("partner-1")
+		assertEqual(t, 2, cache.Remove("sub-root-1"))
+		assertNoError(t, cache.Add("sub-root-1", 5, "root"))
+		assertNoError(t, cache.Add("sub-root-3", 6, "root"))
+		assertEqual(t, []string{"root", "sub-root-3", "sub-root-1", "sub-root-2"}, drainedLRUOrder(cache))
+	})
+
+	t.Run("expired nodes are misses", func(t *testing.T) {
+		clock := newFakeClock()
+		cache := NewCache[string, int](10, WithBufferedPromotion[string, int](100), WithTTL[string, int](time.Minute))
+		defer cache.Close()
+		cache.now = clock.Now
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root", 2, "root"))
+		clock.Advance(2 * time.Minute)
+
+		_, ok := cache.Get("sub-root")
+		assertFalse(t, ok)
+		assertNil(t, cache.GetBranch("sub-root"))
+		cache.TraverseToRoot("sub-root", func(key string, val int, parentKey string) {
+			t.Fatal("callback should not be called")
+		})
+		// Expired nodes are not reaped under the read lock.
+		assertEqual(t, 2, cache.Len())
+	})
+
+	t.Run("full stripe is drained", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithBufferedPromotion[string, int](1))
+		defer cache.Close()
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root-1", 2, "root"))
+		assertNoError(t, cache.Add("sub-root-2", 3, "root"))
+
+		// The lock is free, so the stripe is drained immediately.
+		_, _ = cache.Get("sub-root-1")
+		assertEqual(t, []string{"root", "sub-root-1", "sub-root-2"}, getLRUOrder(cache))
+
+		// The lock is busy, so the stripe is drained by the background goroutine once the lock is released.
+		cache.mu.RLock()
+		_, _ = cache.Get("sub-root-2")
+		cache.mu.RUnlock()
+		waitFor(t, func() bool {
+			cache.mu.RLock()
+			defer cache.mu.RUnlock()
+			return cache.lruList.Front().Next().Value.(*treeNode[string, int]).key == "sub-root-2"
+		})
+	})
+
+	t.Run("access to a full stripe is not dropped", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithBufferedPromotion[string, int](1))
+		defer cache.Close()
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root-1", 2, "root"))
+		assertNoError(t, cache.Add("sub-root-2", 3, "root"))
+		assertNoError(t, cache.Add("sub-root-3", 4, "root"))
+
+		// All stripes are full, since the background drain lags behind.
+		node := cache.keysMap["sub-root-1"]
+		for i := range cache.accessBuf.stripes {
+			cache.accessBuf.stripes[i].events = append(cache.accessBuf.stripes[i].events, node)
+		}
+		_, _ = cache.Get("sub-root-2")
+		assertEqual(t, []string{"root", "sub-root-2", "sub-root-1", "sub-root-3"}, getLRUOrder(cache))
+	})
+
+	t.Run("drain is equivalent to sequential promotion", func(t *testing.T) {
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		buffered := NewCache[int, int](0, WithBufferedPromotion[int, int](1000))
+		defer buffered.Close()
+		sequential := NewCache[int, int](0)
+		for _, c := range []*Cache[int, int]{buffered, sequential} {
+			assertNoError(t, c.AddRoot(0, 0))
+			for i := 1; i < 50; i++ {
+				assertNoError(t, c.Add(i, i, (i-1)/3)) // Ternary tree.
+			}
+		}
+
+		// Fill a single stripe to have a deterministic order of events.
+		stripe := &buffered.accessBuf.stripes[0]
+		for i := 0; i < 200; i++ {
+			key := rnd.Intn(50)
+			stripe.events = append(stripe.events, buffered.keysMap[key])
+			_, _ = sequential.Get(key)
+		}
+		assertEqual(t, getLRUOrder(sequential), drainedLRUOrder(buffered))
+	})
+}
+
+func TestCache_BufferedPromotion_Concurrency(t *testing.T) {
+	cache := NewCache[string, int](100, WithBufferedPromotion[string, int](4))
+	defer cache.Close()
+	assertNoError(t, cache.AddRoot("root", 0))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			parent := "root"
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("node-%d-%d", g, i%50)
+				_ = cache.Add(key, i, parent)
+				_, _ = cache.Get(key)
+				_ = cache.GetBranch(parent)
+				cache.TraverseToRoot(key, func(key string, val int, parentKey string) {})
+				if i%7 == 0 {
+					cache.Remove(key)
+					parent = "root"
+				} else if i%3 == 0 {
+					parent = key
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Parents always precede their descendants in the LRU list.
+	order := drainedLRUOrder(cache)
+	seen := make(map[string]struct{}, len(order))
+	for _, key := range order {
+		if node, _ := cache.Peek(key); node.ParentKey != "" {
+			_, parentSeen := seen[node.ParentKey]
+			assertTrue(t, parentSeen)
+		}
+		seen[key] = struct{}{}
+	}
+	assertTrue(t, cache.Len() <= 100)
+}
+
+// drainedLRUOrder applies all recorded accesses and returns the LRU order.
+func drainedLRUOrder[K comparable, V any](c *Cache[K, V]) []K {
+	c.mu.Lock()
+	c.drainAccessBuffer()
+	c.mu.Unlock()
+	return getLRUOrder(c)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
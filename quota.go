@@ -0,0 +1,105 @@
+package lrutree
+
+import (
+	"slices"
+)
+
+// SubtreeQuota describes a quota set by SetSubtreeQuota.
+type SubtreeQuota[K comparable] struct {
+	Key      K   // Key of the root of the subtree.
+	MaxNodes int // Maximum number of nodes in the subtree, including its root.
+	Nodes    int // Current number of nodes in the subtree, including its root.
+}
+
+// SetSubtreeQuota limits the number of nodes in the subtree rooted at the node with the given key
+// (including the node itself), so a single subtree (e.g. a noisy tenant) can't flush nodes of other subtrees.
+//
+// When the subtree exceeds its quota, the least recently used leaves (or the ones selected by the eviction policy)
+// within the subtree are evicted, while nodes outside of it are kept. The global capacity still applies on top of quotas.
+// Quotas may be nested (e.g. a department quota inside a tenant quota): inner quotas are enforced first,
+// so an inner subtree never exceeds its own quota, and the outer one is enforced by evicting across its whole subtree.
+// Like the global capacity, a quota may be exceeded if the subtree has no evictable leaves (e.g. they are pinned).
+//
+// If the subtree already exceeds the quota, nodes are evicted immediately. A non-positive maxNodes removes the quota.
+// The quota is removed along with the node and is not persisted by WriteSnapshot.
+// Tombstones added by AddNegative don't count against quotas.
+//
+// ErrNodeNotExist is returned if the node doesn't exist.
+func (c *Cache[K, V]) SetSubtreeQuota(key K, maxNodes int) error {
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node, exists := c.keysMap[key]
+	if !exists || c.reapIfExpired(node, c.now(), &evictedNodes) {
+		return ErrNodeNotExist
+	}
+
+	if maxNodes <= 0 {
+		node.quota = 0
+		delete(c.quotaNodes, node)
+		return nil
+	}
+	node.quota = maxNodes
+	if c.quotaNodes == nil {
+		c.quotaNodes = make(map[*treeNode[K, V]]struct{})
+	}
+	c.quotaNodes[node] = struct{}{}
+
+	c.evictIfNeeded(&evictedNodes, nil)
+
+	c.reportAmount()
+
+	return nil
+}
+
+// SubtreeQuotas returns all quotas set by SetSubtreeQuota with the current sizes of their subtrees.
+// Outer quotas precede the nested ones. Expired nodes that have not been reaped yet are counted, like in Len.
+func (c *Cache[K, V]) SubtreeQuotas() []SubtreeQuota[K] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	quotaNodes := c.sortedQuotaNodes(func(node *treeNode[K, V]) bool { return true })
+	quotas := make([]SubtreeQuota[K], len(quotaNodes))
+	for i := range quotaNodes {
+		node := quotaNodes[len(quotaNodes)-1-i]
+		quotas[i] = SubtreeQuota[K]{Key: node.key, MaxNodes: node.quota, Nodes: node.descendants + 1}
+	}
+	return quotas
+}
+
+// overQuota returns the nodes which subtrees exceed their quotas, the deepest ones first.
+func (c *Cache[K, V]) overQuota() []*treeNode[K, V] {
+	if len(c.quotaNodes) == 0 {
+		return nil
+	}
+	return c.sortedQuotaNodes(func(node *treeNode[K, V]) bool { return node.descendants+1 > node.quota })
+}
+
+// sortedQuotaNodes returns the nodes with quotas that match the filter, the deepest ones first.
+func (c *Cache[K, V]) sortedQuotaNodes(filter func(node *treeNode[K, V]) bool) []*treeNode[K, V] {
+	var nodes []*treeNode[K, V]
+	depths := make(map[*treeNode[K, V]]int)
+	for node := range c.quotaNodes {
+		if filter(node) {
+			nodes = append(nodes, node)
+			depths[node] = nodeDepth(node)
+		}
+	}
+	slices.SortFunc(nodes, func(a, b *treeNode[K, V]) int {
+		return depths[b] - depths[a]
+	})
+	return nodes
+}
+
+// isDescendant reports whether the node is a proper descendant of the ancestor.
+func isDescendant[K comparable, V any](node, ancestor *treeNode[K, V]) bool {
+	for n := node.parent; n != nil; n = n.parent {
+		if n == ancestor {
+			return true
+		}
+	}
+	return false
+}
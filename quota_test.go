@@ -0,0 +1,145 @@
+package lrutree
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCache_SetSubtreeQuota(t *testing.T) {
+	newCache := func(maxEntries int, options ...CacheOption[string, int]) *Cache[string, int] {
+		cache := NewCache[string, int](maxEntries, options...)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("tenant-a", 1, "root"))
+		assertNoError(t, cache.Add("tenant-b", 2, "root"))
+		assertNoError(t, cache.Add("b1", 21, "tenant-b"))
+		return cache
+	}
+	keysOf := func(cache *Cache[string, int], key string) []string {
+		var keys []string
+		for k := range cache.Subtree(key) {
+			keys = append(keys, k)
+		}
+		return keys
+	}
+
+	t.Run("evicts within subtree", func(t *testing.T) {
+		var evicted []string
+		cache := newCache(100, WithOnEvict(func(node CacheNode[string, int]) {
+			evicted = append(evicted, node.Key)
+		}))
+		assertNoError(t, cache.SetSubtreeQuota("tenant-a", 3))
+		assertNoError(t, cache.Add("a1", 11, "tenant-a"))
+		assertNoError(t, cache.Add("a2", 12, "tenant-a"))
+		assertEqual(t, 0, len(evicted))
+
+		// "b1" is the least recently used leaf, but it's outside of the subtree.
+		assertNoError(t, cache.Add("a3", 13, "tenant-a"))
+		assertEqual(t, []string{"a1"}, evicted)
+		size, _ := cache.SubtreeSize("tenant-a")
+		assertEqual(t, 3, size)
+		_, ok := cache.Peek("b1")
+		assertTrue(t, ok)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("nested quotas", func(t *testing.T) {
+		cache := newCache(100)
+		assertNoError(t, cache.Add("eng", 3, "tenant-a"))
+		assertNoError(t, cache.Add("sales", 4, "tenant-a"))
+		assertNoError(t, cache.SetSubtreeQuota("tenant-a", 5))
+		assertNoError(t, cache.SetSubtreeQuota("eng", 2))
+
+		assertNoError(t, cache.Add("s1", 41, "sales"))
+		assertNoError(t, cache.Add("e1", 31, "eng"))
+		assertNoError(t, cache.Add("e2", 32, "eng")) // The inner quota evicts "e1".
+		_, ok := cache.Peek("e1")
+		assertFalse(t, ok)
+		assertEqual(t, []string{"eng", "e2"}, keysOf(cache, "eng"))
+
+		// The outer quota evicts the least recently used leaf of the whole tenant.
+		assertNoError(t, cache.Add("s2", 42, "sales"))
+		_, ok = cache.Peek("s1")
+		assertFalse(t, ok)
+		size, _ := cache.SubtreeSize("tenant-a")
+		assertEqual(t, 5, size)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("global limit still applies", func(t *testing.T) {
+		cache := newCache(5)
+		assertNoError(t, cache.SetSubtreeQuota("tenant-a", 3))
+		assertNoError(t, cache.Add("a1", 11, "tenant-a"))
+		assertNoError(t, cache.Add("a2", 12, "tenant-a")) // The subtree is within its quota, but "b1" is evicted globally.
+		_, ok := cache.Peek("b1")
+		assertFalse(t, ok)
+		assertEqual(t, 5, cache.Len())
+	})
+
+	t.Run("set on exceeding subtree", func(t *testing.T) {
+		cache := newCache(100)
+		assertNoError(t, cache.Add("b2", 22, "tenant-b"))
+		assertNoError(t, cache.Add("b3", 23, "tenant-b"))
+		assertNoError(t, cache.SetSubtreeQuota("tenant-b", 2))
+		assertEqual(t, []string{"tenant-b", "b3"}, keysOf(cache, "tenant-b"))
+
+		// A quota of the leaf doesn't allow children.
+		assertNoError(t, cache.SetSubtreeQuota("b3", 1))
+		assertNoError(t, cache.Add("b31", 231, "b3"))
+		_, ok := cache.Peek("b31")
+		assertFalse(t, ok)
+
+		// A non-positive quota removes it.
+		assertNoError(t, cache.SetSubtreeQuota("tenant-b", 0))
+		assertNoError(t, cache.Add("b4", 24, "tenant-b"))
+		size, _ := cache.SubtreeSize("tenant-b")
+		assertEqual(t, 3, size)
+
+		assertErrorIs(t, cache.SetSubtreeQuota("nonexistent", 1), ErrNodeNotExist)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("move into subtree", func(t *testing.T) {
+		cache := newCache(100)
+		assertNoError(t, cache.Add("a1", 11, "tenant-a"))
+		assertNoError(t, cache.SetSubtreeQuota("tenant-a", 2))
+		assertNoError(t, cache.Move("b1", "tenant-a"))
+		size, _ := cache.SubtreeSize("tenant-a")
+		assertEqual(t, 2, size)
+		// The moved node keeps its position in the LRU order, so it's the least recently used leaf of the subtree.
+		_, ok := cache.Peek("b1")
+		assertFalse(t, ok)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("eviction policy", func(t *testing.T) {
+		cache := newCache(100, WithEvictionPolicy[string, int](NewLFUPolicy[string]))
+		assertNoError(t, cache.SetSubtreeQuota("tenant-a", 3))
+		assertNoError(t, cache.Add("a1", 11, "tenant-a"))
+		assertNoError(t, cache.Add("a2", 12, "tenant-a"))
+		cache.Get("a1")
+		assertNoError(t, cache.Add("a3", 13, "tenant-a"))
+		assertEqual(t, []string{"a1", "a3", "tenant-a"}, slices.Sorted(slices.Values(keysOf(cache, "tenant-a"))))
+		_, ok := cache.Peek("b1")
+		assertTrue(t, ok)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("introspection", func(t *testing.T) {
+		cache := newCache(100)
+		assertNoError(t, cache.Add("eng", 3, "tenant-a"))
+		assertNoError(t, cache.Add("e1", 31, "eng"))
+		assertNoError(t, cache.SetSubtreeQuota("eng", 5))
+		assertNoError(t, cache.SetSubtreeQuota("tenant-a", 10))
+		assertNoError(t, cache.SetSubtreeQuota("root", 20))
+		assertEqual(t, []SubtreeQuota[string]{
+			{Key: "root", MaxNodes: 20, Nodes: 6},
+			{Key: "tenant-a", MaxNodes: 10, Nodes: 3},
+			{Key: "eng", MaxNodes: 5, Nodes: 2},
+		}, cache.SubtreeQuotas())
+
+		// Quotas are removed along with their nodes.
+		cache.Remove("tenant-a")
+		assertEqual(t, []SubtreeQuota[string]{{Key: "root", MaxNodes: 20, Nodes: 3}}, cache.SubtreeQuotas())
+		assertNoError(t, cache.Validate())
+	})
+}
@@ -0,0 +1,135 @@
+package lrutree
+
+import (
+	"time"
+)
+
+// WithRefreshAfter enables stale-while-revalidate behavior for nodes which values were set longer than d ago.
+// Get (and methods based on it, like Lookup and GetOrLoad) of such a stale node returns the current value
+// immediately and triggers an asynchronous reload of the node using the loader set by WithLoader.
+// Only a single reload per key runs at a time, so concurrent Gets of the same stale node don't multiply loads.
+//
+// The reloaded value replaces the value of the node (the old one is reported via the WithOnRemove callback
+// with RemovalReplaced reason), while its expiration time and position in the LRU order are kept.
+// If the loader reports another parent, the node is moved under it like by Move.
+// If the node was removed (or replaced by another node with the same key) while it was being reloaded,
+// the result is discarded.
+// Errors (returned by the loader, ErrParentNotExist or ErrCycleDetected for the reported parent) are reported
+// to the callback set by WithOnRefreshError, and the node stays stale, but the reload is retried
+// only by the first Get after d passes since the failure, so a failing loader isn't called on every Get.
+//
+// The root node is never reloaded. A non-positive duration (default) disables the refresh,
+// and it's also disabled if the cache has no loader.
+// Close cancels the context passed to the loader and waits for reloads in progress to finish.
+func WithRefreshAfter[K comparable, V any](d time.Duration) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.refreshAfter = d
+	}
+}
+
+// WithOnRefreshError sets a callback that is called when a background reload triggered by WithRefreshAfter fails.
+// The callback is called from the reloading goroutine.
+func WithOnRefreshError[K comparable, V any](onError func(key K, err error)) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onRefreshError = onError
+	}
+}
+
+// isStale reports whether the node must be reloaded in the background (see WithRefreshAfter).
+// The node is not reloaded again until d passes since the last failed reload.
+// It must be called under the lock.
+func (c *Cache[K, V]) isStale(node *treeNode[K, V], now time.Time) bool {
+	return c.refreshCtx != nil && node.parent != nil &&
+		now.Sub(node.updatedAt) >= c.refreshAfter && now.Sub(node.refreshFailedAt) >= c.refreshAfter
+}
+
+// refreshAsync starts a background reload of the node stored under the key unless it's already in progress.
+// It must be called without holding the lock.
+func (c *Cache[K, V]) refreshAsync(key K, node *treeNode[K, V]) {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+
+	if c.refreshCtx.Err() != nil { // The cache is closed.
+		return
+	}
+	if _, ok := c.refreshing[key]; ok {
+		return
+	}
+	if c.refreshing == nil {
+		c.refreshing = make(map[K]struct{})
+	}
+	c.refreshing[key] = struct{}{}
+
+	c.refreshWG.Add(1)
+	go func() {
+		defer c.refreshWG.Done()
+		defer func() {
+			c.loadMu.Lock()
+			delete(c.refreshing, key)
+			c.loadMu.Unlock()
+		}()
+
+		if err := c.refresh(key, node); err != nil && c.onRefreshError != nil {
+			c.onRefreshError(key, err)
+		}
+	}()
+}
+
+func (c *Cache[K, V]) refresh(key K, node *treeNode[K, V]) error {
+	val, parentKey, err := c.loader.Load(c.refreshCtx, key)
+	if err == nil {
+		err = c.applyRefresh(key, node, val, parentKey)
+	}
+	if err != nil {
+		c.mu.Lock()
+		node.refreshFailedAt = c.now()
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// applyRefresh sets the reloaded value of the node if it's still stored in the cache under the key.
+// Otherwise, the node was removed (or replaced) while it was being reloaded, and the value is discarded.
+func (c *Cache[K, V]) applyRefresh(key K, node *treeNode[K, V], val V, parentKey K) error {
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	if c.keysMap[key] != node || node.isExpired(now) {
+		return nil
+	}
+	parent, parentExists := c.keysMap[parentKey]
+	if !parentExists || c.reapIfExpired(parent, now, &evictedNodes) {
+		return ErrParentNotExist
+	}
+
+	reparented, err := c.updateNode(node, parent, val, node.expiresAt, &evictedNodes)
+	if err != nil {
+		return err
+	}
+	if reparented {
+		// Keep the new parent and its ancestors in front of the node in the LRU list.
+		for n := parent; n != nil; n = n.parent {
+			c.promote(n)
+		}
+	}
+
+	// The new value may cost more.
+	c.evictIfNeeded(&evictedNodes, nil)
+
+	c.reportAmount()
+
+	return nil
+}
+
+// stopRefreshes cancels background reloads and waits for them to finish.
+func (c *Cache[K, V]) stopRefreshes() {
+	c.loadMu.Lock()
+	c.refreshStop()
+	c.loadMu.Unlock()
+	c.refreshWG.Wait()
+}
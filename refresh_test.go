@@ -0,0 +1,270 @@
+package lrutree
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForRefreshes waits until all background reloads started by WithRefreshAfter are finished.
+func waitForRefreshes[K comparable, V any](t *testing.T, c *Cache[K, V]) {
+	t.Helper()
+	waitFor(t, func() bool {
+		c.loadMu.Lock()
+		defer c.loadMu.Unlock()
+		return len(c.refreshing) == 0
+	})
+}
+
+func TestCache_WithRefreshAfter(t *testing.T) {
+	type loadResult struct {
+		val       int
+		parentKey string
+		err       error
+	}
+
+	newCache := func(
+		load func(key string) loadResult, options ...CacheOption[string, int],
+	) (*Cache[string, int], *time.Time) {
+		now := time.Now()
+		loader := LoaderFunc[string, int](func(ctx context.Context, key string) (int, string, error) {
+			res := load(key)
+			return res.val, res.parentKey, res.err
+		})
+		options = append(options, WithLoader[string, int](loader), WithRefreshAfter[string, int](time.Minute))
+		cache := NewCache[string, int](10, options...)
+		cache.now = func() time.Time { return now }
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("dir1", 1, "root"))
+		assertNoError(t, cache.Add("dir2", 2, "root"))
+		assertNoError(t, cache.Add("file", 10, "dir1"))
+		return cache, &now
+	}
+
+	t.Run("stale value is returned and reloaded", func(t *testing.T) {
+		var calls atomic.Int32
+		cache, now := newCache(func(key string) loadResult {
+			calls.Add(1)
+			return loadResult{val: 11, parentKey: "dir1"}
+		})
+		defer cache.Close()
+
+		// A fresh value is not reloaded.
+		*now = now.Add(time.Minute - time.Second)
+		cacheNode, ok := cache.Get("file")
+		assertTrue(t, ok)
+		assertEqual(t, 10, cacheNode.Value)
+		waitForRefreshes(t, cache)
+		assertEqual(t, int32(0), calls.Load())
+
+		*now = now.Add(time.Second)
+		cacheNode, ok = cache.Get("file")
+		assertTrue(t, ok)
+		assertEqual(t, 10, cacheNode.Value)
+		waitForRefreshes(t, cache)
+		assertEqual(t, int32(1), calls.Load())
+
+		// The reloaded value is fresh again.
+		cacheNode, ok = cache.Get("file")
+		assertTrue(t, ok)
+		assertEqual(t, 11, cacheNode.Value)
+		waitForRefreshes(t, cache)
+		assertEqual(t, int32(1), calls.Load())
+
+		// The root is never reloaded.
+		*now = now.Add(time.Hour)
+		_, ok = cache.Get("root")
+		assertTrue(t, ok)
+		waitForRefreshes(t, cache)
+		assertEqual(t, int32(1), calls.Load())
+	})
+
+	t.Run("reparented", func(t *testing.T) {
+		cache, now := newCache(func(key string) loadResult {
+			return loadResult{val: 11, parentKey: "dir2"}
+		})
+		defer cache.Close()
+
+		*now = now.Add(time.Minute)
+		cacheNode, ok := cache.Get("file")
+		assertTrue(t, ok)
+		assertEqual(t, "dir1", cacheNode.ParentKey)
+		waitForRefreshes(t, cache)
+
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "root", Value: 0},
+			{Key: "dir2", Value: 2, ParentKey: "root"},
+			{Key: "file", Value: 11, ParentKey: "dir2"},
+		}, cache.PeekBranch("file"))
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("single reload per key", func(t *testing.T) {
+		var calls atomic.Int32
+		release := make(chan struct{})
+		cache, now := newCache(func(key string) loadResult {
+			calls.Add(1)
+			<-release
+			return loadResult{val: 11, parentKey: "dir1"}
+		})
+		defer cache.Close()
+
+		*now = now.Add(time.Minute)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cacheNode, ok := cache.Get("file")
+				assertTrue(t, ok)
+				assertEqual(t, 10, cacheNode.Value)
+			}()
+		}
+		wg.Wait()
+		close(release)
+		waitForRefreshes(t, cache)
+		assertEqual(t, int32(1), calls.Load())
+		cacheNode, _ := cache.Peek("file")
+		assertEqual(t, 11, cacheNode.Value)
+	})
+
+	t.Run("errors are reported and reload is retried after backoff", func(t *testing.T) {
+		errLoad := errors.New("load failed")
+		var calls atomic.Int32
+		var mu sync.Mutex
+		var reported []error
+		cache, now := newCache(func(key string) loadResult {
+			if calls.Add(1) == 1 {
+				return loadResult{err: errLoad}
+			}
+			return loadResult{val: 11, parentKey: "nonexistent"}
+		}, WithOnRefreshError[string, int](func(key string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			assertEqual(t, "file", key)
+			reported = append(reported, err)
+		}))
+		defer cache.Close()
+
+		*now = now.Add(time.Minute)
+		cache.Get("file")
+		waitForRefreshes(t, cache)
+
+		// The failed reload is not retried until the refresh interval passes since the failure.
+		*now = now.Add(time.Minute - time.Second)
+		cache.Get("file")
+		waitForRefreshes(t, cache)
+		assertEqual(t, int32(1), calls.Load())
+
+		*now = now.Add(time.Second)
+		cache.Get("file")
+		waitForRefreshes(t, cache)
+		assertEqual(t, int32(2), calls.Load())
+
+		mu.Lock()
+		defer mu.Unlock()
+		assertEqual(t, 2, len(reported))
+		assertErrorIs(t, reported[0], errLoad)
+		assertErrorIs(t, reported[1], ErrParentNotExist)
+		cacheNode, _ := cache.Peek("file")
+		assertEqual(t, 10, cacheNode.Value)
+	})
+
+	t.Run("removed node is not restored", func(t *testing.T) {
+		release := make(chan struct{})
+		cache, now := newCache(func(key string) loadResult {
+			<-release
+			return loadResult{val: 11, parentKey: "dir1"}
+		})
+		defer cache.Close()
+
+		*now = now.Add(time.Minute)
+		cache.Get("file")
+		assertEqual(t, 1, cache.Remove("file"))
+		close(release)
+		waitForRefreshes(t, cache)
+		_, ok := cache.Peek("file")
+		assertFalse(t, ok)
+	})
+
+	t.Run("node replaced during reload is not updated", func(t *testing.T) {
+		release := make(chan struct{})
+		cache, now := newCache(func(key string) loadResult {
+			<-release
+			return loadResult{val: 11, parentKey: "dir1"}
+		})
+		defer cache.Close()
+
+		*now = now.Add(time.Minute)
+		cache.Get("file")
+		assertEqual(t, 1, cache.Remove("file"))
+		assertNoError(t, cache.Add("file", 20, "dir2"))
+		close(release)
+		waitForRefreshes(t, cache)
+		cacheNode, _ := cache.Peek("file")
+		assertEqual(t, CacheNode[string, int]{Key: "file", Value: 20, ParentKey: "dir2"}, cacheNode)
+	})
+
+	t.Run("expiration time is kept", func(t *testing.T) {
+		cache, now := newCache(func(key string) loadResult {
+			return loadResult{val: 21, parentKey: "dir2"}
+		})
+		defer cache.Close()
+		assertNoError(t, cache.AddWithTTL("tmp", 20, "dir1", time.Hour))
+
+		*now = now.Add(time.Minute)
+		cache.Get("tmp")
+		waitForRefreshes(t, cache)
+		cacheNode, ok := cache.Peek("tmp")
+		assertTrue(t, ok)
+		assertEqual(t, CacheNode[string, int]{Key: "tmp", Value: 21, ParentKey: "dir2"}, cacheNode)
+
+		// The node still expires an hour after it was added, even though the cache has no default TTL.
+		*now = now.Add(time.Hour - time.Minute)
+		_, ok = cache.Peek("tmp")
+		assertFalse(t, ok)
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("buffered promotion", func(t *testing.T) {
+		var calls atomic.Int32
+		cache, now := newCache(func(key string) loadResult {
+			calls.Add(1)
+			return loadResult{val: 11, parentKey: "dir1"}
+		}, WithBufferedPromotion[string, int](0))
+		defer cache.Close()
+
+		*now = now.Add(time.Minute)
+		cacheNode, ok := cache.Get("file")
+		assertTrue(t, ok)
+		assertEqual(t, 10, cacheNode.Value)
+		waitForRefreshes(t, cache)
+		assertEqual(t, int32(1), calls.Load())
+		cacheNode, _ = cache.Peek("file")
+		assertEqual(t, 11, cacheNode.Value)
+	})
+
+	t.Run("Close cancels reloads", func(t *testing.T) {
+		cache, now := newCache(func(key string) loadResult {
+			return loadResult{}
+		})
+		var loadCtx context.Context
+		cache.loader = LoaderFunc[string, int](func(ctx context.Context, key string) (int, string, error) {
+			loadCtx = ctx
+			<-ctx.Done()
+			return 0, "", ctx.Err()
+		})
+
+		*now = now.Add(time.Minute)
+		cache.Get("file")
+		cache.Close()
+		assertErrorIs(t, loadCtx.Err(), context.Canceled)
+
+		// Reloads are not started after Close.
+		cache.Get("file")
+		assertEqual(t, 0, len(cache.refreshing))
+	})
+}
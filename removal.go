@@ -0,0 +1,72 @@
+package lrutree
+
+// RemovalReason describes why a node was removed from the cache.
+type RemovalReason int
+
+const (
+	// RemovalCapacity means that the node was evicted because of the capacity limit.
+	RemovalCapacity RemovalReason = iota
+
+	// RemovalExplicit means that the node was removed by Remove (directly or as a descendant of the removed node).
+	RemovalExplicit
+
+	// RemovalExpired means that the node was removed because it expired.
+	RemovalExpired
+
+	// RemovalReplaced means that the value of the node was overwritten by AddOrUpdate or AddOrUpdateBranch.
+	// The node itself stays in the cache, and the callback receives its old value and parent key.
+	RemovalReplaced
+)
+
+// String returns the name of the removal reason.
+func (r RemovalReason) String() string {
+	switch r {
+	case RemovalCapacity:
+		return "Capacity"
+	case RemovalExplicit:
+		return "Removed"
+	case RemovalExpired:
+		return "Expired"
+	case RemovalReplaced:
+		return "Replaced"
+	default:
+		return "Unknown"
+	}
+}
+
+// WithOnRemove sets a callback that is called for every node removed from the cache for any reason,
+// and for every value overwritten by AddOrUpdate or AddOrUpdateBranch (see RemovalReason).
+// It's useful for releasing resources attached to values.
+//
+// When a subtree is removed, descendants are reported before their parents.
+// The callback is invoked outside the cache lock, after the operation that removed the nodes is completed.
+// It's called in addition to the WithOnEvict callback.
+func WithOnRemove[K comparable, V any](onRemove func(node CacheNode[K, V], reason RemovalReason)) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onRemove = onRemove
+	}
+}
+
+// removedNode is a node removed from the cache under the lock, which should be reported after the lock is released.
+type removedNode[K comparable, V any] struct {
+	CacheNode[K, V]
+	reason RemovalReason
+}
+
+// trackReplaced records the overwritten state of the node, if it needs to be reported.
+func (c *Cache[K, V]) trackReplaced(oldNode CacheNode[K, V], removed *[]removedNode[K, V]) {
+	if c.onRemove != nil {
+		*removed = append(*removed, removedNode[K, V]{oldNode, RemovalReplaced})
+	}
+}
+
+func (c *Cache[K, V]) notifyRemoved(nodes []removedNode[K, V]) {
+	for _, node := range nodes {
+		if c.onEvict != nil && (node.reason == RemovalCapacity || node.reason == RemovalExpired) {
+			c.onEvict(node.CacheNode)
+		}
+		if c.onRemove != nil {
+			c.onRemove(node.CacheNode, node.reason)
+		}
+	}
+}
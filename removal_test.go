@@ -0,0 +1,129 @@
+package lrutree
+
+import (
+	"testing"
+	"time"
+)
+
+type removal struct {
+	key    string
+	value  int
+	parent string
+	reason RemovalReason
+}
+
+func newRemovalRecorder() (*[]removal, CacheOption[string, int]) {
+	var removals []removal
+	return &removals, WithOnRemove(func(node CacheNode[string, int], reason RemovalReason) {
+		removals = append(removals, removal{node.Key, node.Value, node.ParentKey, reason})
+	})
+}
+
+func TestCache_OnRemove(t *testing.T) {
+	t.Run("Remove reports descendants before parents", func(t *testing.T) {
+		removals, opt := newRemovalRecorder()
+		var evicted []string
+		cache := NewCache[string, int](10, opt, WithOnEvict(func(node CacheNode[string, int]) {
+			evicted = append(evicted, node.Key)
+		}))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Add("a1", 2, "a"))
+		assertNoError(t, cache.Add("a11", 3, "a1"))
+		assertNoError(t, cache.Add("b", 4, "root"))
+
+		assertEqual(t, 3, cache.Remove("a"))
+		assertEqual(t, []removal{
+			{"a11", 3, "a1", RemovalExplicit},
+			{"a1", 2, "a", RemovalExplicit},
+			{"a", 1, "root", RemovalExplicit},
+		}, *removals)
+		assertNil(t, evicted) // WithOnEvict is not called for explicit removals.
+
+		*removals = nil
+		assertEqual(t, 0, cache.Remove("nonexistent"))
+		assertNil(t, *removals)
+	})
+
+	t.Run("capacity eviction and expiration", func(t *testing.T) {
+		removals, opt := newRemovalRecorder()
+		now := time.Now()
+		cache := NewCache[string, int](3, opt)
+		cache.now = func() time.Time { return now }
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.AddWithTTL("b", 2, "root", time.Minute))
+		assertNoError(t, cache.Add("c", 3, "root"))
+		assertEqual(t, []removal{{"a", 1, "root", RemovalCapacity}}, *removals)
+
+		now = now.Add(time.Minute)
+		_, ok := cache.Get("b")
+		assertFalse(t, ok)
+		assertEqual(t, []removal{{"a", 1, "root", RemovalCapacity}, {"b", 2, "root", RemovalExpired}}, *removals)
+	})
+
+	t.Run("AddOrUpdate reports replaced values", func(t *testing.T) {
+		removals, opt := newRemovalRecorder()
+		cache := NewCache[string, int](10, opt)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Add("b", 2, "root"))
+		assertNoError(t, cache.AddOrUpdate("c", 3, "root")) // Insertion is not reported.
+		assertNil(t, *removals)
+
+		assertNoError(t, cache.AddOrUpdate("b", 20, "a"))
+		assertEqual(t, []removal{{"b", 2, "root", RemovalReplaced}}, *removals)
+
+		// Rejected updates are not reported.
+		assertErrorIs(t, cache.AddOrUpdate("a", 10, "b"), ErrCycleDetected)
+		assertEqual(t, 1, len(*removals))
+
+		assertNoError(t, cache.AddOrUpdateBranch([]CacheNode[string, int]{
+			{Key: "a", Value: 10, ParentKey: "root"},
+			{Key: "b", Value: 200, ParentKey: "a"},
+			{Key: "d", Value: 4, ParentKey: "b"},
+		}))
+		assertEqual(t, []removal{
+			{"b", 2, "root", RemovalReplaced},
+			{"a", 1, "root", RemovalReplaced},
+			{"b", 20, "a", RemovalReplaced},
+		}, *removals)
+	})
+
+	t.Run("callbacks are invoked outside the lock", func(t *testing.T) {
+		var cache *Cache[string, int]
+		var removed []string
+		cache = NewCache[string, int](10, WithOnRemove(func(node CacheNode[string, int], reason RemovalReason) {
+			_, ok := cache.Peek(node.Key) // Would deadlock if called under the lock.
+			assertFalse(t, ok)
+			removed = append(removed, node.Key)
+		}))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertEqual(t, 2, cache.Remove("root"))
+		assertEqual(t, []string{"a", "root"}, removed)
+	})
+}
+
+func TestShardedCache_OnRemove(t *testing.T) {
+	var removals []removal
+	cache := NewShardedCache[string, int](2, 10, WithShardOptions(WithOnRemove(func(node CacheNode[string, int], reason RemovalReason) {
+		removals = append(removals, removal{node.Key, node.Value, node.ParentKey, reason})
+	})))
+	assertNoError(t, cache.AddRoot("root", 0))
+	assertNoError(t, cache.Add("a", 1, "root"))
+	assertNoError(t, cache.Add("b", 2, "root"))
+
+	// The root node is reported once, although it's replicated in every shard.
+	assertEqual(t, 3, cache.Remove("root"))
+	assertEqual(t, 3, len(removals))
+	assertEqual(t, removal{"root", 0, "", RemovalExplicit}, removals[len(removals)-1])
+}
+
+func TestRemovalReason_String(t *testing.T) {
+	assertEqual(t, "Capacity", RemovalCapacity.String())
+	assertEqual(t, "Removed", RemovalExplicit.String())
+	assertEqual(t, "Expired", RemovalExpired.String())
+	assertEqual(t, "Replaced", RemovalReplaced.String())
+	assertEqual(t, "Unknown", RemovalReason(-1).String())
+}
@@ -0,0 +1,198 @@
+package lrutree
+
+// Resolve folds the branch of the node with the given key from the root down to the node itself,
+// which is the common way to compute inherited attributes (e.g. an effective setting that may be overridden
+// on any level of the hierarchy, or a sum of rates of all enclosing jurisdictions).
+//
+// The fold starts with init and is called for every node of the branch with the accumulated result.
+// If it returns true as the second value, the remaining nodes are skipped and the accumulated result is returned.
+// It returns false if the node doesn't exist.
+//
+// Like Peek, it doesn't update the LRU order. The branch is copied under the read lock,
+// and fold is called after the lock is released, so it may call methods of the cache.
+// Use NewResolver for repeated lookups of the same fold on hot paths.
+func Resolve[K comparable, V any, R any](
+	c *Cache[K, V], key K, init R, fold func(acc R, node CacheNode[K, V]) (R, bool),
+) (R, bool) {
+	branch, ok := func() ([]CacheNode[K, V], bool) {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+
+		node := c.peekNode(key)
+		if node == nil {
+			c.stats.IncMisses()
+			return nil, false
+		}
+		c.stats.IncHits()
+
+		var branch []CacheNode[K, V]
+		for n := node; n != nil; n = n.parent {
+			branch = append(branch, n.toCacheNode())
+		}
+		return branch, true
+	}()
+	if !ok {
+		return init, false
+	}
+
+	acc := init
+	for i := len(branch) - 1; i >= 0; i-- {
+		var stop bool
+		if acc, stop = fold(acc, branch[i]); stop {
+			break
+		}
+	}
+	return acc, true
+}
+
+// Resolver works like Resolve, but memoizes the folded result of every resolved node,
+// so resolving a node (or its descendant) again takes O(1) time (or O(distance to the nearest resolved ancestor)).
+//
+// Memoized results are invalidated for the whole subtree when the value of the node is updated
+// (by AddOrUpdate, AddOrUpdateBranch or AddChildren), when the node is moved under another parent
+// (by Move or AddOrUpdate), and when it's renamed. They are dropped along with removed nodes.
+// So the fold must depend only on the nodes of the branch it receives.
+//
+// Resolver is safe for concurrent use. Memoized results take memory in the nodes of the cache
+// as long as the nodes exist, so resolvers are intended to be created once for the lifetime of the cache.
+type Resolver[K comparable, V any, R any] struct {
+	cache *Cache[K, V]
+	init  R
+	fold  func(acc R, node CacheNode[K, V]) (R, bool)
+	slot  int // Index of the memoized result in treeNode.memo.
+}
+
+// resolved is a memoized result of a Resolver for a single node.
+type resolved[R any] struct {
+	acc     R
+	stopped bool // The fold was stopped at the node or its ancestor, so descendants get the same result.
+}
+
+// NewResolver creates a Resolver for the cache with the given fold (see Resolve).
+func NewResolver[K comparable, V any, R any](
+	c *Cache[K, V], init R, fold func(acc R, node CacheNode[K, V]) (R, bool),
+) *Resolver[K, V, R] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := &Resolver[K, V, R]{cache: c, init: init, fold: fold, slot: c.resolversCount}
+	c.resolversCount++
+	return r
+}
+
+// Resolve returns the folded result for the node with the given key (see Resolve function for details).
+// It returns false if the node doesn't exist.
+//
+// Memoized results are read under the read lock without any other locking, so resolving memoized nodes
+// scales with concurrent readers. Like in Resolve function, fold is called after the lock is released,
+// so it may call methods of the cache. The results are memoized only if no node was updated, moved or renamed
+// in the meantime; otherwise, they are just returned.
+func (r *Resolver[K, V, R]) Resolve(key K) (R, bool) {
+	res, unresolved, gen, ok := r.lookup(key)
+	if !ok {
+		return r.init, false
+	}
+	if len(unresolved) == 0 {
+		return res.acc, true
+	}
+
+	results := make([]resolved[R], len(unresolved))
+	for i := len(unresolved) - 1; i >= 0; i-- {
+		if !res.stopped {
+			res.acc, res.stopped = r.fold(res.acc, unresolved[i].cacheNode)
+		}
+		results[i] = res
+	}
+
+	c := r.cache
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// Results may be invalidated only under the exclusive lock, which increments the generation,
+	// so if it's the same, the folded branch is still up to date.
+	if c.memoGen == gen {
+		for i := range unresolved {
+			r.memoize(unresolved[i].node, results[i])
+		}
+	}
+	return res.acc, true
+}
+
+// unresolvedNode is a node of the branch without a memoized result, copied to be folded outside the lock.
+type unresolvedNode[K comparable, V any] struct {
+	node      *treeNode[K, V]
+	cacheNode CacheNode[K, V]
+}
+
+// lookup returns the memoized result of the nearest resolved ancestor of the node (or the node itself)
+// and the nodes below it that are still to be folded (from the node up), along with the current memo generation.
+func (r *Resolver[K, V, R]) lookup(key K) (res resolved[R], unresolved []unresolvedNode[K, V], gen uint64, ok bool) {
+	c := r.cache
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	node := c.peekNode(key)
+	if node == nil {
+		c.stats.IncMisses()
+		return res, nil, 0, false
+	}
+	c.stats.IncHits()
+
+	res = resolved[R]{acc: r.init}
+	for n := node; n != nil; n = n.parent {
+		if memoized, found := r.memoized(n); found {
+			res = memoized
+			break
+		}
+		unresolved = append(unresolved, unresolvedNode[K, V]{node: n, cacheNode: n.toCacheNode()})
+	}
+	return res, unresolved, c.memoGen, true
+}
+
+func (r *Resolver[K, V, R]) memoized(node *treeNode[K, V]) (resolved[R], bool) {
+	memo := node.memo.Load()
+	if memo == nil || len(*memo) <= r.slot || (*memo)[r.slot] == nil {
+		return resolved[R]{}, false
+	}
+	return (*memo)[r.slot].(resolved[R]), true
+}
+
+// memoize stores the result for the node. It's called under the read lock,
+// so concurrent resolvers replace the memo slice of the node with an updated copy.
+func (r *Resolver[K, V, R]) memoize(node *treeNode[K, V], res resolved[R]) {
+	for {
+		old := node.memo.Load()
+		var memo []any
+		if old != nil {
+			memo = append(memo, *old...)
+		}
+		if len(memo) <= r.slot {
+			memo = append(memo, make([]any, r.slot+1-len(memo))...)
+		}
+		memo[r.slot] = res
+		if node.memo.CompareAndSwap(old, &memo) {
+			return
+		}
+	}
+}
+
+// invalidateMemo drops results memoized by resolvers for the node and its descendants.
+// It must be called under the exclusive lock.
+func (c *Cache[K, V]) invalidateMemo(node *treeNode[K, V]) {
+	if c.resolversCount == 0 {
+		return
+	}
+	// Resolvers that folded the branch before the change don't memoize their results.
+	c.memoGen++
+	c.dropMemo(node)
+}
+
+func (c *Cache[K, V]) dropMemo(node *treeNode[K, V]) {
+	if node.memo.Load() == nil {
+		return // Descendants can't have memoized results without the node.
+	}
+	node.memo.Store(nil)
+	for _, child := range node.children {
+		c.dropMemo(child)
+	}
+}
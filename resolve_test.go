@@ -0,0 +1,190 @@
+package lrutree
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	// sumFold sums values of the branch, stopping at a negative value.
+	sumFold := func(calls *int) func(acc int, node CacheNode[string, int]) (int, bool) {
+		return func(acc int, node CacheNode[string, int]) (int, bool) {
+			if calls != nil {
+				*calls++
+			}
+			if node.Value < 0 {
+				return acc, true
+			}
+			return acc + node.Value, false
+		}
+	}
+	newCache := func() *Cache[string, int] {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("a", 10, "root"))
+		assertNoError(t, cache.Add("a1", 100, "a"))
+		assertNoError(t, cache.Add("a11", 1000, "a1"))
+		assertNoError(t, cache.Add("b", -1, "root"))
+		assertNoError(t, cache.Add("b1", 200, "b"))
+		return cache
+	}
+
+	t.Run("Resolve", func(t *testing.T) {
+		cache := newCache()
+		lruOrder := getLRUOrder(cache)
+
+		var visited []string
+		res, ok := Resolve(cache, "a11", 0, func(acc int, node CacheNode[string, int]) (int, bool) {
+			visited = append(visited, node.Key)
+			return acc + node.Value, false
+		})
+		assertTrue(t, ok)
+		assertEqual(t, 1111, res)
+		assertEqual(t, []string{"root", "a", "a1", "a11"}, visited)
+
+		res, ok = Resolve(cache, "b1", 0, sumFold(nil))
+		assertTrue(t, ok)
+		assertEqual(t, 1, res)
+
+		res, ok = Resolve(cache, "nonexistent", 5, sumFold(nil))
+		assertFalse(t, ok)
+		assertEqual(t, 5, res)
+
+		// Resolve doesn't update the LRU order.
+		assertEqual(t, lruOrder, getLRUOrder(cache))
+	})
+
+	t.Run("Resolver memoizes results", func(t *testing.T) {
+		cache := newCache()
+		calls := 0
+		resolver := NewResolver(cache, 0, sumFold(&calls))
+
+		res, ok := resolver.Resolve("a1")
+		assertTrue(t, ok)
+		assertEqual(t, 111, res)
+		assertEqual(t, 3, calls)
+
+		// Results of the node and its ancestors are memoized.
+		for key, expected := range map[string]int{"root": 1, "a": 11, "a1": 111} {
+			res, ok = resolver.Resolve(key)
+			assertTrue(t, ok)
+			assertEqual(t, expected, res)
+		}
+		assertEqual(t, 3, calls)
+
+		// Only the rest of the branch is folded for a descendant.
+		res, _ = resolver.Resolve("a11")
+		assertEqual(t, 1111, res)
+		assertEqual(t, 4, calls)
+
+		// Descendants of a stopped node get the same result without folding.
+		res, _ = resolver.Resolve("b1")
+		assertEqual(t, 1, res)
+		assertEqual(t, 5, calls)
+
+		_, ok = resolver.Resolve("nonexistent")
+		assertFalse(t, ok)
+	})
+
+	t.Run("Resolver results are invalidated", func(t *testing.T) {
+		resolveAll := func(resolver *Resolver[string, int, int], keys ...string) []int {
+			results := make([]int, len(keys))
+			for i, key := range keys {
+				results[i], _ = resolver.Resolve(key)
+			}
+			return results
+		}
+
+		cache := newCache()
+		resolver := NewResolver(cache, 0, sumFold(nil))
+		otherResolver := NewResolver(cache, 0, func(acc int, node CacheNode[string, int]) (int, bool) {
+			return acc + 1, false
+		})
+		assertEqual(t, []int{1, 11, 111, 1111, 1, 1}, resolveAll(resolver, "root", "a", "a1", "a11", "b", "b1"))
+		assertEqual(t, []int{1, 2, 3, 4}, resolveAll(otherResolver, "root", "a", "a1", "a11"))
+
+		// Updating the value invalidates the subtree.
+		assertNoError(t, cache.AddOrUpdate("a", 20, "root"))
+		assertEqual(t, []int{1, 21, 121, 1121, 1, 1}, resolveAll(resolver, "root", "a", "a1", "a11", "b", "b1"))
+
+		// Updating the value of a stopping node makes the fold continue.
+		assertNoError(t, cache.AddOrUpdate("b", 2, "root"))
+		assertEqual(t, []int{3, 203}, resolveAll(resolver, "b", "b1"))
+
+		// Moving invalidates the moved subtree.
+		assertNoError(t, cache.Move("a1", "b"))
+		assertEqual(t, []int{103, 1103}, resolveAll(resolver, "a1", "a11"))
+		assertEqual(t, []int{1, 2, 3, 4}, resolveAll(otherResolver, "root", "b", "a1", "a11"))
+
+		// Updating the root invalidates everything.
+		assertNoError(t, cache.AddOrUpdateBranch([]CacheNode[string, int]{{Key: "root", Value: -1}}))
+		assertEqual(t, []int{0, 0, 0, 0}, resolveAll(resolver, "a", "b", "a1", "a11"))
+
+		// Removed nodes are not resolved, and re-added nodes are folded again.
+		cache.Remove("a11")
+		_, ok := resolver.Resolve("a11")
+		assertFalse(t, ok)
+		assertNoError(t, cache.AddOrUpdateBranch([]CacheNode[string, int]{{Key: "root", Value: 1}}))
+		assertNoError(t, cache.Add("a11", 5000, "a1"))
+		assertEqual(t, []int{5103}, resolveAll(resolver, "a11"))
+	})
+
+	t.Run("Resolver with key-dependent fold is invalidated on rename", func(t *testing.T) {
+		cache := newCache()
+		resolver := NewResolver(cache, "", func(acc string, node CacheNode[string, int]) (string, bool) {
+			return acc + "/" + node.Key, false
+		})
+		res, _ := resolver.Resolve("a11")
+		assertEqual(t, "/root/a/a1/a11", res)
+		assertNoError(t, cache.Rename("a", "x"))
+		res, _ = resolver.Resolve("a11")
+		assertEqual(t, "/root/x/a1/a11", res)
+	})
+
+	t.Run("fold may call methods of the cache", func(t *testing.T) {
+		cache := newCache()
+		res, ok := Resolve(cache, "a1", 0, func(acc int, node CacheNode[string, int]) (int, bool) {
+			val, _ := cache.Peek(node.Key)
+			return acc + val.Value, false
+		})
+		assertTrue(t, ok)
+		assertEqual(t, 111, res)
+
+		// The value of "a" is updated while its branch is being folded, so the stale result is not memoized.
+		updated := false
+		resolver := NewResolver(cache, 0, func(acc int, node CacheNode[string, int]) (int, bool) {
+			if node.Key == "a" && !updated {
+				updated = true
+				assertNoError(t, cache.AddOrUpdate("a", 20, "root"))
+			}
+			return acc + node.Value, false
+		})
+		res, _ = resolver.Resolve("a1")
+		assertEqual(t, 111, res)
+		res, _ = resolver.Resolve("a1")
+		assertEqual(t, 121, res)
+	})
+
+	t.Run("Resolver concurrent use", func(t *testing.T) {
+		cache := newCache()
+		resolver := NewResolver(cache, 0, sumFold(nil))
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					res, ok := resolver.Resolve("a11")
+					assertTrue(t, ok)
+					assertTrue(t, res == 1111 || res == 1121)
+					if j == 50 {
+						_ = cache.AddOrUpdate("a", 20, "root")
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		res, _ := resolver.Resolve("a11")
+		assertEqual(t, 1121, res)
+	})
+}
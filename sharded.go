@@ -0,0 +1,680 @@
+package lrutree
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShardedCache is a hierarchical cache partitioned into several shards to reduce lock contention
+// in write-heavy workloads.
+//
+// Sharding by key hash would break the guarantee that all ancestors of a cached node are cached too,
+// so the tree is partitioned by first-level subtrees instead: every child of the root node and all its
+// descendants live in the same shard. The root node is replicated in every shard.
+// Each shard is a Cache with its own lock, LRU list and share of the total capacity,
+// so eviction happens independently in every shard.
+//
+// ShardedCache exposes the main API of Cache for adding, loading, reading, traversing, pinning and removing nodes.
+// Methods that work with several first-level subtrees at once or with the state of the whole cache
+// (e.g. Move, Rename, AddPath, AddNegative, iterators, ancestry queries, subtree quotas and snapshots)
+// are not provided, so a single Cache should be used if they are needed.
+// Len, Cost and stats are aggregated over all shards (stats only when a StatsCollector is set via shard options).
+type ShardedCache[K comparable, V any] struct {
+	shards    []*Cache[K, V]
+	shardFunc func(topKey K) int
+	shardOpts []CacheOption[K, V]
+	nextShard atomic.Uint64
+	index     sync.Map // Maps keys of nodes to indexes of shards they live in (the replicated root node to any of them).
+	rootMu    sync.Mutex
+	rootKey   atomic.Pointer[K]
+	amounts   []atomic.Int64
+	costs     []atomic.Int64
+}
+
+// ShardedCacheOption represents options for the ShardedCache.
+type ShardedCacheOption[K comparable, V any] func(*ShardedCache[K, V])
+
+// WithShardFunc sets a function that selects a shard for a first-level node (a direct child of the root)
+// by its key. All descendants of the node are stored in the same shard.
+// The returned value is taken modulo the number of shards.
+// By default, first-level nodes are distributed among shards in round-robin fashion.
+func WithShardFunc[K comparable, V any](shardFunc func(topKey K) int) ShardedCacheOption[K, V] {
+	return func(sc *ShardedCache[K, V]) {
+		sc.shardFunc = shardFunc
+	}
+}
+
+// WithShardOptions sets options applied to every shard (e.g. WithOnEvict, WithStatsCollector, WithTTL).
+func WithShardOptions[K comparable, V any](options ...CacheOption[K, V]) ShardedCacheOption[K, V] {
+	return func(sc *ShardedCache[K, V]) {
+		sc.shardOpts = append(sc.shardOpts, options...)
+	}
+}
+
+// NewShardedCache creates a new sharded cache with the given number of shards and the total maximum
+// number of entries. The capacity is split evenly among shards (a copy of the root node in every shard
+// is not counted).
+func NewShardedCache[K comparable, V any](shardsNum int, maxEntries int, options ...ShardedCacheOption[K, V]) *ShardedCache[K, V] {
+	if shardsNum < 1 {
+		shardsNum = 1
+	}
+	sc := &ShardedCache[K, V]{
+		shards:  make([]*Cache[K, V], shardsNum),
+		amounts: make([]atomic.Int64, shardsNum),
+		costs:   make([]atomic.Int64, shardsNum),
+	}
+	for _, opt := range options {
+		opt(sc)
+	}
+
+	shardMaxEntries := 0
+	if maxEntries > 0 {
+		shardMaxEntries = (maxEntries+shardsNum-1)/shardsNum + 1 // +1 for the root node copy.
+	}
+	for i := range sc.shards {
+		shard := NewCache[K, V](shardMaxEntries, sc.shardOpts...)
+		idx := i
+		shard.mu.Lock()
+		shard.onInsert = func(key K) {
+			sc.index.Store(key, idx)
+		}
+		shard.onDelete = func(key K) {
+			sc.index.CompareAndDelete(key, idx)
+		}
+		shard.claimKey = func(key K) bool {
+			// Keys are claimed under the lock of the shard, and a key is mapped to a shard only while
+			// the shard stores it (or is about to store it under the same lock), so it can't be added twice.
+			claimedIdx, _ := sc.index.LoadOrStore(key, idx)
+			return claimedIdx.(int) == idx
+		}
+		shard.rootReplica = idx != 0
+		shard.multipleRoots = false // The root node is replicated in every shard, so there can be only one.
+		if _, isNull := shard.stats.(nullStats); !isNull {
+			stats := &shardStats[K, V]{StatsCollector: shard.stats, sc: sc, shard: shard, idx: idx}
+			shard.stats = stats
+			if shard.costStats != nil {
+				stats.costStats = shard.costStats
+				shard.costStats = stats
+			}
+		}
+		shard.mu.Unlock()
+		sc.shards[i] = shard
+	}
+	return sc
+}
+
+// Close stops background goroutines of all shards.
+func (sc *ShardedCache[K, V]) Close() {
+	for _, shard := range sc.shards {
+		shard.Close()
+	}
+}
+
+// Len returns the number of items currently stored in the cache.
+// The root node is counted once.
+func (sc *ShardedCache[K, V]) Len() int {
+	total := 0
+	for _, shard := range sc.shards {
+		total += shard.Len()
+	}
+	if sc.rootKey.Load() != nil && total > 0 {
+		total -= len(sc.shards) - 1
+	}
+	return total
+}
+
+// Cost returns the total cost of items currently stored in the cache.
+// The root node is counted once.
+func (sc *ShardedCache[K, V]) Cost() int64 {
+	var total int64
+	for i, shard := range sc.shards {
+		shard.mu.RLock()
+		total += shard.totalCost
+		if i != 0 {
+			for _, root := range shard.roots {
+				total -= root.cost
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return total
+}
+
+// AddRoot initializes the cache with a root node. The root node is replicated in every shard.
+func (sc *ShardedCache[K, V]) AddRoot(key K, val V) error {
+	sc.rootMu.Lock()
+	defer sc.rootMu.Unlock()
+
+	return sc.addRoot(key, val)
+}
+
+// addRoot adds the root node to every shard. It must be called under rootMu.
+func (sc *ShardedCache[K, V]) addRoot(key K, val V) error {
+	if sc.rootKey.Load() != nil {
+		return ErrRootAlreadyExists
+	}
+	for _, shard := range sc.shards {
+		if err := shard.AddRoot(key, val); err != nil {
+			return err
+		}
+	}
+	sc.rootKey.Store(&key)
+	return nil
+}
+
+// Add inserts a new node into the cache as a child of the specified parent.
+// See Cache.Add for details.
+func (sc *ShardedCache[K, V]) Add(key K, val V, parentKey K) error {
+	return sc.add(key, val, parentKey, func(shard *Cache[K, V]) error {
+		return shard.Add(key, val, parentKey)
+	})
+}
+
+// AddWithTTL works like Add, but the node expires after the given TTL.
+// See Cache.AddWithTTL for details.
+func (sc *ShardedCache[K, V]) AddWithTTL(key K, val V, parentKey K, ttl time.Duration) error {
+	return sc.add(key, val, parentKey, func(shard *Cache[K, V]) error {
+		return shard.AddWithTTL(key, val, parentKey, ttl)
+	})
+}
+
+// AddPinned works like Add, but the node is pinned right away.
+// See Cache.AddPinned for details.
+func (sc *ShardedCache[K, V]) AddPinned(key K, val V, parentKey K) error {
+	return sc.add(key, val, parentKey, func(shard *Cache[K, V]) error {
+		return shard.AddPinned(key, val, parentKey)
+	})
+}
+
+// AddOrUpdate adds a new node or updates an existing node in the cache.
+// See Cache.AddOrUpdate for details.
+//
+// Reparenting a node to a parent stored in another shard moves the node with its whole subtree to that shard.
+func (sc *ShardedCache[K, V]) AddOrUpdate(key K, val V, parentKey K) error {
+	return sc.addOrUpdate(key, val, parentKey, -1)
+}
+
+// AddOrUpdateWithTTL works like AddOrUpdate, but the node expires after the given TTL.
+// See Cache.AddOrUpdateWithTTL for details.
+func (sc *ShardedCache[K, V]) AddOrUpdateWithTTL(key K, val V, parentKey K, ttl time.Duration) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	return sc.addOrUpdate(key, val, parentKey, ttl)
+}
+
+// AddBranch inserts a whole branch into the cache in one call.
+// See Cache.AddBranch for details.
+//
+// The branch is inserted atomically into the shard of its first-level node.
+// If the branch starts with the root node that is missing, the root node is added to every shard first.
+func (sc *ShardedCache[K, V]) AddBranch(branch []CacheNode[K, V]) error {
+	defer sc.shards[0].observe(OpAddBranch)()
+
+	_, err := sc.addBranch(branch, false)
+	return err
+}
+
+// AddOrUpdateBranch works like AddBranch, but existing nodes are updated with the values from the branch
+// and reparented if their parents differ from the branch. See Cache.AddOrUpdateBranch for details.
+//
+// Unlike AddOrUpdate, it doesn't move nodes between shards: ErrAlreadyExists is returned if a node of the branch
+// is stored in another shard than the first-level node of the branch. If the branch starts with the root node,
+// its value is updated in other shards right after the branch is inserted.
+func (sc *ShardedCache[K, V]) AddOrUpdateBranch(branch []CacheNode[K, V]) error {
+	defer sc.shards[0].observe(OpAddBranch)()
+
+	_, err := sc.addBranch(branch, true)
+	return err
+}
+
+func (sc *ShardedCache[K, V]) addBranch(branch []CacheNode[K, V], update bool) (CacheNode[K, V], error) {
+	if _, err := checkBranch(branch); err != nil {
+		return CacheNode[K, V]{}, err
+	}
+
+	var zeroKey K
+	if sc.isRoot(branch[0].Key) || branch[0].ParentKey == zeroKey {
+		// The root node must not be added or removed while the branch is inserted.
+		sc.rootMu.Lock()
+		defer sc.rootMu.Unlock()
+	}
+
+	// rest is the part of the branch below the root node.
+	rest := branch
+	existingRoot := false
+	switch {
+	case sc.isRoot(branch[0].Key):
+		rest = branch[1:]
+		existingRoot = true
+	case branch[0].ParentKey != zeroKey || sc.isRoot(zeroKey):
+		// The branch starts with a non-root node.
+	case sc.rootKey.Load() != nil:
+		return CacheNode[K, V]{}, ErrRootAlreadyExists
+	default:
+		if err := sc.addRoot(branch[0].Key, branch[0].Value); err != nil {
+			return CacheNode[K, V]{}, err
+		}
+		if len(branch) == 1 {
+			return CacheNode[K, V]{Key: branch[0].Key, Value: branch[0].Value}, nil
+		}
+		branch, rest = branch[1:], branch[1:]
+	}
+
+	if len(rest) == 0 {
+		if update {
+			return branch[0], sc.updateRoot(branch[0], -1)
+		}
+		return CacheNode[K, V]{Key: branch[0].Key, Value: branch[0].Value}, nil
+	}
+
+	idx, ok := sc.shardForChild(rest[0].Key, rest[0].ParentKey)
+	if !ok {
+		return CacheNode[K, V]{}, ErrParentNotExist
+	}
+	// Keys of new nodes are claimed by the shard, so ErrAlreadyExists is returned
+	// if any node of the branch is stored in another shard.
+	leaf, err := sc.shards[idx].addBranch(branch, update)
+	if err != nil {
+		return CacheNode[K, V]{}, err
+	}
+
+	if update && existingRoot {
+		if err = sc.updateRoot(branch[0], idx); err != nil {
+			return CacheNode[K, V]{}, err
+		}
+	}
+	return leaf, nil
+}
+
+// updateRoot updates the value of the root node in every shard except the skipped one. It must be called under rootMu.
+func (sc *ShardedCache[K, V]) updateRoot(root CacheNode[K, V], skipIdx int) error {
+	for i, shard := range sc.shards {
+		if i == skipIdx {
+			continue
+		}
+		if _, err := shard.addBranch([]CacheNode[K, V]{root}, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetOrLoad returns the node with the given key, loading it together with its missing ancestors if needed.
+// See Cache.GetOrLoad for details.
+//
+// The loader is set for every shard via WithShardOptions and WithLoader.
+// Concurrent calls for the same key are de-duplicated across all shards.
+func (sc *ShardedCache[K, V]) GetOrLoad(ctx context.Context, key K) (CacheNode[K, V], error) {
+	shard := sc.shards[0]
+	defer shard.observe(OpGetOrLoad)()
+
+	switch cacheNode, status := sc.shardOf(key).Lookup(key); status {
+	case LookupHit:
+		return cacheNode, nil
+	case LookupAbsent:
+		return CacheNode[K, V]{}, ErrKnownAbsent
+	}
+	if shard.loader == nil {
+		return CacheNode[K, V]{}, ErrLoaderNotSet
+	}
+	return shard.loadOnce(ctx, key, func(ctx context.Context) (CacheNode[K, V], error) {
+		branch, err := shard.loadBranch(ctx, key, sc.contains)
+		if err != nil {
+			return CacheNode[K, V]{}, err
+		}
+		return sc.addBranch(branch, false)
+	})
+}
+
+// contains reports whether the non-expired node with the given key is present in the cache.
+func (sc *ShardedCache[K, V]) contains(key K) bool {
+	return sc.shardOf(key).contains(key)
+}
+
+// Get retrieves a value from the cache and updates LRU order.
+// See Cache.Get for details.
+func (sc *ShardedCache[K, V]) Get(key K) (CacheNode[K, V], bool) {
+	return sc.shardOf(key).Get(key)
+}
+
+// Peek returns the value of the node with the given key without updating the LRU order.
+// See Cache.Peek for details.
+func (sc *ShardedCache[K, V]) Peek(key K) (CacheNode[K, V], bool) {
+	return sc.shardOf(key).Peek(key)
+}
+
+// GetBranch returns the path from the root to the specified key and updates LRU order.
+// See Cache.GetBranch for details.
+func (sc *ShardedCache[K, V]) GetBranch(key K) []CacheNode[K, V] {
+	return sc.shardOf(key).GetBranch(key)
+}
+
+// PeekBranch returns the path from the root to the specified key without updating the LRU order.
+// See Cache.PeekBranch for details.
+func (sc *ShardedCache[K, V]) PeekBranch(key K) []CacheNode[K, V] {
+	return sc.shardOf(key).PeekBranch(key)
+}
+
+// TraverseToRoot walks the path from the specified node up to the root node.
+// See Cache.TraverseToRoot for details.
+func (sc *ShardedCache[K, V]) TraverseToRoot(key K, f func(key K, val V, parentKey K)) {
+	sc.shardOf(key).TraverseToRoot(key, f)
+}
+
+// PeekToRoot walks the path from the specified node up to the root node without updating the LRU order.
+// See Cache.PeekToRoot for details.
+func (sc *ShardedCache[K, V]) PeekToRoot(key K, f func(key K, val V, parentKey K)) {
+	sc.shardOf(key).PeekToRoot(key, f)
+}
+
+// TraverseSubtree performs a depth-first traversal of all nodes in the subtree rooted at the specified node.
+// See Cache.TraverseSubtree for details.
+//
+// When traversing from the root node, shards are traversed one by one (the root node is visited once),
+// so the traversal is not atomic across shards, and WithTraversalOrder and WithChildOrder apply within each shard.
+func (sc *ShardedCache[K, V]) TraverseSubtree(key K, f func(key K, val V, parentKey K), options ...TraverseSubtreeOption) {
+	sc.traverseSubtree(key, f, options, (*Cache[K, V]).TraverseSubtree)
+}
+
+// PeekSubtree performs a traversal of all nodes in the subtree rooted at the specified node
+// without updating the LRU order. See Cache.PeekSubtree and ShardedCache.TraverseSubtree for details.
+func (sc *ShardedCache[K, V]) PeekSubtree(key K, f func(key K, val V, parentKey K), options ...TraverseSubtreeOption) {
+	sc.traverseSubtree(key, f, options, (*Cache[K, V]).PeekSubtree)
+}
+
+// WithChildOrder returns an option that makes TraverseSubtree and PeekSubtree visit children of every node
+// in the order defined by cmp. See Cache.WithChildOrder for details.
+func (sc *ShardedCache[K, V]) WithChildOrder(cmp func(a, b K) int) TraverseSubtreeOption {
+	return sc.shards[0].WithChildOrder(cmp)
+}
+
+func (sc *ShardedCache[K, V]) traverseSubtree(
+	key K,
+	f func(key K, val V, parentKey K),
+	options []TraverseSubtreeOption,
+	traverse func(shard *Cache[K, V], key K, f func(key K, val V, parentKey K), options ...TraverseSubtreeOption),
+) {
+	if !sc.isRoot(key) {
+		traverse(sc.shardOf(key), key, f, options...)
+		return
+	}
+	traverse(sc.shards[0], key, f, options...)
+	for _, shard := range sc.shards[1:] {
+		traverse(shard, key, func(k K, val V, parentKey K) {
+			if k != key { // The root node is already visited in the first shard.
+				f(k, val, parentKey)
+			}
+		}, options...)
+	}
+}
+
+// Pin marks the node as pinned, so it's never evicted because of the capacity limit.
+// See Cache.Pin for details.
+func (sc *ShardedCache[K, V]) Pin(key K) bool {
+	return sc.forNode(key, (*Cache[K, V]).Pin)
+}
+
+// Unpin removes the pin from the node, so it may be evicted again.
+// See Cache.Unpin for details.
+func (sc *ShardedCache[K, V]) Unpin(key K) bool {
+	return sc.forNode(key, (*Cache[K, V]).Unpin)
+}
+
+// forNode calls f for the shard that stores the node with the given key, or for every shard if it's the root node.
+func (sc *ShardedCache[K, V]) forNode(key K, f func(shard *Cache[K, V], key K) bool) bool {
+	if !sc.isRoot(key) {
+		return f(sc.shardOf(key), key)
+	}
+	ok := true
+	for _, shard := range sc.shards {
+		ok = f(shard, key) && ok
+	}
+	return ok
+}
+
+// Remove deletes a node and all its descendants from the cache.
+// It returns the total number of nodes removed from the cache.
+func (sc *ShardedCache[K, V]) Remove(key K) int {
+	if !sc.isRoot(key) {
+		return sc.shardOf(key).Remove(key)
+	}
+
+	sc.rootMu.Lock()
+	defer sc.rootMu.Unlock()
+
+	if !sc.isRoot(key) {
+		return 0
+	}
+	// Removal of the root node is reported only by the first shard, so it's processed last
+	// to report descendants before the root node.
+	removedCount := 0
+	for i := len(sc.shards) - 1; i >= 0; i-- {
+		removedCount += sc.shards[i].Remove(key)
+	}
+	sc.rootKey.Store(nil)
+	return removedCount - (len(sc.shards) - 1)
+}
+
+func (sc *ShardedCache[K, V]) isRoot(key K) bool {
+	rootKey := sc.rootKey.Load()
+	return rootKey != nil && *rootKey == key
+}
+
+// shardOf returns the shard that stores the node with the given key.
+// For a missing key, the first shard is returned, so the miss is accounted in stats there.
+func (sc *ShardedCache[K, V]) shardOf(key K) *Cache[K, V] {
+	if idx, ok := sc.index.Load(key); ok {
+		return sc.shards[idx.(int)]
+	}
+	return sc.shards[0]
+}
+
+// shardForChild returns the index of the shard where a child of the given parent should be stored.
+// A node that is already stored in the cache stays in its shard, so its subtree is not moved to another one.
+func (sc *ShardedCache[K, V]) shardForChild(key K, parentKey K) (int, bool) {
+	if sc.isRoot(parentKey) {
+		if idx, ok := sc.index.Load(key); ok {
+			return idx.(int), true
+		}
+		if sc.shardFunc != nil {
+			idx := sc.shardFunc(key) % len(sc.shards)
+			if idx < 0 {
+				idx += len(sc.shards)
+			}
+			return idx, true
+		}
+		return int(sc.nextShard.Add(1) % uint64(len(sc.shards))), true
+	}
+	idx, ok := sc.index.Load(parentKey)
+	if !ok {
+		return 0, false
+	}
+	return idx.(int), true
+}
+
+func (sc *ShardedCache[K, V]) add(key K, val V, parentKey K, addToShard func(shard *Cache[K, V]) error) error {
+	if sc.isRoot(key) {
+		return ErrAlreadyExists
+	}
+	idx, ok := sc.shardForChild(key, parentKey)
+	if !ok {
+		return ErrParentNotExist
+	}
+	// The key is claimed by the shard under its lock, so ErrAlreadyExists is returned if it's stored in another shard.
+	return addToShard(sc.shards[idx])
+}
+
+func (sc *ShardedCache[K, V]) addOrUpdate(key K, val V, parentKey K, ttl time.Duration) error {
+	if sc.isRoot(key) {
+		sc.shards[0].reportCycleRejection()
+		return ErrCycleDetected
+	}
+	for {
+		idx, ok := sc.shardForChild(key, parentKey)
+		if !ok {
+			return ErrParentNotExist
+		}
+		if existingIdx, exists := sc.index.Load(key); exists && existingIdx.(int) != idx {
+			err := sc.moveToShard(key, val, parentKey, ttl, existingIdx.(int), idx)
+			if errors.Is(err, errShardChanged) {
+				continue // The node has been moved or removed concurrently.
+			}
+			return err
+		}
+		var err error
+		if ttl < 0 {
+			err = sc.shards[idx].AddOrUpdate(key, val, parentKey)
+		} else {
+			err = sc.shards[idx].AddOrUpdateWithTTL(key, val, parentKey, ttl)
+		}
+		if errors.Is(err, ErrAlreadyExists) {
+			continue // The node has been added to another shard concurrently, so it has to be moved.
+		}
+		return err
+	}
+}
+
+// errShardChanged is returned by moveToShard if the node is not stored in the source shard anymore.
+var errShardChanged = errors.New("node is not stored in the shard")
+
+// moveToShard moves the node with its subtree from the source shard to the destination shard
+// under the new parent, updating its value. A negative TTL means the default TTL of the destination shard.
+func (sc *ShardedCache[K, V]) moveToShard(key K, val V, parentKey K, ttl time.Duration, srcIdx, dstIdx int) error {
+	src, dst := sc.shards[srcIdx], sc.shards[dstIdx]
+	if ttl < 0 {
+		ttl = dst.defaultTTL
+	}
+
+	var srcEvicted, dstEvicted []removedNode[K, V]
+	defer func() {
+		src.notifyRemoved(srcEvicted)
+		dst.notifyRemoved(dstEvicted)
+	}()
+
+	// Lock shards in the same order to avoid deadlocks.
+	first, second := src, dst
+	if dstIdx < srcIdx {
+		first, second = dst, src
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	second.mu.Lock()
+	defer second.mu.Unlock()
+
+	now := dst.now()
+
+	parent, parentExists := dst.keysMap[parentKey]
+	if parentExists && dst.reapIfExpired(parent, now, &dstEvicted) {
+		parentExists = false
+	}
+	if !parentExists {
+		return ErrParentNotExist
+	}
+
+	node, exists := src.keysMap[key]
+	if !exists || src.reapIfExpired(node, now, &srcEvicted) {
+		sc.index.CompareAndDelete(key, srcIdx) // Drop the mapping if it's stale.
+		return errShardChanged
+	}
+
+	// Collect the subtree in pre-order, so parents are inserted into the destination shard before children.
+	type movedNode struct {
+		node   *treeNode[K, V]
+		parent *treeNode[K, V]
+		pinned bool
+	}
+	var subtree []movedNode
+	var collect func(n *treeNode[K, V])
+	collect = func(n *treeNode[K, V]) {
+		subtree = append(subtree, movedNode{node: n, parent: n.parent, pinned: n.pinned})
+		for _, child := range n.children {
+			collect(child)
+		}
+	}
+	collect(node)
+	for _, mn := range subtree {
+		if _, exists := dst.keysMap[mn.node.key]; exists {
+			return ErrAlreadyExists // Can't happen while every key is claimed by a single shard.
+		}
+	}
+
+	// Keys are remapped to the destination shard before they are deleted from the source one,
+	// so they are never unmapped and can't be claimed by another shard in the meantime.
+	for _, mn := range subtree {
+		sc.index.Store(mn.node.key, dstIdx)
+	}
+	dst.trackReplaced(node.toCacheNode(), &dstEvicted)
+	src.removeSubtree(node, nil)
+	src.reportAmount()
+	dst.reportUpdate(true)
+
+	moved := make(map[*treeNode[K, V]]*treeNode[K, V], len(subtree))
+	for i, mn := range subtree {
+		if i == 0 {
+			moved[mn.node] = dst.insertNode(key, val, parent)
+			dst.setPinned(moved[mn.node], mn.pinned)
+			continue
+		}
+		newNode := dst.insertNode(mn.node.key, mn.node.val, moved[mn.parent])
+		dst.setExpiresAt(newNode, mn.node.expiresAt)
+		dst.setPinned(newNode, mn.pinned)
+		moved[mn.node] = newNode
+	}
+	node = moved[subtree[0].node]
+	dst.setExpiration(node, expirationTime(now, ttl))
+
+	// Keep parents in front of their descendants in the LRU list.
+	for i := len(subtree) - 1; i >= 0; i-- {
+		dst.promote(moved[subtree[i].node])
+	}
+	for n := node.parent; n != nil; n = n.parent {
+		dst.promote(n)
+	}
+
+	dst.evictIfNeeded(&dstEvicted, nil)
+
+	dst.reportAmount()
+
+	return nil
+}
+
+// shardStats aggregates amounts and costs reported by shards, so the underlying collector receives totals.
+type shardStats[K comparable, V any] struct {
+	StatsCollector
+	costStats CostStatsCollector
+	sc        *ShardedCache[K, V]
+	shard     *Cache[K, V]
+	idx       int
+}
+
+// SetAmount is called under the shard lock.
+func (s *shardStats[K, V]) SetAmount(amount int) {
+	if s.idx != 0 {
+		amount -= len(s.shard.roots) // The root node is replicated in every shard, so it's counted only in the first one.
+	}
+	s.sc.amounts[s.idx].Store(int64(amount))
+	var total int64
+	for i := range s.sc.amounts {
+		total += s.sc.amounts[i].Load()
+	}
+	s.StatsCollector.SetAmount(int(total))
+}
+
+// SetCost is called under the shard lock.
+func (s *shardStats[K, V]) SetCost(cost int64) {
+	if s.idx != 0 {
+		for _, root := range s.shard.roots {
+			cost -= root.cost
+		}
+	}
+	s.sc.costs[s.idx].Store(cost)
+	var total int64
+	for i := range s.sc.costs {
+		total += s.sc.costs[i].Load()
+	}
+	s.costStats.SetCost(total)
+}
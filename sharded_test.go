@@ -0,0 +1,446 @@
+package lrutree
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// shardByNumberSuffix places the first-level node "tenant-N" to the shard N.
+func shardByNumberSuffix(topKey string) int {
+	n, _ := strconv.Atoi(topKey[strings.LastIndex(topKey, "-")+1:])
+	return n
+}
+
+func TestShardedCache(t *testing.T) {
+	t.Run("basic operations", func(t *testing.T) {
+		cache := NewShardedCache[string, int](2, 0, WithShardFunc[string, int](shardByNumberSuffix))
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertErrorIs(t, cache.AddRoot("root", 1), ErrRootAlreadyExists)
+
+		assertNoError(t, cache.Add("tenant-0", 10, "root"))
+		assertNoError(t, cache.Add("tenant-1", 20, "root"))
+		assertNoError(t, cache.Add("dept-0", 11, "tenant-0"))
+		assertNoError(t, cache.Add("dept-1", 21, "tenant-1"))
+		assertNoError(t, cache.AddWithTTL("team-1", 22, "dept-1", 0))
+		assertEqual(t, 6, cache.Len())
+
+		assertErrorIs(t, cache.Add("dept-1", 21, "tenant-0"), ErrAlreadyExists)
+		assertErrorIs(t, cache.Add("dept-1", 21, "tenant-1"), ErrAlreadyExists)
+		assertErrorIs(t, cache.Add("root", 1, "tenant-1"), ErrAlreadyExists)
+		assertErrorIs(t, cache.Add("team-2", 1, "nonexistent"), ErrParentNotExist)
+		assertEqual(t, 6, cache.Len())
+
+		// Nodes of different first-level subtrees live in different shards.
+		assertEqual(t, []string{"dept-0", "root", "tenant-0"}, sortedKeys(cache.shards[0]))
+		assertEqual(t, []string{"dept-1", "root", "team-1", "tenant-1"}, sortedKeys(cache.shards[1]))
+
+		cacheNode, ok := cache.Get("team-1")
+		assertTrue(t, ok)
+		assertEqual(t, CacheNode[string, int]{Key: "team-1", Value: 22, ParentKey: "dept-1"}, cacheNode)
+		cacheNode, ok = cache.Peek("root")
+		assertTrue(t, ok)
+		assertEqual(t, CacheNode[string, int]{Key: "root", Value: 1}, cacheNode)
+		_, ok = cache.Get("nonexistent")
+		assertFalse(t, ok)
+
+		expectedBranch := []CacheNode[string, int]{
+			{Key: "root", Value: 1},
+			{Key: "tenant-1", Value: 20, ParentKey: "root"},
+			{Key: "dept-1", Value: 21, ParentKey: "tenant-1"},
+			{Key: "team-1", Value: 22, ParentKey: "dept-1"},
+		}
+		assertEqual(t, expectedBranch, cache.GetBranch("team-1"))
+		assertEqual(t, expectedBranch, cache.PeekBranch("team-1"))
+
+		var traversed []string
+		cache.TraverseToRoot("dept-0", func(key string, val int, parentKey string) {
+			traversed = append(traversed, key)
+		})
+		assertEqual(t, []string{"dept-0", "tenant-0", "root"}, traversed)
+
+		traversed = nil
+		cache.TraverseSubtree("root", func(key string, val int, parentKey string) {
+			traversed = append(traversed, key)
+		})
+		sort.Strings(traversed)
+		assertEqual(t, []string{"dept-0", "dept-1", "root", "team-1", "tenant-0", "tenant-1"}, traversed)
+
+		traversed = nil
+		cache.TraverseSubtree("root", func(key string, val int, parentKey string) {
+			traversed = append(traversed, key)
+		}, WithMaxDepth(1))
+		sort.Strings(traversed)
+		assertEqual(t, []string{"root", "tenant-0", "tenant-1"}, traversed)
+
+		traversed = nil
+		cache.TraverseSubtree("tenant-1", func(key string, val int, parentKey string) {
+			traversed = append(traversed, key)
+		})
+		assertEqual(t, []string{"tenant-1", "dept-1", "team-1"}, traversed)
+
+		traversed = nil
+		cache.PeekToRoot("team-1", func(key string, val int, parentKey string) {
+			traversed = append(traversed, key)
+		})
+		assertEqual(t, []string{"team-1", "dept-1", "tenant-1", "root"}, traversed)
+
+		traversed = nil
+		cache.PeekSubtree("root", func(key string, val int, parentKey string) {
+			traversed = append(traversed, key)
+		})
+		sort.Strings(traversed)
+		assertEqual(t, []string{"dept-0", "dept-1", "root", "team-1", "tenant-0", "tenant-1"}, traversed)
+
+		assertEqual(t, 3, cache.Remove("tenant-1"))
+		assertEqual(t, 3, cache.Len())
+		_, ok = cache.Peek("team-1")
+		assertFalse(t, ok)
+		assertNoError(t, cache.Add("team-1", 23, "dept-0"))
+		assertEqual(t, 0, cache.Remove("nonexistent"))
+
+		assertEqual(t, 4, cache.Remove("root"))
+		assertEqual(t, 0, cache.Len())
+		assertEqual(t, 0, cache.Remove("root"))
+		assertErrorIs(t, cache.Add("tenant-0", 10, "root"), ErrParentNotExist)
+		assertNoError(t, cache.AddRoot("new-root", 1))
+		assertNoError(t, cache.Add("tenant-0", 10, "new-root"))
+		assertEqual(t, 2, cache.Len())
+	})
+
+	t.Run("round-robin distribution", func(t *testing.T) {
+		cache := NewShardedCache[string, int](4, 0)
+		assertNoError(t, cache.AddRoot("root", 1))
+		for i := 0; i < 8; i++ {
+			assertNoError(t, cache.Add(fmt.Sprintf("tenant-%d", i), i, "root"))
+		}
+		for _, shard := range cache.shards {
+			assertEqual(t, 3, shard.Len())
+		}
+		assertEqual(t, 9, cache.Len())
+	})
+
+	t.Run("capacity is split among shards", func(t *testing.T) {
+		var mu sync.Mutex
+		var evicted []string
+		cache := NewShardedCache[string, int](2, 4,
+			WithShardFunc[string, int](shardByNumberSuffix),
+			WithShardOptions(WithOnEvict(func(node CacheNode[string, int]) {
+				mu.Lock()
+				evicted = append(evicted, node.Key)
+				mu.Unlock()
+			})),
+		)
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("tenant-0", 10, "root"))
+		assertNoError(t, cache.Add("dept-0", 11, "tenant-0"))
+		assertNoError(t, cache.Add("tenant-1", 20, "root"))
+		assertNoError(t, cache.Add("dept-1", 21, "tenant-1"))
+		assertNil(t, evicted)
+
+		// Shard 1 is full, but it doesn't affect shard 0.
+		assertNoError(t, cache.Add("team-1", 22, "dept-1"))
+		assertEqual(t, []string{"team-1"}, evicted)
+		_, ok := cache.Peek("dept-0")
+		assertTrue(t, ok)
+		_, ok = cache.Peek("team-1")
+		assertFalse(t, ok)
+	})
+
+	t.Run("AddOrUpdate across shards", func(t *testing.T) {
+		cache := NewShardedCache[string, int](2, 0, WithShardFunc[string, int](shardByNumberSuffix))
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.AddOrUpdate("tenant-0", 10, "root"))
+		assertNoError(t, cache.AddOrUpdate("tenant-1", 20, "root"))
+		assertNoError(t, cache.AddOrUpdate("dept-1", 21, "tenant-1"))
+		assertNoError(t, cache.AddOrUpdateWithTTL("team-1", 22, "dept-1", 0))
+		assertNoError(t, cache.AddOrUpdate("team-1", 23, "dept-1"))
+		assertErrorIs(t, cache.AddOrUpdate("team-2", 1, "nonexistent"), ErrParentNotExist)
+		assertErrorIs(t, cache.AddOrUpdate("root", 1, "tenant-0"), ErrCycleDetected)
+		assertErrorIs(t, cache.AddOrUpdate("tenant-1", 1, "team-1"), ErrCycleDetected)
+
+		// Move dept-1 with its subtree from shard 1 to shard 0.
+		assertNoError(t, cache.AddOrUpdateWithTTL("dept-1", 31, "tenant-0", -1))
+		assertEqual(t, []string{"dept-1", "root", "team-1", "tenant-0"}, sortedKeys(cache.shards[0]))
+		assertEqual(t, []string{"root", "tenant-1"}, sortedKeys(cache.shards[1]))
+		assertEqual(t, []string{"root", "tenant-0", "dept-1", "team-1"}, getLRUOrder(cache.shards[0]))
+		assertEqual(t, []CacheNode[string, int]{
+			{Key: "root", Value: 1},
+			{Key: "tenant-0", Value: 10, ParentKey: "root"},
+			{Key: "dept-1", Value: 31, ParentKey: "tenant-0"},
+			{Key: "team-1", Value: 23, ParentKey: "dept-1"},
+		}, cache.PeekBranch("team-1"))
+		assertEqual(t, 5, cache.Len())
+
+		// A stale mapping of a node that is not stored in the source shard is dropped, and the node is just added.
+		cache.index.Store("ghost", 1)
+		assertNoError(t, cache.AddOrUpdate("ghost", 40, "tenant-0"))
+		cacheNode, ok := cache.Peek("ghost")
+		assertTrue(t, ok)
+		assertEqual(t, CacheNode[string, int]{Key: "ghost", Value: 40, ParentKey: "tenant-0"}, cacheNode)
+		assertErrorIs(t, cache.moveToShard("ghost", 40, "nonexistent", 0, 0, 1), ErrParentNotExist)
+		assertErrorIs(t, cache.moveToShard("nonexistent", 40, "tenant-0", 0, 1, 0), errShardChanged)
+	})
+
+	t.Run("AddOrUpdate keeps first-level nodes in their shards", func(t *testing.T) {
+		var removed []string
+		cache := NewShardedCache[string, int](4, 0, WithShardOptions(
+			WithOnRemove(func(node CacheNode[string, int], reason RemovalReason) {
+				removed = append(removed, fmt.Sprintf("%s:%s", node.Key, reason))
+			}),
+		))
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.AddOrUpdate("tenant-0", 10, "root"))
+		assertNoError(t, cache.Add("dept-0", 11, "tenant-0"))
+		idx, _ := cache.index.Load("tenant-0")
+		for i := 0; i < 8; i++ {
+			assertNoError(t, cache.AddOrUpdate("tenant-0", 20+i, "root"))
+			newIdx, _ := cache.index.Load("tenant-0")
+			assertEqual(t, idx, newIdx)
+		}
+		assertEqual(t, []string{"root", "tenant-0", "dept-0"}, getLRUOrder(cache.shards[idx.(int)]))
+		for _, key := range removed {
+			assertEqual(t, "tenant-0:Replaced", key)
+		}
+		assertEqual(t, 8, len(removed))
+		assertEqual(t, 3, cache.Len())
+	})
+
+	t.Run("Cost", func(t *testing.T) {
+		cache := NewShardedCache[string, []byte](2, 0,
+			WithShardFunc[string, []byte](shardByNumberSuffix),
+			WithShardOptions(WithCostFunc(func(key string, val []byte) int64 { return int64(len(val)) })),
+		)
+		assertNoError(t, cache.AddRoot("root", []byte("r")))
+		assertEqual(t, int64(1), cache.Cost())
+		assertNoError(t, cache.Add("tenant-0", []byte("aa"), "root"))
+		assertNoError(t, cache.Add("tenant-1", []byte("bbb"), "root"))
+		assertEqual(t, int64(6), cache.Cost())
+		cache.Remove("tenant-1")
+		assertEqual(t, int64(3), cache.Cost())
+	})
+
+	t.Run("AddBranch", func(t *testing.T) {
+		cache := NewShardedCache[string, int](2, 0, WithShardFunc[string, int](shardByNumberSuffix))
+
+		// The root node is added to every shard.
+		assertNoError(t, cache.AddBranch([]CacheNode[string, int]{
+			{Key: "root", Value: 1},
+			{Key: "tenant-1", Value: 20, ParentKey: "root"},
+			{Key: "dept-1", Value: 21, ParentKey: "tenant-1"},
+		}))
+		assertEqual(t, []string{"root"}, sortedKeys(cache.shards[0]))
+		assertEqual(t, []string{"dept-1", "root", "tenant-1"}, sortedKeys(cache.shards[1]))
+
+		assertNoError(t, cache.AddBranch([]CacheNode[string, int]{
+			{Key: "tenant-0", Value: 10, ParentKey: "root"},
+			{Key: "dept-0", Value: 11, ParentKey: "tenant-0"},
+		}))
+		assertNoError(t, cache.AddBranch([]CacheNode[string, int]{
+			{Key: "team-1", Value: 22, ParentKey: "dept-1"},
+		}))
+		assertEqual(t, []string{"dept-0", "root", "tenant-0"}, sortedKeys(cache.shards[0]))
+		assertEqual(t, []string{"dept-1", "root", "team-1", "tenant-1"}, sortedKeys(cache.shards[1]))
+		assertEqual(t, 6, cache.Len())
+
+		// The node is stored in another shard.
+		assertErrorIs(t, cache.AddBranch([]CacheNode[string, int]{
+			{Key: "dept-2", Value: 12, ParentKey: "tenant-0"},
+			{Key: "team-1", Value: 22, ParentKey: "dept-2"},
+		}), ErrAlreadyExists)
+		assertErrorIs(t, cache.AddBranch([]CacheNode[string, int]{
+			{Key: "team-2", Value: 1, ParentKey: "nonexistent"},
+		}), ErrParentNotExist)
+		assertErrorIs(t, cache.AddBranch([]CacheNode[string, int]{{Key: "root2", Value: 1}}), ErrRootAlreadyExists)
+		_, ok := cache.index.Load("dept-2")
+		assertFalse(t, ok)
+		assertEqual(t, 6, cache.Len())
+	})
+
+	t.Run("AddOrUpdateBranch", func(t *testing.T) {
+		cache := NewShardedCache[string, int](2, 0, WithShardFunc[string, int](shardByNumberSuffix))
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("tenant-1", 20, "root"))
+		assertNoError(t, cache.Add("dept-1", 21, "tenant-1"))
+		assertNoError(t, cache.Add("team-1", 22, "dept-1"))
+
+		branch := []CacheNode[string, int]{
+			{Key: "root", Value: 2},
+			{Key: "tenant-1", Value: 30, ParentKey: "root"},
+			{Key: "team-1", Value: 32, ParentKey: "tenant-1"},
+		}
+		assertNoError(t, cache.AddOrUpdateBranch(branch))
+		assertEqual(t, branch, cache.PeekBranch("team-1"))
+
+		// The root node is updated in every shard.
+		for _, shard := range cache.shards {
+			cacheNode, _ := shard.Peek("root")
+			assertEqual(t, 2, cacheNode.Value)
+		}
+		assertNoError(t, cache.AddOrUpdateBranch([]CacheNode[string, int]{{Key: "root", Value: 3}}))
+		for _, shard := range cache.shards {
+			cacheNode, _ := shard.Peek("root")
+			assertEqual(t, 3, cacheNode.Value)
+		}
+
+		// Nodes are not moved between shards.
+		assertNoError(t, cache.Add("tenant-0", 10, "root"))
+		assertErrorIs(t, cache.AddOrUpdateBranch([]CacheNode[string, int]{
+			{Key: "tenant-0", Value: 10, ParentKey: "root"},
+			{Key: "dept-1", Value: 21, ParentKey: "tenant-0"},
+		}), ErrAlreadyExists)
+		assertEqual(t, 5, cache.Len())
+	})
+
+	t.Run("GetOrLoad", func(t *testing.T) {
+		loader := newMockLoader()
+		cache := NewShardedCache[string, int](2, 0,
+			WithShardFunc[string, int](func(topKey string) int { return len(topKey) }),
+			WithShardOptions(WithLoader[string, int](loader)),
+		)
+		assertNoError(t, cache.AddRoot("root", 1))
+
+		cacheNode, err := cache.GetOrLoad(context.Background(), "customer-1")
+		assertNoError(t, err)
+		assertEqual(t, CacheNode[string, int]{Key: "customer-1", Value: 4, ParentKey: "partner-1"}, cacheNode)
+		assertEqual(t, int32(3), loader.calls.Load())
+		assertEqual(t, []string{"customer-1", "partner-1", "root", "sub-root"}, sortedKeys(cache.shards[0]))
+
+		// The ancestor is found in its shard.
+		_, err = cache.GetOrLoad(context.Background(), "customer-2")
+		assertNoError(t, err)
+		assertEqual(t, int32(4), loader.calls.Load())
+		_, err = cache.GetOrLoad(context.Background(), "customer-2")
+		assertNoError(t, err)
+		assertEqual(t, int32(4), loader.calls.Load())
+		assertEqual(t, 5, cache.Len())
+
+		_, err = NewShardedCache[string, int](2, 0).GetOrLoad(context.Background(), "customer-1")
+		assertErrorIs(t, err, ErrLoaderNotSet)
+	})
+
+	t.Run("stats are aggregated", func(t *testing.T) {
+		stats := &mockCostStats{}
+		cache := NewShardedCache[string, int](3, 0, WithShardOptions(WithStatsCollector[string, int](stats)))
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertEqual(t, int32(1), stats.amount.Load())
+		assertEqual(t, int64(1), stats.cost.Load())
+		for i := 0; i < 6; i++ {
+			assertNoError(t, cache.Add(fmt.Sprintf("tenant-%d", i), i, "root"))
+		}
+		assertEqual(t, int32(7), stats.amount.Load())
+		assertEqual(t, int64(7), stats.cost.Load())
+
+		_, _ = cache.Get("tenant-1")
+		_, _ = cache.Get("nonexistent")
+		assertEqual(t, int32(1), stats.hits.Load())
+		assertEqual(t, int32(1), stats.misses.Load())
+	})
+}
+
+func TestShardedCache_Concurrency(t *testing.T) {
+	cache := NewShardedCache[string, int](4, 1000)
+	defer cache.Close()
+	assertNoError(t, cache.AddRoot("root", 0))
+	for i := 0; i < 8; i++ {
+		assertNoError(t, cache.Add(fmt.Sprintf("tenant-%d", i), i, "root"))
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			tenant := fmt.Sprintf("tenant-%d", g)
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("node-%d-%d", g, i)
+				_ = cache.Add(key, i, tenant)
+				_, _ = cache.Get(key)
+				_ = cache.GetBranch(key)
+				// Move nodes between tenants, possibly across shards.
+				_ = cache.AddOrUpdate(key, i, fmt.Sprintf("tenant-%d", (g+i)%8))
+				if i%3 == 0 {
+					cache.Remove(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	total := 0
+	cache.TraverseSubtree("root", func(key string, val int, parentKey string) {
+		total++
+	})
+	assertEqual(t, cache.Len(), total)
+}
+
+func TestShardedCache_ConcurrentWritesToSameKeys(t *testing.T) {
+	cache := NewShardedCache[string, int](4, 0)
+	defer cache.Close()
+	assertNoError(t, cache.AddRoot("root", 0))
+	for i := 0; i < 4; i++ {
+		assertNoError(t, cache.Add(fmt.Sprintf("tenant-%d", i), i, "root"))
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("k%d", (g+i)%16)
+				tenant := fmt.Sprintf("tenant-%d", (g*7+i)%4)
+				switch i % 5 {
+				case 0:
+					_ = cache.Add(key, i, tenant)
+				case 1:
+					_ = cache.AddOrUpdate(key, i, tenant)
+				case 2:
+					// Nest keys, so subtrees are moved between shards.
+					_ = cache.AddOrUpdate(key, i, fmt.Sprintf("k%d", (g+i+1)%16))
+				case 3:
+					_ = cache.AddBranch([]CacheNode[string, int]{
+						{Key: tenant, ParentKey: "root"},
+						{Key: key, Value: i, ParentKey: tenant},
+					})
+				case 4:
+					cache.Remove(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Every shard is consistent, and the index maps every key to the only shard that stores it.
+	shardsOfKeys := make(map[string][]int)
+	for i, shard := range cache.shards {
+		assertNoError(t, shard.Validate())
+		for _, key := range getLRUOrder(shard) {
+			shardsOfKeys[key] = append(shardsOfKeys[key], i)
+		}
+	}
+	for key, idxs := range shardsOfKeys {
+		if key == "root" {
+			continue
+		}
+		assertEqual(t, 1, len(idxs))
+		idx, ok := cache.index.Load(key)
+		assertTrue(t, ok)
+		assertEqual(t, idxs[0], idx.(int))
+	}
+	cache.index.Range(func(key, idx any) bool {
+		_, stored := cache.shards[idx.(int)].keysMap[key.(string)]
+		assertTrue(t, stored)
+		return true
+	})
+}
+
+func sortedKeys[K interface{ ~string }, V any](c *Cache[K, V]) []K {
+	keys := getLRUOrder(c)
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,210 @@
+package lrutree
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrInvalidSnapshot is returned by RestoreCache when the snapshot is malformed or violates the tree invariants.
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+const (
+	snapshotFormat  = "lrutree"
+	snapshotVersion = 1
+)
+
+// Encoder encodes values to an underlying stream.
+type Encoder interface {
+	Encode(v any) error
+}
+
+// Decoder decodes values from an underlying stream.
+type Decoder interface {
+	Decode(v any) error
+}
+
+// Codec defines the serialization format of snapshots (see WriteSnapshot and RestoreCache).
+type Codec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// GobCodec is a Codec that uses encoding/gob.
+// Interface values stored in keys or values must be registered with gob.Register.
+type GobCodec struct{}
+
+// NewEncoder returns a new gob encoder that writes to w.
+func (GobCodec) NewEncoder(w io.Writer) Encoder { return gob.NewEncoder(w) }
+
+// NewDecoder returns a new gob decoder that reads from r.
+func (GobCodec) NewDecoder(r io.Reader) Decoder { return gob.NewDecoder(r) }
+
+// JSONCodec is a Codec that uses encoding/json.
+// Keys and values must survive a JSON round trip (e.g. exported struct fields, no interface values).
+type JSONCodec struct{}
+
+// NewEncoder returns a new JSON encoder that writes to w.
+func (JSONCodec) NewEncoder(w io.Writer) Encoder { return json.NewEncoder(w) }
+
+// NewDecoder returns a new JSON decoder that reads from r.
+func (JSONCodec) NewDecoder(r io.Reader) Decoder { return json.NewDecoder(r) }
+
+// maxSnapshotPrealloc is the maximum number of nodes preallocated when a snapshot is restored.
+const maxSnapshotPrealloc = 1 << 16
+
+// snapshotHeader is written before the records of a snapshot.
+type snapshotHeader struct {
+	Format  string
+	Version int
+	Count   int
+}
+
+// snapshotRecord represents a single node in a snapshot.
+type snapshotRecord[K comparable, V any] struct {
+	Key              K
+	Value            V
+	ParentKey        K
+	IsRoot           bool
+	ExpiresAt        time.Time
+	Pinned           bool
+	ChildrenComplete bool
+}
+
+// WriteSnapshot writes all nodes of the cache to w using the given codec.
+//
+// The snapshot consists of a versioned header followed by one record per node (key, value, parent key,
+// expiration time, whether the node is pinned and whether its child set is complete).
+// Records are written in the LRU order from the most recently used node,
+// so parents always precede their descendants, and RestoreCache rebuilds the exact tree and recency order.
+//
+// The state of the cache is captured under the lock, while encoding and writing are done without holding it.
+func (c *Cache[K, V]) WriteSnapshot(w io.Writer, codec Codec) error {
+	records := c.snapshotRecords()
+	enc := codec.NewEncoder(w)
+	if err := enc.Encode(snapshotHeader{Format: snapshotFormat, Version: snapshotVersion, Count: len(records)}); err != nil {
+		return fmt.Errorf("encode snapshot header: %w", err)
+	}
+	for i := range records {
+		if err := enc.Encode(&records[i]); err != nil {
+			return fmt.Errorf("encode snapshot record: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Cache[K, V]) snapshotRecords() []snapshotRecord[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.drainAccessBuffer()
+
+	records := make([]snapshotRecord[K, V], 0, len(c.keysMap))
+	for elem := c.lruList.Front(); elem != nil; elem = elem.Next() {
+		node := elem.Value.(*treeNode[K, V])
+		if node.absent {
+			continue // Tombstones are not persisted.
+		}
+		records = append(records, snapshotRecord[K, V]{
+			Key:              node.key,
+			Value:            node.val,
+			ParentKey:        node.parentKey(),
+			IsRoot:           node.parent == nil,
+			ExpiresAt:        node.expiresAt,
+			Pinned:           node.pinned,
+			ChildrenComplete: node.childrenComplete,
+		})
+	}
+	return records
+}
+
+// RestoreCache creates a new cache with the given capacity and options and fills it
+// with the nodes from the snapshot written by WriteSnapshot.
+//
+// The tree structure, the LRU order, expiration times, pins and child set markers of nodes are restored exactly.
+// ErrInvalidSnapshot is returned if the snapshot has an unsupported version or violates the tree invariants
+// (it has more than one root while WithMultipleRoots is not used, a node whose parent is missing or a duplicate key)
+// or if it has fewer records than declared in its header.
+// If the snapshot doesn't fit the capacity of the new cache, the least recently used nodes are evicted.
+func RestoreCache[K comparable, V any](
+	r io.Reader, codec Codec, maxEntries int, options ...CacheOption[K, V],
+) (*Cache[K, V], error) {
+	c := NewCache[K, V](maxEntries, options...)
+	if err := c.restore(r, codec); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cache[K, V]) restore(r io.Reader, codec Codec) error {
+	dec := codec.NewDecoder(r)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("decode snapshot header: %w", err)
+	}
+	if header.Format != snapshotFormat {
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidSnapshot, header.Format)
+	}
+	if header.Version != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, header.Version)
+	}
+	if header.Count < 0 {
+		return fmt.Errorf("%w: negative number of records", ErrInvalidSnapshot)
+	}
+
+	var evictedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(evictedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The count comes from the snapshot and can't be trusted, so the preallocated capacity is limited.
+	nodes := make([]*treeNode[K, V], 0, min(header.Count, maxSnapshotPrealloc))
+	for i := 0; i < header.Count; i++ {
+		var record snapshotRecord[K, V]
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return fmt.Errorf("%w: %d records declared, but only %d found: %w", ErrInvalidSnapshot, header.Count, i, err)
+			}
+			return fmt.Errorf("decode snapshot record: %w", err)
+		}
+		if _, exists := c.keysMap[record.Key]; exists {
+			return fmt.Errorf("%w: duplicate key %v", ErrInvalidSnapshot, record.Key)
+		}
+		var node *treeNode[K, V]
+		if record.IsRoot {
+			if len(c.roots) != 0 && !c.multipleRoots {
+				return fmt.Errorf("%w: multiple roots", ErrInvalidSnapshot)
+			}
+			node = c.insertNode(record.Key, record.Value, nil)
+		} else {
+			// Parents precede their descendants in the snapshot, so a missing parent means an orphan
+			// (or a cycle, since nodes of a cycle can't all be preceded by their parents).
+			parent, exists := c.keysMap[record.ParentKey]
+			if !exists {
+				return fmt.Errorf("%w: parent of node %v does not exist", ErrInvalidSnapshot, record.Key)
+			}
+			node = c.insertNode(record.Key, record.Value, parent)
+			c.setExpiration(node, record.ExpiresAt)
+		}
+		c.setPinned(node, record.Pinned)
+		node.childrenComplete = record.ChildrenComplete
+		nodes = append(nodes, node)
+	}
+
+	// Nodes are pushed to the front of the LRU list on insertion, so the order needs to be reversed.
+	for i := len(nodes) - 1; i >= 0; i-- {
+		c.promote(nodes[i])
+	}
+
+	c.evictIfNeeded(&evictedNodes, nil)
+
+	c.reportInserts(len(nodes))
+	c.reportAmount()
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package lrutree
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCache_WriteSnapshot(t *testing.T) {
+	codecs := map[string]Codec{"gob": GobCodec{}, "json": JSONCodec{}}
+	for name, codec := range codecs {
+		codec := codec
+		t.Run(name, func(t *testing.T) {
+			t.Run("round trip", func(t *testing.T) {
+				cache := NewCache[string, int](10)
+				assertNoError(t, cache.AddRoot("root", 1))
+				assertNoError(t, cache.Add("sub-root-1", 2, "root"))
+				assertNoError(t, cache.Add("partner-1", 3, "sub-root-1"))
+				assertNoError(t, cache.Add("sub-root-2", 4, "root"))
+				assertNoError(t, cache.Add("partner-2", 5, "sub-root-2"))
+				assertNoError(t, cache.Add("customer-1", 6, "partner-1"))
+				_, _ = cache.Get("partner-2")
+
+				var buf bytes.Buffer
+				assertNoError(t, cache.WriteSnapshot(&buf, codec))
+
+				restored, err := RestoreCache[string, int](&buf, codec, 10)
+				assertNoError(t, err)
+				assertEqual(t, getLRUOrder(cache), getLRUOrder(restored))
+				for _, key := range getLRUOrder(cache) {
+					assertEqual(t, cache.PeekBranch(key), restored.PeekBranch(key))
+				}
+				assertErrorIs(t, restored.AddRoot("root", 1), ErrRootAlreadyExists)
+			})
+
+			t.Run("empty cache", func(t *testing.T) {
+				var buf bytes.Buffer
+				assertNoError(t, NewCache[string, int](10).WriteSnapshot(&buf, codec))
+				restored, err := RestoreCache[string, int](&buf, codec, 10)
+				assertNoError(t, err)
+				assertEqual(t, 0, restored.Len())
+				assertNoError(t, restored.AddRoot("root", 1))
+			})
+		})
+	}
+
+	t.Run("expiration times are preserved", func(t *testing.T) {
+		clock := newFakeClock()
+		cache := NewCache[string, int](10)
+		cache.now = clock.Now
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.AddWithTTL("sub-root-1", 2, "root", time.Minute))
+		assertNoError(t, cache.Add("sub-root-2", 3, "root"))
+
+		var buf bytes.Buffer
+		assertNoError(t, cache.WriteSnapshot(&buf, GobCodec{}))
+		restored, err := RestoreCache[string, int](&buf, GobCodec{}, 10)
+		assertNoError(t, err)
+		restored.now = clock.Now
+
+		clock.Advance(2 * time.Minute)
+		_, ok := restored.Get("sub-root-1")
+		assertFalse(t, ok)
+		_, ok = restored.Get("sub-root-2")
+		assertTrue(t, ok)
+	})
+
+	t.Run("least recently used nodes are evicted if snapshot exceeds capacity", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root-1", 2, "root"))
+		assertNoError(t, cache.Add("sub-root-2", 3, "root"))
+		assertNoError(t, cache.Add("sub-root-3", 4, "root"))
+
+		var buf bytes.Buffer
+		assertNoError(t, cache.WriteSnapshot(&buf, JSONCodec{}))
+
+		var evicted []string
+		stats := &mockStats{}
+		restored, err := RestoreCache[string, int](&buf, JSONCodec{}, 3,
+			WithOnEvict(func(node CacheNode[string, int]) {
+				evicted = append(evicted, node.Key)
+			}),
+			WithStatsCollector[string, int](stats),
+		)
+		assertNoError(t, err)
+		assertEqual(t, []string{"sub-root-1"}, evicted)
+		assertEqual(t, []string{"root", "sub-root-3", "sub-root-2"}, getLRUOrder(restored))
+		assertEqual(t, int32(3), stats.amount.Load())
+	})
+
+	t.Run("recorded accesses are included", func(t *testing.T) {
+		cache := NewCache[string, int](10, WithBufferedPromotion[string, int](100))
+		defer cache.Close()
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("sub-root-1", 2, "root"))
+		assertNoError(t, cache.Add("sub-root-2", 3, "root"))
+		_, _ = cache.Get("sub-root-1")
+
+		var buf bytes.Buffer
+		assertNoError(t, cache.WriteSnapshot(&buf, GobCodec{}))
+		restored, err := RestoreCache[string, int](&buf, GobCodec{}, 10)
+		assertNoError(t, err)
+		assertEqual(t, []string{"root", "sub-root-1", "sub-root-2"}, getLRUOrder(restored))
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 1))
+		errWrite := errors.New("write error")
+		assertErrorIs(t, cache.WriteSnapshot(&failingWriter{err: errWrite}, JSONCodec{}), errWrite)
+		assertErrorIs(t, cache.WriteSnapshot(&failingWriter{err: errWrite, failAfter: 1}, JSONCodec{}), errWrite)
+	})
+}
+
+func TestRestoreCache_Validation(t *testing.T) {
+	writeSnapshot := func(header snapshotHeader, records ...snapshotRecord[string, int]) *bytes.Buffer {
+		var buf bytes.Buffer
+		enc := JSONCodec{}.NewEncoder(&buf)
+		assertNoError(t, enc.Encode(header))
+		for _, record := range records {
+			assertNoError(t, enc.Encode(record))
+		}
+		return &buf
+	}
+	validHeader := func(count int) snapshotHeader {
+		return snapshotHeader{Format: snapshotFormat, Version: snapshotVersion, Count: count}
+	}
+	root := snapshotRecord[string, int]{Key: "root", Value: 1, IsRoot: true}
+
+	tests := []struct {
+		name     string
+		snapshot *bytes.Buffer
+	}{
+		{
+			name:     "unknown format",
+			snapshot: writeSnapshot(snapshotHeader{Format: "other", Version: snapshotVersion}),
+		},
+		{
+			name:     "unsupported version",
+			snapshot: writeSnapshot(snapshotHeader{Format: snapshotFormat, Version: snapshotVersion + 1}),
+		},
+		{
+			name:     "negative count",
+			snapshot: writeSnapshot(validHeader(-1)),
+		},
+		{
+			name:     "implausible count",
+			snapshot: writeSnapshot(validHeader(1<<62), root),
+		},
+		{
+			name:     "multiple roots",
+			snapshot: writeSnapshot(validHeader(2), root, snapshotRecord[string, int]{Key: "root-2", IsRoot: true}),
+		},
+		{
+			name:     "duplicate key",
+			snapshot: writeSnapshot(validHeader(2), root, snapshotRecord[string, int]{Key: "root", ParentKey: "root"}),
+		},
+		{
+			name: "orphan",
+			snapshot: writeSnapshot(validHeader(2), root,
+				snapshotRecord[string, int]{Key: "partner-1", ParentKey: "sub-root"}),
+		},
+		{
+			name: "cycle",
+			snapshot: writeSnapshot(validHeader(3), root,
+				snapshotRecord[string, int]{Key: "a", ParentKey: "b"},
+				snapshotRecord[string, int]{Key: "b", ParentKey: "a"}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := RestoreCache[string, int](tt.snapshot, JSONCodec{}, 10)
+			assertErrorIs(t, err, ErrInvalidSnapshot)
+			assertNil(t, cache)
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := RestoreCache[string, int](writeSnapshot(validHeader(2), root), JSONCodec{}, 10)
+		assertErrorIs(t, err, io.EOF)
+		assertErrorIs(t, err, ErrInvalidSnapshot)
+		_, err = RestoreCache[string, int](&bytes.Buffer{}, JSONCodec{}, 10)
+		assertErrorIs(t, err, io.EOF)
+	})
+}
+
+type failingWriter struct {
+	err       error
+	failAfter int
+	writes    int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.writes >= w.failAfter {
+		return 0, w.err
+	}
+	w.writes++
+	return len(p), nil
+}
@@ -0,0 +1,252 @@
+package lrutree
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Operation identifies a cache operation for latency reporting (see ExtendedStatsCollector).
+type Operation int
+
+// Operations which latency is reported to ExtendedStatsCollector.
+// Variants of operations (e.g. AddWithTTL, AddPinned) are reported as the base operation.
+const (
+	OpGet Operation = iota
+	OpPeek
+	OpGetBranch
+	OpPeekBranch
+	OpAdd
+	OpAddOrUpdate
+	OpAddBranch
+	OpRemove
+	OpTraverseToRoot
+	OpTraverseSubtree
+	OpGetOrLoad
+	OpPeekToRoot
+	OpPeekSubtree
+	OpAddPath
+	OpGetPath
+	OpMove
+	OpRename
+	OpAddChildren
+
+	numOperations
+)
+
+var operationNames = [numOperations]string{
+	OpGet:             "Get",
+	OpPeek:            "Peek",
+	OpGetBranch:       "GetBranch",
+	OpPeekBranch:      "PeekBranch",
+	OpAdd:             "Add",
+	OpAddOrUpdate:     "AddOrUpdate",
+	OpAddBranch:       "AddBranch",
+	OpRemove:          "Remove",
+	OpTraverseToRoot:  "TraverseToRoot",
+	OpTraverseSubtree: "TraverseSubtree",
+	OpGetOrLoad:       "GetOrLoad",
+	OpPeekToRoot:      "PeekToRoot",
+	OpPeekSubtree:     "PeekSubtree",
+	OpAddPath:         "AddPath",
+	OpGetPath:         "GetPath",
+	OpMove:            "Move",
+	OpRename:          "Rename",
+	OpAddChildren:     "AddChildren",
+}
+
+// String returns the name of the cache method that corresponds to the operation.
+func (op Operation) String() string {
+	if op < 0 || op >= numOperations {
+		return "Unknown"
+	}
+	return operationNames[op]
+}
+
+// ExtendedStatsCollector is an optional interface that may be implemented by StatsCollector
+// to receive detailed counters of modifications and latencies of operations.
+//
+// Methods are called synchronously (mostly under the cache lock), so they should be fast.
+type ExtendedStatsCollector interface {
+	// AddInserts increments the total number of inserted entries.
+	AddInserts(int)
+
+	// IncUpdates increments the total number of updates of existing entries.
+	IncUpdates()
+
+	// IncReparents increments the total number of existing entries moved to another parent.
+	IncReparents()
+
+	// AddRemovals increments the total number of entries removed explicitly by Remove.
+	AddRemovals(int)
+
+	// AddExpirations increments the total number of expired entries removed from the cache.
+	AddExpirations(int)
+
+	// IncCycleRejections increments the total number of operations rejected with ErrCycleDetected.
+	IncCycleRejections()
+
+	// ObserveLatency records the duration of the operation.
+	ObserveLatency(op Operation, d time.Duration)
+}
+
+// StatsSnapshot is a point-in-time copy of the counters collected by Stats.
+type StatsSnapshot struct {
+	Amount          int
+	Cost            int64
+	Hits            uint64
+	Misses          uint64
+	Evictions       uint64
+	Expirations     uint64
+	Inserts         uint64
+	Updates         uint64
+	Reparents       uint64
+	Removals        uint64
+	CycleRejections uint64
+	Latencies       map[Operation]LatencyStats // Only operations that were observed at least once are present.
+}
+
+// LatencyStats describes latencies of a single operation.
+type LatencyStats struct {
+	Count uint64
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Stats is a built-in collector that implements StatsCollector, CostStatsCollector and ExtendedStatsCollector
+// using atomic counters. The zero value is ready to use.
+// A single Stats may be shared between several caches to aggregate their counters
+// (amount and cost are then the last values reported by any of them).
+type Stats struct {
+	amount          atomic.Int64
+	cost            atomic.Int64
+	hits            atomic.Uint64
+	misses          atomic.Uint64
+	evictions       atomic.Uint64
+	expirations     atomic.Uint64
+	inserts         atomic.Uint64
+	updates         atomic.Uint64
+	reparents       atomic.Uint64
+	removals        atomic.Uint64
+	cycleRejections atomic.Uint64
+	latencies       [numOperations]latencyCounters
+}
+
+type latencyCounters struct {
+	count atomic.Uint64
+	total atomic.Int64
+	max   atomic.Int64
+}
+
+// SetAmount implements StatsCollector.
+func (s *Stats) SetAmount(amount int) { s.amount.Store(int64(amount)) }
+
+// IncHits implements StatsCollector.
+func (s *Stats) IncHits() { s.hits.Add(1) }
+
+// IncMisses implements StatsCollector.
+func (s *Stats) IncMisses() { s.misses.Add(1) }
+
+// AddEvictions implements StatsCollector.
+func (s *Stats) AddEvictions(n int) { s.evictions.Add(uint64(n)) }
+
+// SetCost implements CostStatsCollector.
+func (s *Stats) SetCost(cost int64) { s.cost.Store(cost) }
+
+// AddInserts implements ExtendedStatsCollector.
+func (s *Stats) AddInserts(n int) { s.inserts.Add(uint64(n)) }
+
+// IncUpdates implements ExtendedStatsCollector.
+func (s *Stats) IncUpdates() { s.updates.Add(1) }
+
+// IncReparents implements ExtendedStatsCollector.
+func (s *Stats) IncReparents() { s.reparents.Add(1) }
+
+// AddRemovals implements ExtendedStatsCollector.
+func (s *Stats) AddRemovals(n int) { s.removals.Add(uint64(n)) }
+
+// AddExpirations implements ExtendedStatsCollector.
+func (s *Stats) AddExpirations(n int) { s.expirations.Add(uint64(n)) }
+
+// IncCycleRejections implements ExtendedStatsCollector.
+func (s *Stats) IncCycleRejections() { s.cycleRejections.Add(1) }
+
+// ObserveLatency implements ExtendedStatsCollector.
+func (s *Stats) ObserveLatency(op Operation, d time.Duration) {
+	if op < 0 || op >= numOperations {
+		return
+	}
+	lc := &s.latencies[op]
+	lc.count.Add(1)
+	lc.total.Add(int64(d))
+	for {
+		curMax := lc.max.Load()
+		if int64(d) <= curMax || lc.max.CompareAndSwap(curMax, int64(d)) {
+			return
+		}
+	}
+}
+
+// Snapshot returns the current values of all counters.
+// Counters are read one by one, so the snapshot is not atomic with respect to concurrent operations.
+func (s *Stats) Snapshot() StatsSnapshot {
+	snapshot := StatsSnapshot{
+		Amount:          int(s.amount.Load()),
+		Cost:            s.cost.Load(),
+		Hits:            s.hits.Load(),
+		Misses:          s.misses.Load(),
+		Evictions:       s.evictions.Load(),
+		Expirations:     s.expirations.Load(),
+		Inserts:         s.inserts.Load(),
+		Updates:         s.updates.Load(),
+		Reparents:       s.reparents.Load(),
+		Removals:        s.removals.Load(),
+		CycleRejections: s.cycleRejections.Load(),
+		Latencies:       make(map[Operation]LatencyStats),
+	}
+	for op := range s.latencies {
+		lc := &s.latencies[op]
+		if count := lc.count.Load(); count != 0 {
+			snapshot.Latencies[Operation(op)] = LatencyStats{
+				Count: count,
+				Total: time.Duration(lc.total.Load()),
+				Max:   time.Duration(lc.max.Load()),
+			}
+		}
+	}
+	return snapshot
+}
+
+func nopObserve() {}
+
+// observe starts measuring the latency of the operation. The returned function reports it.
+func (c *Cache[K, V]) observe(op Operation) func() {
+	if c.extStats == nil {
+		return nopObserve
+	}
+	start := time.Now()
+	return func() {
+		c.extStats.ObserveLatency(op, time.Since(start))
+	}
+}
+
+func (c *Cache[K, V]) reportInserts(n int) {
+	if c.extStats != nil && n != 0 {
+		c.extStats.AddInserts(n)
+	}
+}
+
+func (c *Cache[K, V]) reportUpdate(reparented bool) {
+	if c.extStats == nil {
+		return
+	}
+	c.extStats.IncUpdates()
+	if reparented {
+		c.extStats.IncReparents()
+	}
+}
+
+func (c *Cache[K, V]) reportCycleRejection() {
+	if c.extStats != nil {
+		c.extStats.IncCycleRejections()
+	}
+}
@@ -0,0 +1,115 @@
+package lrutree
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	t.Run("counters", func(t *testing.T) {
+		stats := &Stats{}
+		now := time.Now()
+		cache := NewCache[string, int](5, WithStatsCollector[string, int](stats))
+		cache.now = func() time.Time { return now }
+
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("a", 2, "root"))
+		assertNoError(t, cache.Add("b", 3, "root"))
+		assertNoError(t, cache.AddWithTTL("c", 4, "b", time.Minute))
+		assertNoError(t, cache.AddOrUpdate("a", 5, "root")) // Update.
+		assertNoError(t, cache.AddOrUpdate("a", 6, "c"))    // Update with reparenting.
+		assertErrorIs(t, cache.AddOrUpdate("b", 7, "a"), ErrCycleDetected)
+		assertNoError(t, cache.Add("d", 8, "root"))
+		assertNoError(t, cache.AddBranch([]CacheNode[string, int]{
+			{Key: "e", Value: 9, ParentKey: "root"},
+		})) // Evicts "a".
+		_, _ = cache.Get("d")
+		_, _ = cache.Get("nonexistent")
+
+		now = now.Add(time.Minute)
+		_, _ = cache.Get("c") // Expired.
+		assertEqual(t, 1, cache.Remove("e"))
+
+		snapshot := stats.Snapshot()
+		assertEqual(t, 3, snapshot.Amount)
+		assertEqual(t, int64(3), snapshot.Cost)
+		assertEqual(t, uint64(6), snapshot.Inserts)
+		assertEqual(t, uint64(2), snapshot.Updates)
+		assertEqual(t, uint64(1), snapshot.Reparents)
+		assertEqual(t, uint64(1), snapshot.CycleRejections)
+		assertEqual(t, uint64(1), snapshot.Evictions)
+		assertEqual(t, uint64(1), snapshot.Expirations)
+		assertEqual(t, uint64(1), snapshot.Removals)
+		assertEqual(t, uint64(1), snapshot.Hits)
+		assertEqual(t, uint64(2), snapshot.Misses)
+
+		assertEqual(t, uint64(3), snapshot.Latencies[OpGet].Count)
+		assertEqual(t, uint64(3), snapshot.Latencies[OpAddOrUpdate].Count)
+		assertEqual(t, uint64(4), snapshot.Latencies[OpAdd].Count)
+		assertEqual(t, uint64(1), snapshot.Latencies[OpAddBranch].Count)
+		assertEqual(t, uint64(1), snapshot.Latencies[OpRemove].Count)
+		assertTrue(t, snapshot.Latencies[OpGet].Max <= snapshot.Latencies[OpGet].Total)
+		_, observed := snapshot.Latencies[OpPeek]
+		assertFalse(t, observed)
+	})
+
+	t.Run("move, rename and children", func(t *testing.T) {
+		stats := &Stats{}
+		cache := NewCache[string, int](10, WithStatsCollector[string, int](stats))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.AddChildren("root", []CacheNode[string, int]{{Key: "a", Value: 1}, {Key: "b", Value: 2}}))
+		assertNoError(t, cache.Move("b", "a"))
+		assertNoError(t, cache.Rename("b", "c"))
+
+		snapshot := stats.Snapshot()
+		assertEqual(t, uint64(1), snapshot.Latencies[OpAddChildren].Count)
+		assertEqual(t, uint64(1), snapshot.Latencies[OpMove].Count)
+		assertEqual(t, uint64(1), snapshot.Latencies[OpRename].Count)
+		_, observed := snapshot.Latencies[OpAddBranch]
+		assertFalse(t, observed)
+	})
+
+	t.Run("loader cycles", func(t *testing.T) {
+		stats := &Stats{}
+		cache := NewCache[string, int](10,
+			WithStatsCollector[string, int](stats),
+			WithLoader[string, int](LoaderFunc[string, int](func(ctx context.Context, key string) (int, string, error) {
+				if key == "a" {
+					return 1, "b", nil
+				}
+				return 2, "a", nil
+			})),
+		)
+		assertNoError(t, cache.AddRoot("root", 0))
+		_, err := cache.GetOrLoad(context.Background(), "a")
+		assertErrorIs(t, err, ErrCycleDetected)
+		snapshot := stats.Snapshot()
+		assertEqual(t, uint64(1), snapshot.CycleRejections)
+		assertEqual(t, uint64(1), snapshot.Latencies[OpGetOrLoad].Count)
+	})
+
+	t.Run("sharded cache", func(t *testing.T) {
+		stats := &Stats{}
+		cache := NewShardedCache[string, int](2, 10, WithShardOptions(WithStatsCollector[string, int](stats)))
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Add("b", 2, "root"))
+		assertNoError(t, cache.AddOrUpdate("a", 3, "b"))
+		assertErrorIs(t, cache.AddOrUpdate("root", 3, "b"), ErrCycleDetected)
+
+		snapshot := stats.Snapshot()
+		assertEqual(t, 3, snapshot.Amount)
+		assertEqual(t, uint64(4), snapshot.Inserts) // The root node is inserted into every shard.
+		assertEqual(t, uint64(1), snapshot.Updates)
+		assertEqual(t, uint64(1), snapshot.Reparents)
+		assertEqual(t, uint64(1), snapshot.CycleRejections)
+	})
+}
+
+func TestOperation_String(t *testing.T) {
+	assertEqual(t, "Get", OpGet.String())
+	assertEqual(t, "GetOrLoad", OpGetOrLoad.String())
+	assertEqual(t, "AddChildren", OpAddChildren.String())
+	assertEqual(t, "Unknown", Operation(-1).String())
+}
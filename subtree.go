@@ -0,0 +1,66 @@
+package lrutree
+
+// Subtree statistics don't mark nodes as recently used (like Peek) and run under the read lock.
+// Like Len, they include expired nodes that have not been reaped yet, but they return false
+// if the node itself doesn't exist or is expired.
+
+// SubtreeSize returns the number of nodes in the subtree rooted at the node with the given key,
+// including the node itself (so it's 1 for a leaf).
+// The number of descendants is maintained for every node on each change of the tree, so it takes O(1) time.
+func (c *Cache[K, V]) SubtreeSize(key K) (int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	node := c.peekNode(key)
+	if node == nil {
+		return 0, false
+	}
+	return node.descendants + 1, true
+}
+
+// Height returns the number of edges on the longest downward path from the node with the given key to a leaf
+// (0 for a leaf). It walks the whole subtree, so it takes O(subtree size) time.
+func (c *Cache[K, V]) Height(key K) (int, bool) {
+	counts, ok := c.DepthCounts(key)
+	if !ok {
+		return 0, false
+	}
+	return len(counts) - 1, true
+}
+
+// DepthCounts returns the number of nodes at every depth of the subtree rooted at the node with the given key,
+// where depth is counted from the node: counts[0] is 1 (the node itself), counts[1] is the number of its children,
+// counts[2] is the number of its grandchildren, and so on. The length of the result is the height of the subtree plus 1.
+// It walks the whole subtree, so it takes O(subtree size) time.
+func (c *Cache[K, V]) DepthCounts(key K) ([]int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	node := c.peekNode(key)
+	if node == nil {
+		return nil, false
+	}
+	var counts []int
+	level := []*treeNode[K, V]{node}
+	for len(level) != 0 {
+		counts = append(counts, len(level))
+		var nextLevel []*treeNode[K, V]
+		for _, n := range level {
+			for _, child := range n.children {
+				nextLevel = append(nextLevel, child)
+			}
+		}
+		level = nextLevel
+	}
+	return counts, true
+}
+
+// peekNode returns the non-expired node with the given key, or nil if there is no such node.
+// It must be called under the lock.
+func (c *Cache[K, V]) peekNode(key K) *treeNode[K, V] {
+	node, exists := c.keysMap[key]
+	if !exists || node.isExpired(c.now()) {
+		return nil
+	}
+	return node
+}
@@ -0,0 +1,107 @@
+package lrutree
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_SubtreeStats(t *testing.T) {
+	// root
+	// ├── org-1
+	// │   ├── eng
+	// │   │   ├── frontend
+	// │   │   └── backend
+	// │   └── sales
+	// └── org-2
+	newCache := func(maxEntries int, options ...CacheOption[string, int]) *Cache[string, int] {
+		cache := NewCache[string, int](maxEntries, options...)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("org-1", 1, "root"))
+		assertNoError(t, cache.Add("eng", 2, "org-1"))
+		assertNoError(t, cache.Add("frontend", 3, "eng"))
+		assertNoError(t, cache.Add("backend", 4, "eng"))
+		assertNoError(t, cache.Add("sales", 5, "org-1"))
+		assertNoError(t, cache.Add("org-2", 6, "root"))
+		return cache
+	}
+	assertSubtree := func(cache *Cache[string, int], key string, expectedSize int, expectedCounts []int) {
+		t.Helper()
+		size, ok := cache.SubtreeSize(key)
+		assertTrue(t, ok)
+		assertEqual(t, expectedSize, size)
+		counts, ok := cache.DepthCounts(key)
+		assertTrue(t, ok)
+		assertEqual(t, expectedCounts, counts)
+		height, ok := cache.Height(key)
+		assertTrue(t, ok)
+		assertEqual(t, len(expectedCounts)-1, height)
+	}
+
+	t.Run("basic", func(t *testing.T) {
+		cache := newCache(10)
+		assertSubtree(cache, "root", 7, []int{1, 2, 2, 2})
+		assertSubtree(cache, "org-1", 5, []int{1, 2, 2})
+		assertSubtree(cache, "eng", 3, []int{1, 2})
+		assertSubtree(cache, "frontend", 1, []int{1})
+
+		_, ok := cache.SubtreeSize("nonexistent")
+		assertFalse(t, ok)
+		_, ok = cache.Height("nonexistent")
+		assertFalse(t, ok)
+		_, ok = cache.DepthCounts("nonexistent")
+		assertFalse(t, ok)
+
+		// Queries don't update the LRU order.
+		lruOrder := getLRUOrder(cache)
+		cache.SubtreeSize("backend")
+		cache.DepthCounts("backend")
+		assertEqual(t, lruOrder, getLRUOrder(cache))
+	})
+
+	t.Run("maintained on changes", func(t *testing.T) {
+		cache := newCache(10)
+
+		assertEqual(t, 3, cache.Remove("eng"))
+		assertSubtree(cache, "root", 4, []int{1, 2, 1})
+		assertSubtree(cache, "org-1", 2, []int{1, 1})
+
+		assertNoError(t, cache.AddPath([]string{"root", "org-2", "ops", "infra", "k8s"}, 9, nil))
+		assertSubtree(cache, "root", 7, []int{1, 2, 2, 1, 1})
+		assertSubtree(cache, "org-2", 4, []int{1, 1, 1, 1})
+
+		assertNoError(t, cache.Move("infra", "org-1"))
+		assertSubtree(cache, "org-1", 4, []int{1, 2, 1})
+		assertSubtree(cache, "org-2", 2, []int{1, 1})
+
+		assertNoError(t, cache.AddOrUpdate("sales", 50, "ops"))
+		assertSubtree(cache, "org-1", 3, []int{1, 1, 1})
+		assertSubtree(cache, "ops", 2, []int{1, 1})
+
+		assertNoError(t, cache.Rename("infra", "platform"))
+		assertSubtree(cache, "platform", 2, []int{1, 1})
+		assertSubtree(cache, "root", 7, []int{1, 2, 2, 2})
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("maintained on eviction and expiration", func(t *testing.T) {
+		now := time.Now()
+		cache := newCache(7, WithJanitor[string, int](time.Hour)) // The janitor is run manually.
+		defer cache.Close()
+		cache.now = func() time.Time { return now }
+		cache.Get("frontend")
+		cache.Get("backend")
+		assertNoError(t, cache.Add("marketing", 7, "org-2")) // "sales" is evicted.
+		assertSubtree(cache, "org-1", 4, []int{1, 1, 2})
+		assertSubtree(cache, "org-2", 2, []int{1, 1})
+
+		assertNoError(t, cache.AddWithTTL("tmp", 8, "frontend", time.Minute)) // "backend" is evicted.
+		assertSubtree(cache, "root", 7, []int{1, 2, 2, 1, 1})
+		now = now.Add(time.Minute)
+		_, ok := cache.SubtreeSize("tmp")
+		assertFalse(t, ok)
+		assertSubtree(cache, "root", 7, []int{1, 2, 2, 1, 1}) // Expired nodes are included until they are reaped.
+		cache.reapExpired()
+		assertSubtree(cache, "root", 6, []int{1, 2, 2, 1})
+		assertNoError(t, cache.Validate())
+	})
+}
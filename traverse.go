@@ -0,0 +1,206 @@
+package lrutree
+
+import (
+	"slices"
+	"time"
+)
+
+// TraverseAction is returned by the WalkSubtree callback to control the traversal.
+type TraverseAction int
+
+const (
+	// TraverseContinue continues the traversal.
+	TraverseContinue TraverseAction = iota
+
+	// TraverseSkipChildren continues the traversal, but doesn't descend into the children of the current node.
+	// It has no effect in post-order traversal, since children are visited before their parent.
+	TraverseSkipChildren
+
+	// TraverseStop stops the traversal immediately.
+	TraverseStop
+)
+
+// TraversalOrder defines the order in which TraverseSubtree and WalkSubtree visit nodes.
+type TraversalOrder int
+
+const (
+	// TraversePreOrder visits a node before its descendants (depth-first). It's the default order.
+	TraversePreOrder TraversalOrder = iota
+
+	// TraversePostOrder visits a node after all its descendants (depth-first).
+	TraversePostOrder
+
+	// TraverseBreadthFirst visits nodes level by level, so all nodes at depth N are visited before nodes at depth N+1.
+	TraverseBreadthFirst
+)
+
+// WithTraversalOrder sets the order in which TraverseSubtree and WalkSubtree visit nodes.
+// TraversePreOrder is used by default.
+func WithTraversalOrder(order TraversalOrder) TraverseSubtreeOption {
+	return func(opts *traverseOptions) {
+		opts.order = order
+	}
+}
+
+// WithChildOrder returns an option that makes TraverseSubtree, PeekSubtree and WalkSubtree visit children
+// of every node in the order defined by cmp (as in slices.SortFunc), so the traversal is deterministic.
+// Without it, the order of siblings is unspecified.
+// The option is bound to the key type of the cache, so a comparator of another key type doesn't compile
+// (the option is ignored if it's passed to a cache with another key type).
+func (c *Cache[K, V]) WithChildOrder(cmp func(a, b K) int) TraverseSubtreeOption {
+	return func(opts *traverseOptions) {
+		opts.childCmp = cmp
+	}
+}
+
+// WalkSubtree works like TraverseSubtree, but the callback controls the traversal by returning a TraverseAction:
+// TraverseContinue, TraverseSkipChildren to not descend into the children of the current node,
+// or TraverseStop to stop the traversal.
+//
+// Only visited nodes (and their ancestors) are marked as recently used,
+// so searching a large subtree for the first match doesn't promote the whole subtree.
+// All options of TraverseSubtree are supported.
+func (c *Cache[K, V]) WalkSubtree(
+	key K, f func(key K, val V, parentKey K) TraverseAction, options ...TraverseSubtreeOption,
+) {
+	defer c.observe(OpTraverseSubtree)()
+
+	c.traverseSubtree(key, f, options)
+}
+
+func (c *Cache[K, V]) traverseSubtree(
+	key K, f func(key K, val V, parentKey K) TraverseAction, options []TraverseSubtreeOption,
+) {
+	var reapedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(reapedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node, exists := c.keysMap[key]
+	if exists && c.reapIfExpired(node, c.now(), &reapedNodes) {
+		exists = false
+	}
+	if !exists {
+		c.stats.IncMisses()
+		return
+	}
+
+	opts := traverseOptions{
+		maxDepth: -1, // Default: unlimited depth
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	defer func() {
+		// We need to update LRU in defer to ensure that the order is correct even if f panics.
+		for n := node.parent; n != nil; n = n.parent {
+			c.promote(n)
+		}
+	}()
+
+	walkTree(node, c.now(), opts, func(n *treeNode[K, V]) TraverseAction {
+		return f(n.key, n.val, n.parentKey())
+	}, c.promote)
+
+	c.stats.IncHits()
+}
+
+// walkTree visits the node and its non-expired descendants according to the options.
+// leave is called for every visited node and for ancestors of visited nodes within the subtree (if the traversal stopped
+// before visiting them) after all their visited descendants, even if visit panics.
+// It's used to mark nodes as recently used, so parents end up in front of their descendants in the LRU list.
+func walkTree[K comparable, V any](
+	node *treeNode[K, V],
+	now time.Time,
+	opts traverseOptions,
+	visit func(n *treeNode[K, V]) TraverseAction,
+	leave func(n *treeNode[K, V]),
+) {
+	childCmp, _ := opts.childCmp.(func(a, b K) int) // Set by WithChildOrder of a cache with the same key type.
+	children := func(n *treeNode[K, V]) []*treeNode[K, V] {
+		result := make([]*treeNode[K, V], 0, len(n.children))
+		for _, child := range n.children {
+			if !child.isExpired(now) {
+				result = append(result, child)
+			}
+		}
+		if childCmp != nil {
+			slices.SortFunc(result, func(a, b *treeNode[K, V]) int { return childCmp(a.key, b.key) })
+		}
+		return result
+	}
+	canDescend := func(depth int) bool {
+		return opts.maxDepth < 0 || depth < opts.maxDepth
+	}
+
+	switch opts.order {
+	case TraverseBreadthFirst:
+		type queuedNode struct {
+			node  *treeNode[K, V]
+			depth int
+		}
+		queue := []queuedNode{{node, 0}}
+		visitedCount := 0
+		defer func() {
+			// Nodes are left in reverse order, so parents are left after their descendants.
+			for i := visitedCount - 1; i >= 0; i-- {
+				leave(queue[i].node)
+			}
+		}()
+	loop:
+		for visitedCount < len(queue) {
+			cur := queue[visitedCount]
+			visitedCount++
+			switch visit(cur.node) {
+			case TraverseStop:
+				break loop
+			case TraverseSkipChildren:
+				continue
+			}
+			if canDescend(cur.depth) {
+				for _, child := range children(cur.node) {
+					queue = append(queue, queuedNode{child, cur.depth + 1})
+				}
+			}
+		}
+
+	case TraversePostOrder:
+		var walk func(n *treeNode[K, V], depth int) (stopped bool)
+		walk = func(n *treeNode[K, V], depth int) bool {
+			defer leave(n)
+			if canDescend(depth) {
+				for _, child := range children(n) {
+					if walk(child, depth+1) {
+						return true
+					}
+				}
+			}
+			return visit(n) == TraverseStop
+		}
+		walk(node, 0)
+
+	default:
+		var walk func(n *treeNode[K, V], depth int) (stopped bool)
+		walk = func(n *treeNode[K, V], depth int) bool {
+			defer leave(n)
+			switch visit(n) {
+			case TraverseStop:
+				return true
+			case TraverseSkipChildren:
+				return false
+			}
+			if canDescend(depth) {
+				for _, child := range children(n) {
+					if walk(child, depth+1) {
+						return true
+					}
+				}
+			}
+			return false
+		}
+		walk(node, 0) // Start at depth 0 (root of subtree)
+	}
+
+}
@@ -0,0 +1,132 @@
+package lrutree
+
+import (
+	"cmp"
+	"testing"
+)
+
+func TestCache_WalkSubtree(t *testing.T) {
+	//         root
+	//        /    \
+	//       a      b
+	//      / \      \
+	//    a1   a2     b1
+	//    |
+	//   a11
+	newCache := func() *Cache[string, int] {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("b", 2, "root"))
+		assertNoError(t, cache.Add("b1", 21, "b"))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Add("a2", 12, "a"))
+		assertNoError(t, cache.Add("a1", 11, "a"))
+		assertNoError(t, cache.Add("a11", 111, "a1"))
+		return cache
+	}
+
+	walk := func(
+		cache *Cache[string, int], key string, action func(key string) TraverseAction, options ...TraverseSubtreeOption,
+	) []string {
+		var visited []string
+		cache.WalkSubtree(key, func(key string, val int, parentKey string) TraverseAction {
+			visited = append(visited, key)
+			return action(key)
+		}, append([]TraverseSubtreeOption{cache.WithChildOrder(cmp.Compare[string])}, options...)...)
+		return visited
+	}
+	continueAll := func(string) TraverseAction { return TraverseContinue }
+
+	t.Run("orders", func(t *testing.T) {
+		cache := newCache()
+		assertEqual(t, []string{"root", "a", "a1", "a11", "a2", "b", "b1"}, walk(cache, "root", continueAll))
+		// Every node is marked as recently used after its descendants, like in TraverseSubtree.
+		assertEqual(t, []string{"root", "b", "b1", "a", "a2", "a1", "a11"}, getLRUOrder(cache))
+
+		assertEqual(t, []string{"a11", "a1", "a2", "a", "b1", "b", "root"},
+			walk(cache, "root", continueAll, WithTraversalOrder(TraversePostOrder)))
+		assertNoError(t, cache.Validate())
+
+		assertEqual(t, []string{"root", "a", "b", "a1", "a2", "b1", "a11"},
+			walk(cache, "root", continueAll, WithTraversalOrder(TraverseBreadthFirst)))
+		assertNoError(t, cache.Validate())
+
+		assertEqual(t, []string{"root", "a", "b", "a1", "a2", "b1"},
+			walk(cache, "root", continueAll, WithTraversalOrder(TraverseBreadthFirst), WithMaxDepth(2)))
+		assertEqual(t, []string{"a1", "a2", "a"},
+			walk(cache, "a", continueAll, WithTraversalOrder(TraversePostOrder), WithMaxDepth(1)))
+	})
+
+	t.Run("skip children", func(t *testing.T) {
+		skipA := func(key string) TraverseAction {
+			if key == "a" {
+				return TraverseSkipChildren
+			}
+			return TraverseContinue
+		}
+		for _, order := range []TraversalOrder{TraversePreOrder, TraverseBreadthFirst} {
+			cache := newCache()
+			assertEqual(t, 4, len(walk(cache, "root", skipA, WithTraversalOrder(order))))
+			// Skipped nodes are not marked as recently used.
+			assertEqual(t, []string{"a1", "a11", "a2"}, getLRUOrder(cache)[4:])
+			assertNoError(t, cache.Validate())
+		}
+		// Children are already visited in post-order, so skipping has no effect.
+		assertEqual(t, 7, len(walk(newCache(), "root", skipA, WithTraversalOrder(TraversePostOrder))))
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		stopAt := func(stopKey string) func(string) TraverseAction {
+			return func(key string) TraverseAction {
+				if key == stopKey {
+					return TraverseStop
+				}
+				return TraverseContinue
+			}
+		}
+
+		cache := newCache()
+		cache.Get("b1")
+		assertEqual(t, []string{"root", "a", "a1", "a11"}, walk(cache, "root", stopAt("a11")))
+		assertEqual(t, []string{"root", "a", "a1", "a11", "b", "b1", "a2"}, getLRUOrder(cache))
+
+		cache = newCache()
+		assertEqual(t, []string{"root", "a", "b", "a1"},
+			walk(cache, "root", stopAt("a1"), WithTraversalOrder(TraverseBreadthFirst)))
+		assertNoError(t, cache.Validate())
+
+		cache = newCache()
+		assertEqual(t, []string{"a11", "a1"}, walk(cache, "root", stopAt("a1"), WithTraversalOrder(TraversePostOrder)))
+		// Ancestors of visited nodes are promoted even though they are not visited yet.
+		assertEqual(t, []string{"root", "a", "a1", "a11", "a2", "b", "b1"}, getLRUOrder(cache))
+		assertNoError(t, cache.Validate())
+	})
+
+	t.Run("non-existent key", func(t *testing.T) {
+		stats := &Stats{}
+		cache := NewCache[string, int](10, WithStatsCollector[string, int](stats))
+		assertEqual(t, 0, len(walk(cache, "nonexistent", continueAll)))
+		assertEqual(t, uint64(1), stats.Snapshot().Misses)
+	})
+
+	t.Run("child order of another key type is ignored", func(t *testing.T) {
+		type ID string
+		cache := NewCache[ID, int](10)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		var visited []ID
+		cache.PeekSubtree("root", func(key ID, val int, parentKey ID) {
+			visited = append(visited, key)
+		}, newCache().WithChildOrder(cmp.Compare[string]))
+		assertEqual(t, []ID{"root", "a"}, visited)
+	})
+
+	t.Run("TraverseSubtree with options", func(t *testing.T) {
+		cache := newCache()
+		var visited []string
+		cache.TraverseSubtree("a", func(key string, val int, parentKey string) {
+			visited = append(visited, key)
+		}, WithTraversalOrder(TraversePostOrder), cache.WithChildOrder(cmp.Compare[string]))
+		assertEqual(t, []string{"a11", "a1", "a2", "a"}, visited)
+	})
+}
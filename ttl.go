@@ -0,0 +1,248 @@
+package lrutree
+
+import (
+	"container/heap"
+	"time"
+)
+
+// ExpirationMode defines how node expiration preserves the guarantee
+// that ancestors are never removed before their descendants.
+type ExpirationMode int
+
+const (
+	// ExpireWithSubtree makes an expired node take its whole subtree with it.
+	// The expiration time of a node is capped by the expiration time of its parent,
+	// so descendants never outlive their ancestors.
+	ExpireWithSubtree ExpirationMode = iota
+
+	// ExpireAfterDescendants keeps a node in the cache until all its descendants expire.
+	// The expiration time of a node is extended to the latest expiration time in its subtree.
+	// Note that the extended expiration time is not shrunk back when descendants are removed.
+	ExpireAfterDescendants
+)
+
+// WithTTL sets the default TTL for nodes added by Add and AddOrUpdate.
+// A non-positive TTL (default) means nodes never expire.
+// The root node never expires.
+func WithTTL[K comparable, V any](ttl time.Duration) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.defaultTTL = ttl
+	}
+}
+
+// WithExpirationMode sets how expiration of a parent node interacts with its descendants.
+// ExpireWithSubtree is used by default.
+func WithExpirationMode[K comparable, V any](mode ExpirationMode) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.expirationMode = mode
+	}
+}
+
+// WithJanitor starts a background goroutine that removes expired nodes from the cache
+// every interval. Removed nodes are reported via the WithOnEvict callback.
+// Without the janitor, expired nodes are treated as missing and are removed lazily
+// when they are accessed by methods that modify the LRU order.
+//
+// Nodes with expiration times are kept in a queue ordered by these times, so every run takes time
+// proportional to the number of expired nodes rather than the size of the cache.
+// The janitor goroutine is stopped by Close.
+func WithJanitor[K comparable, V any](interval time.Duration) CacheOption[K, V] {
+	return func(c *Cache[K, V]) {
+		c.janitorInterval = interval
+	}
+}
+
+// Close stops the background goroutines started by WithJanitor, WithBufferedPromotion and WithRefreshAfter, if any.
+// It is safe to call Close multiple times. The cache remains usable after Close.
+func (c *Cache[K, V]) Close() {
+	c.closeOnce.Do(func() {
+		if c.janitorStop != nil {
+			close(c.janitorStop)
+			<-c.janitorDone
+		}
+		if c.accessBuf != nil {
+			c.stopAccessBufferDrainer()
+		}
+		if c.refreshCtx != nil {
+			c.stopRefreshes()
+		}
+	})
+}
+
+func (c *Cache[K, V]) startJanitor() {
+	c.expirations = &expirationQueue[K, V]{}
+	c.janitorStop = make(chan struct{})
+	c.janitorDone = make(chan struct{})
+	go func() {
+		defer close(c.janitorDone)
+		ticker := time.NewTicker(c.janitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.reapExpired()
+			case <-c.janitorStop:
+				return
+			}
+		}
+	}()
+}
+
+// reapExpired removes all expired nodes and tombstones from the cache and reports the nodes via the onEvict callback.
+// Expired nodes are taken from the expiration queue, so it takes O(k log n) time for k expired nodes
+// instead of walking the whole tree under the lock.
+func (c *Cache[K, V]) reapExpired() {
+	var reapedNodes []removedNode[K, V]
+	defer func() { c.notifyRemoved(reapedNodes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	q := c.expirations
+	for q.Len() != 0 && !now.Before((*q)[0].expiresAt) {
+		entry := heap.Pop(q).(expirationEntry[K, V])
+		if !c.isQueued(entry) {
+			continue
+		}
+		if entry.node.absent {
+			c.deleteNegative(entry.node)
+			continue
+		}
+		c.reapIfExpired(entry.node, now, &reapedNodes)
+	}
+
+	if len(reapedNodes) != 0 {
+		c.reportAmount()
+	}
+}
+
+// expirationEntry is an entry of the expiration queue.
+type expirationEntry[K comparable, V any] struct {
+	node      *treeNode[K, V]
+	expiresAt time.Time
+}
+
+// expirationQueue is a min-heap of nodes and tombstones ordered by their expiration times, used by the janitor.
+// Entries are not updated when nodes are removed or their expiration times change, instead a new entry is pushed
+// for every new expiration time, and outdated entries are skipped when popped (see isQueued).
+type expirationQueue[K comparable, V any] []expirationEntry[K, V]
+
+func (q expirationQueue[K, V]) Len() int           { return len(q) }
+func (q expirationQueue[K, V]) Less(i, j int) bool { return q[i].expiresAt.Before(q[j].expiresAt) }
+func (q expirationQueue[K, V]) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *expirationQueue[K, V]) Push(x any)        { *q = append(*q, x.(expirationEntry[K, V])) }
+
+func (q *expirationQueue[K, V]) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	old[len(old)-1] = expirationEntry[K, V]{} // Release the reference to the node.
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// setExpiresAt sets the expiration time of the node (or tombstone) and queues it for the janitor, if any.
+func (c *Cache[K, V]) setExpiresAt(node *treeNode[K, V], expiresAt time.Time) {
+	node.expiresAt = expiresAt
+	if c.expirations == nil || expiresAt.IsZero() {
+		return
+	}
+	heap.Push(c.expirations, expirationEntry[K, V]{node: node, expiresAt: expiresAt})
+
+	// Outdated entries are dropped when they prevail, so the queue doesn't grow with repeated updates.
+	if live := len(c.keysMap) + len(c.negatives); c.expirations.Len() > 2*live+64 {
+		q := (*c.expirations)[:0]
+		for _, entry := range *c.expirations {
+			if c.isQueued(entry) {
+				q = append(q, entry)
+			}
+		}
+		clear((*c.expirations)[len(q):])
+		*c.expirations = q
+		heap.Init(c.expirations)
+	}
+}
+
+// isQueued reports whether the entry of the expiration queue is up to date,
+// i.e. its node is still in the cache and its expiration time hasn't changed since the entry was pushed.
+func (c *Cache[K, V]) isQueued(entry expirationEntry[K, V]) bool {
+	node := entry.node
+	if !node.expiresAt.Equal(entry.expiresAt) {
+		return false
+	}
+	if node.absent {
+		return c.negatives[node.key] == node
+	}
+	return c.keysMap[node.key] == node
+}
+
+// reapIfExpired removes the node with its subtree if the node is expired.
+// All descendants of an expired node are expired as well, so the whole subtree may be removed.
+// Removed nodes are appended to reaped. It returns true if the node was removed.
+func (c *Cache[K, V]) reapIfExpired(node *treeNode[K, V], now time.Time, reaped *[]removedNode[K, V]) bool {
+	if !node.isExpired(now) {
+		return false
+	}
+	reapedCount := c.removeSubtree(node, func(n *treeNode[K, V]) {
+		*reaped = append(*reaped, removedNode[K, V]{n.toCacheNode(), RemovalExpired})
+	})
+	if c.extStats != nil {
+		c.extStats.AddExpirations(reapedCount)
+	}
+	c.reportAmount()
+	return true
+}
+
+// setExpiration sets the expiration time of the node and adjusts expiration times
+// of its ancestors or descendants (depending on the expiration mode),
+// so ancestors never expire before their descendants.
+func (c *Cache[K, V]) setExpiration(node *treeNode[K, V], expiresAt time.Time) {
+	switch c.expirationMode {
+	case ExpireAfterDescendants:
+		for _, child := range node.children {
+			if expiresEarlier(expiresAt, child.expiresAt) {
+				expiresAt = child.expiresAt
+			}
+		}
+		c.setExpiresAt(node, expiresAt)
+		for n := node.parent; n != nil && expiresEarlier(n.expiresAt, expiresAt); n = n.parent {
+			c.setExpiresAt(n, expiresAt)
+		}
+	default:
+		if node.parent != nil && expiresEarlier(node.parent.expiresAt, expiresAt) {
+			expiresAt = node.parent.expiresAt
+		}
+		c.setExpiresAt(node, expiresAt)
+		var capSubtree func(n *treeNode[K, V])
+		capSubtree = func(n *treeNode[K, V]) {
+			for _, child := range n.children {
+				if expiresEarlier(n.expiresAt, child.expiresAt) {
+					c.setExpiresAt(child, n.expiresAt)
+					capSubtree(child)
+				}
+			}
+		}
+		capSubtree(node)
+	}
+}
+
+func (n *treeNode[K, V]) isExpired(now time.Time) bool {
+	return !n.expiresAt.IsZero() && !now.Before(n.expiresAt)
+}
+
+// expirationTime returns the expiration time for the given TTL.
+// Zero time is returned for non-positive TTL, which means no expiration.
+func expirationTime(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// expiresEarlier reports whether expiration time a comes before b. Zero time means no expiration.
+func expiresEarlier(a, b time.Time) bool {
+	if a.IsZero() {
+		return false
+	}
+	return b.IsZero() || a.Before(b)
+}
@@ -0,0 +1,364 @@
+package lrutree
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually controlled clock for testing expiration.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.now = fc.now.Add(d)
+}
+
+func TestCache_AddWithTTL(t *testing.T) {
+	t.Run("expired node is a miss", func(t *testing.T) {
+		clock := newFakeClock()
+		var evicted []string
+		cache := NewCache[string, int](10, WithOnEvict(func(node CacheNode[string, int]) {
+			evicted = append(evicted, node.Key)
+		}))
+		cache.now = clock.Now
+
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.AddWithTTL("child", 2, "root", time.Minute))
+		assertNoError(t, cache.Add("other", 3, "root"))
+
+		_, ok := cache.Peek("child")
+		assertTrue(t, ok)
+
+		clock.Advance(time.Minute)
+
+		_, ok = cache.Peek("child")
+		assertFalse(t, ok)
+		assertEqual(t, 0, len(cache.PeekBranch("child")))
+		assertNil(t, evicted)
+		assertEqual(t, 3, cache.Len()) // Peek doesn't reap expired nodes.
+
+		_, ok = cache.Get("child")
+		assertFalse(t, ok)
+		assertEqual(t, []string{"child"}, evicted)
+		assertEqual(t, 2, cache.Len())
+		assertEqual(t, []string{"root", "other"}, getLRUOrder(cache))
+
+		// Node without TTL never expires.
+		clock.Advance(time.Hour)
+		_, ok = cache.Get("other")
+		assertTrue(t, ok)
+	})
+
+	t.Run("expired node may be added again", func(t *testing.T) {
+		clock := newFakeClock()
+		cache := NewCache[string, int](10)
+		cache.now = clock.Now
+
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.AddWithTTL("child", 2, "root", time.Minute))
+		assertErrorIs(t, cache.Add("child", 3, "root"), ErrAlreadyExists)
+
+		clock.Advance(time.Minute)
+		assertErrorIs(t, cache.Add("grandchild", 4, "child"), ErrParentNotExist)
+		assertNoError(t, cache.Add("child", 3, "root"))
+		cacheNode, ok := cache.Get("child")
+		assertTrue(t, ok)
+		assertEqual(t, CacheNode[string, int]{Key: "child", Value: 3, ParentKey: "root"}, cacheNode)
+	})
+
+	t.Run("default TTL", func(t *testing.T) {
+		clock := newFakeClock()
+		cache := NewCache[string, int](10, WithTTL[string, int](time.Minute))
+		cache.now = clock.Now
+
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.Add("child1", 2, "root"))
+		assertNoError(t, cache.AddWithTTL("child2", 3, "root", time.Hour))
+		assertNoError(t, cache.AddWithTTL("child3", 4, "root", 0))
+
+		clock.Advance(time.Minute)
+		_, ok := cache.Get("root")
+		assertTrue(t, ok)
+		_, ok = cache.Get("child1")
+		assertFalse(t, ok)
+		_, ok = cache.Get("child2")
+		assertTrue(t, ok)
+		_, ok = cache.Get("child3")
+		assertTrue(t, ok)
+	})
+}
+
+func TestCache_AddOrUpdateWithTTL(t *testing.T) {
+	clock := newFakeClock()
+	cache := NewCache[string, int](10, WithTTL[string, int](time.Minute))
+	cache.now = clock.Now
+
+	assertNoError(t, cache.AddRoot("root", 1))
+	assertNoError(t, cache.AddOrUpdate("child", 2, "root"))
+
+	// Updating the node resets its expiration time.
+	clock.Advance(30 * time.Second)
+	assertNoError(t, cache.AddOrUpdate("child", 3, "root"))
+	clock.Advance(40 * time.Second)
+	cacheNode, ok := cache.Get("child")
+	assertTrue(t, ok)
+	assertEqual(t, 3, cacheNode.Value)
+
+	assertNoError(t, cache.AddOrUpdateWithTTL("child", 4, "root", time.Hour))
+	clock.Advance(time.Minute)
+	cacheNode, ok = cache.Get("child")
+	assertTrue(t, ok)
+	assertEqual(t, 4, cacheNode.Value)
+
+	// Expired node is replaced with a new one.
+	clock.Advance(time.Hour)
+	assertNoError(t, cache.AddOrUpdateWithTTL("child", 5, "root", time.Hour))
+	cacheNode, ok = cache.Get("child")
+	assertTrue(t, ok)
+	assertEqual(t, 5, cacheNode.Value)
+
+	// Expired parent is reported as missing.
+	assertNoError(t, cache.AddOrUpdateWithTTL("child2", 6, "root", time.Second))
+	clock.Advance(time.Second)
+	assertErrorIs(t, cache.AddOrUpdate("grandchild", 7, "child2"), ErrParentNotExist)
+	_, ok = cache.Peek("child2")
+	assertFalse(t, ok)
+}
+
+func TestCache_ExpirationMode(t *testing.T) {
+	setupCache := func(mode ExpirationMode) (*Cache[string, int], *fakeClock, *[]string) {
+		clock := newFakeClock()
+		var evicted []string
+		cache := NewCache[string, int](10,
+			WithExpirationMode[string, int](mode),
+			WithOnEvict(func(node CacheNode[string, int]) {
+				evicted = append(evicted, node.Key)
+			}),
+		)
+		cache.now = clock.Now
+		assertNoError(t, cache.AddRoot("root", 1))
+		assertNoError(t, cache.AddWithTTL("parent", 2, "root", time.Minute))
+		assertNoError(t, cache.AddWithTTL("child", 3, "parent", time.Hour))
+		assertNoError(t, cache.AddWithTTL("grandchild", 4, "child", 0))
+		return cache, clock, &evicted
+	}
+
+	t.Run("expired parent takes its subtree", func(t *testing.T) {
+		cache, clock, evicted := setupCache(ExpireWithSubtree)
+
+		clock.Advance(time.Minute)
+		_, ok := cache.Peek("grandchild")
+		assertFalse(t, ok)
+		_, ok = cache.Get("parent")
+		assertFalse(t, ok)
+		assertEqual(t, []string{"grandchild", "child", "parent"}, *evicted)
+		assertEqual(t, []string{"root"}, getLRUOrder(cache))
+	})
+
+	t.Run("expired parent is kept until descendants expire", func(t *testing.T) {
+		cache, clock, evicted := setupCache(ExpireAfterDescendants)
+
+		clock.Advance(24 * time.Hour)
+		cacheNode, ok := cache.Get("parent")
+		assertTrue(t, ok)
+		assertEqual(t, 2, cacheNode.Value)
+		assertEqual(t, 4, cache.Len())
+
+		// Once the never-expiring grandchild is removed, the TTL of the chain may be shortened again.
+		assertEqual(t, 1, cache.Remove("grandchild"))
+		assertNoError(t, cache.AddOrUpdateWithTTL("child", 3, "parent", time.Minute))
+		assertNoError(t, cache.AddOrUpdateWithTTL("parent", 2, "root", time.Minute))
+		clock.Advance(time.Minute)
+		_, ok = cache.Peek("child")
+		assertFalse(t, ok)
+		_, ok = cache.Get("parent")
+		assertFalse(t, ok)
+		assertEqual(t, []string{"child", "parent"}, *evicted)
+	})
+
+	t.Run("reparenting under a short-lived parent", func(t *testing.T) {
+		cache, clock, _ := setupCache(ExpireWithSubtree)
+		assertNoError(t, cache.AddWithTTL("other", 5, "root", time.Second))
+		assertNoError(t, cache.AddOrUpdateWithTTL("child", 3, "other", time.Hour))
+
+		clock.Advance(time.Second)
+		_, ok := cache.Peek("grandchild")
+		assertFalse(t, ok)
+		_, ok = cache.Peek("parent")
+		assertTrue(t, ok)
+	})
+}
+
+func TestCache_Traverse_WithExpiredNodes(t *testing.T) {
+	clock := newFakeClock()
+	cache := NewCache[string, int](10)
+	cache.now = clock.Now
+
+	assertNoError(t, cache.AddRoot("root", 1))
+	assertNoError(t, cache.AddWithTTL("child1", 2, "root", time.Minute))
+	assertNoError(t, cache.Add("grandchild1", 3, "child1"))
+	assertNoError(t, cache.Add("child2", 4, "root"))
+	assertNoError(t, cache.Add("grandchild2", 5, "child2"))
+
+	clock.Advance(time.Minute)
+
+	var traversed []string
+	cache.TraverseSubtree("root", func(key string, val int, parentKey string) {
+		traversed = append(traversed, key)
+	})
+	sort.Strings(traversed)
+	assertEqual(t, []string{"child2", "grandchild2", "root"}, traversed)
+
+	traversed = nil
+	cache.TraverseToRoot("grandchild1", func(key string, val int, parentKey string) {
+		traversed = append(traversed, key)
+	})
+	assertNil(t, traversed)
+	assertEqual(t, 0, len(cache.GetBranch("child1")))
+	assertEqual(t, 3, cache.Len())
+}
+
+func TestCache_Janitor(t *testing.T) {
+	clock := newFakeClock()
+	evictedCh := make(chan CacheNode[string, int], 10)
+	cache := NewCache[string, int](10,
+		WithJanitor[string, int](time.Millisecond),
+		WithOnEvict(func(node CacheNode[string, int]) {
+			evictedCh <- node
+		}),
+	)
+	defer cache.Close()
+	cache.mu.Lock()
+	cache.now = clock.Now
+	cache.mu.Unlock()
+
+	assertNoError(t, cache.AddRoot("root", 1))
+	assertNoError(t, cache.AddWithTTL("child1", 2, "root", time.Minute))
+	assertNoError(t, cache.Add("grandchild1", 3, "child1"))
+	assertNoError(t, cache.AddWithTTL("child2", 4, "root", time.Hour))
+
+	clock.Advance(time.Minute)
+
+	var evicted []CacheNode[string, int]
+	for len(evicted) < 2 {
+		select {
+		case node := <-evictedCh:
+			evicted = append(evicted, node)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("janitor didn't reap expired nodes")
+		}
+	}
+	assertEqual(t, []CacheNode[string, int]{
+		{Key: "grandchild1", Value: 3, ParentKey: "child1"},
+		{Key: "child1", Value: 2, ParentKey: "root"},
+	}, evicted)
+	assertEqual(t, 2, cache.Len())
+
+	cache.Close()
+	cache.Close() // Close is idempotent.
+	_, ok := cache.Get("child2")
+	assertTrue(t, ok)
+}
+
+func TestCache_Janitor_ExpirationQueue(t *testing.T) {
+	// The janitor ticks once an hour, so reapExpired is called manually.
+	newCache := func(options ...CacheOption[string, int]) (*Cache[string, int], *fakeClock) {
+		clock := newFakeClock()
+		options = append(options, WithJanitor[string, int](time.Hour))
+		cache := NewCache[string, int](100, options...)
+		t.Cleanup(cache.Close)
+		cache.now = clock.Now
+		assertNoError(t, cache.AddRoot("root", 0))
+		return cache, clock
+	}
+
+	t.Run("outdated entries are skipped", func(t *testing.T) {
+		cache, clock := newCache()
+		assertNoError(t, cache.AddWithTTL("a", 1, "root", time.Minute))
+		assertNoError(t, cache.AddWithTTL("b", 2, "root", time.Minute))
+		assertNoError(t, cache.AddOrUpdateWithTTL("a", 1, "root", time.Hour)) // The TTL is extended.
+		assertNoError(t, cache.Rename("b", "c"))
+
+		clock.Advance(time.Minute)
+		cache.reapExpired()
+		assertEqual(t, []string{"a", "root"}, sortedKeys(cache))
+
+		assertNoError(t, cache.AddWithTTL("b", 2, "root", time.Hour)) // The key of the removed node is added again.
+		clock.Advance(time.Hour)
+		cache.reapExpired()
+		assertEqual(t, []string{"root"}, sortedKeys(cache))
+		assertEqual(t, 0, cache.expirations.Len())
+	})
+
+	t.Run("queue doesn't grow with repeated updates", func(t *testing.T) {
+		cache, _ := newCache()
+		for i := 0; i < 1000; i++ {
+			assertNoError(t, cache.AddOrUpdateWithTTL("a", i, "root", time.Duration(i+1)*time.Second))
+		}
+		assertTrue(t, cache.expirations.Len() <= 2*cache.Len()+64)
+	})
+
+	for _, mode := range []ExpirationMode{ExpireWithSubtree, ExpireAfterDescendants} {
+		t.Run(fmt.Sprintf("random operations, mode %d", mode), func(t *testing.T) {
+			cache, clock := newCache(WithExpirationMode[string, int](mode))
+			rnd := rand.New(rand.NewSource(42))
+			randKey := func() string { return fmt.Sprintf("k%d", rnd.Intn(30)) }
+			randParent := func() string {
+				if rnd.Intn(4) == 0 {
+					return "root"
+				}
+				return randKey()
+			}
+			randTTL := func() time.Duration { return time.Duration(rnd.Intn(10)) * time.Second }
+
+			for i := 0; i < 2000; i++ {
+				switch rnd.Intn(6) {
+				case 0:
+					_ = cache.AddWithTTL(randKey(), i, randParent(), randTTL())
+				case 1:
+					_ = cache.AddOrUpdateWithTTL(randKey(), i, randParent(), randTTL())
+				case 2:
+					_ = cache.Move(randKey(), randParent())
+				case 3:
+					cache.Remove(randKey())
+				case 4:
+					_ = cache.AddNegative(randKey(), randParent(), randTTL())
+				case 5:
+					clock.Advance(time.Duration(rnd.Intn(3)) * time.Second)
+					cache.reapExpired()
+
+					now := clock.Now()
+					for key, node := range cache.keysMap {
+						if node.isExpired(now) {
+							t.Fatalf("expired node %q is not reaped", key)
+						}
+					}
+					for key, negNode := range cache.negatives {
+						if negNode.isExpired(now) {
+							t.Fatalf("expired tombstone %q is not reaped", key)
+						}
+					}
+					assertNoError(t, cache.Validate())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package lrutree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidState is returned by Validate when the internal state of the cache violates its invariants.
+var ErrInvalidState = errors.New("invalid cache state")
+
+// Validate checks that the internal structures of the cache agree with each other. It's intended for debugging
+// and testing, since it walks over all nodes under the read lock.
+//
+// The following invariants are checked:
+//   - every node is registered under its key and has an element in the LRU list, and vice versa;
+//   - tombstones (see AddNegative) are registered in their parents and don't shadow existing nodes;
+//   - every parent contains the node among its children, and every child points back to its parent;
+//   - the number of descendants maintained for every node matches its subtree;
+//   - all ancestors of every node are present in the cache, and there are no cycles;
+//   - the set of roots matches nodes without parents (and there is at most one root unless WithMultipleRoots is used);
+//   - parents always precede their descendants in the LRU list;
+//   - ancestors never expire before their descendants;
+//   - the total cost, the number of pinned nodes and the registered subtree quotas match the nodes.
+//
+// An error wrapping ErrInvalidState that describes the first found violation is returned.
+func (c *Cache[K, V]) Validate() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.lruList.Len() != len(c.keysMap)+len(c.negatives) {
+		return fmt.Errorf("%w: LRU list has %d elements, but there are %d keys and %d tombstones",
+			ErrInvalidState, c.lruList.Len(), len(c.keysMap), len(c.negatives))
+	}
+
+	// Position of every node in the LRU list (0 is the most recently used).
+	positions := make(map[*treeNode[K, V]]int, len(c.keysMap))
+	pos := 0
+	for elem := c.lruList.Front(); elem != nil; elem = elem.Next() {
+		node, ok := elem.Value.(*treeNode[K, V])
+		if !ok || node.lruElem != elem {
+			return fmt.Errorf("%w: LRU list element at position %d doesn't belong to its node", ErrInvalidState, pos)
+		}
+		if node.absent {
+			if c.negatives[node.key] != node {
+				return fmt.Errorf("%w: tombstone %v from LRU list is not registered", ErrInvalidState, node.key)
+			}
+		} else if c.keysMap[node.key] != node {
+			return fmt.Errorf("%w: node %v from LRU list is not registered", ErrInvalidState, node.key)
+		}
+		positions[node] = pos
+		pos++
+	}
+
+	var totalCost int64
+	pinnedCount := 0
+	quotasCount := 0
+	rootsCount := 0
+	for key, node := range c.keysMap {
+		if node.key != key {
+			return fmt.Errorf("%w: node %v is registered under key %v", ErrInvalidState, node.key, key)
+		}
+		if _, ok := positions[node]; !ok {
+			return fmt.Errorf("%w: node %v is not in LRU list", ErrInvalidState, key)
+		}
+		totalCost += node.cost
+		if node.pinned {
+			pinnedCount++
+		}
+		if node.quota != 0 {
+			if _, ok := c.quotaNodes[node]; !ok {
+				return fmt.Errorf("%w: quota of node %v is not registered", ErrInvalidState, key)
+			}
+			quotasCount++
+		}
+
+		descendants := 0
+		for childKey, child := range node.children {
+			if child.key != childKey || child.parent != node {
+				return fmt.Errorf("%w: child %v of node %v doesn't point to it", ErrInvalidState, childKey, key)
+			}
+			descendants += child.descendants + 1
+		}
+		if node.descendants != descendants {
+			return fmt.Errorf("%w: node %v has %d descendants, but %d are counted",
+				ErrInvalidState, key, descendants, node.descendants)
+		}
+		for negKey, negNode := range node.absentChildren {
+			if c.negatives[negKey] != negNode || negNode.parent != node {
+				return fmt.Errorf("%w: tombstone %v of node %v is not registered", ErrInvalidState, negKey, key)
+			}
+			if positions[node] > positions[negNode] {
+				return fmt.Errorf("%w: node %v is behind its tombstone %v in LRU list", ErrInvalidState, key, negKey)
+			}
+		}
+
+		if node.parent == nil {
+			rootsCount++
+			if c.roots[key] != node {
+				return fmt.Errorf("%w: node %v without parent is not a root", ErrInvalidState, key)
+			}
+			continue
+		}
+		if node.parent.children[key] != node {
+			return fmt.Errorf("%w: parent %v doesn't contain node %v", ErrInvalidState, node.parent.key, key)
+		}
+		if positions[node.parent] > positions[node] {
+			return fmt.Errorf("%w: parent %v is behind node %v in LRU list", ErrInvalidState, node.parent.key, key)
+		}
+		if expiresEarlier(node.parent.expiresAt, node.expiresAt) {
+			return fmt.Errorf("%w: parent %v expires before node %v", ErrInvalidState, node.parent.key, key)
+		}
+
+		depth := 0
+		for n := node.parent; n != nil; n = n.parent {
+			if c.keysMap[n.key] != n {
+				return fmt.Errorf("%w: ancestor %v of node %v is not registered", ErrInvalidState, n.key, key)
+			}
+			if depth++; depth > len(c.keysMap) {
+				return fmt.Errorf("%w: cycle detected at node %v", ErrInvalidState, key)
+			}
+		}
+	}
+
+	for key, negNode := range c.negatives {
+		if _, exists := c.keysMap[key]; exists {
+			return fmt.Errorf("%w: node %v has a tombstone", ErrInvalidState, key)
+		}
+		if negNode.parent == nil || negNode.parent.absentChildren[key] != negNode || c.keysMap[negNode.parent.key] != negNode.parent {
+			return fmt.Errorf("%w: parent of tombstone %v is not registered", ErrInvalidState, key)
+		}
+	}
+
+	if rootsCount != len(c.roots) {
+		return fmt.Errorf("%w: there are %d nodes without parent, but %d roots", ErrInvalidState, rootsCount, len(c.roots))
+	}
+	if !c.multipleRoots && len(c.roots) > 1 {
+		return fmt.Errorf("%w: multiple roots", ErrInvalidState)
+	}
+	if totalCost != c.totalCost {
+		return fmt.Errorf("%w: total cost is %d, but nodes cost %d", ErrInvalidState, c.totalCost, totalCost)
+	}
+	if pinnedCount != c.pinnedCount {
+		return fmt.Errorf("%w: %d pinned nodes are counted, but %d are pinned", ErrInvalidState, c.pinnedCount, pinnedCount)
+	}
+	if quotasCount != len(c.quotaNodes) {
+		return fmt.Errorf("%w: %d quotas are registered, but %d nodes have quotas", ErrInvalidState, len(c.quotaNodes), quotasCount)
+	}
+
+	return nil
+}
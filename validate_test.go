@@ -0,0 +1,106 @@
+package lrutree
+
+import (
+	"testing"
+)
+
+func TestCache_Validate(t *testing.T) {
+	newCache := func() *Cache[string, int] {
+		cache := NewCache[string, int](10)
+		assertNoError(t, cache.AddRoot("root", 0))
+		assertNoError(t, cache.Add("a", 1, "root"))
+		assertNoError(t, cache.Add("b", 2, "a"))
+		assertNoError(t, cache.Add("c", 3, "root"))
+		return cache
+	}
+
+	assertNoError(t, newCache().Validate())
+	assertNoError(t, NewCache[string, int](10).Validate())
+
+	tests := []struct {
+		name    string
+		corrupt func(c *Cache[string, int])
+	}{
+		{"node is missing in LRU list", func(c *Cache[string, int]) {
+			c.lruList.Remove(c.keysMap["b"].lruElem)
+		}},
+		{"node is registered under another key", func(c *Cache[string, int]) {
+			c.keysMap["b"].key = "x"
+		}},
+		{"parent doesn't contain node", func(c *Cache[string, int]) {
+			delete(c.keysMap["a"].children, "b")
+		}},
+		{"child points to another parent", func(c *Cache[string, int]) {
+			c.keysMap["b"].parent = c.keysMap["c"]
+		}},
+		{"ancestor is not registered", func(c *Cache[string, int]) {
+			delete(c.keysMap, "a")
+			c.lruList.Remove(c.keysMap["b"].parent.lruElem)
+		}},
+		{"cycle", func(c *Cache[string, int]) {
+			a, b := c.keysMap["a"], c.keysMap["b"]
+			delete(c.keysMap["root"].children, "a")
+			a.parent = b
+			b.children["a"] = a
+		}},
+		{"root is not registered", func(c *Cache[string, int]) {
+			delete(c.roots, "root")
+		}},
+		{"parent is behind descendant", func(c *Cache[string, int]) {
+			c.lruList.MoveToFront(c.keysMap["b"].lruElem)
+		}},
+		{"parent expires before descendant", func(c *Cache[string, int]) {
+			c.keysMap["a"].expiresAt = c.now()
+		}},
+		{"total cost mismatch", func(c *Cache[string, int]) {
+			c.totalCost++
+		}},
+		{"pinned count mismatch", func(c *Cache[string, int]) {
+			c.keysMap["b"].pinned = true
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newCache()
+			tt.corrupt(cache)
+			assertErrorIs(t, cache.Validate(), ErrInvalidState)
+		})
+	}
+}
+
+// FuzzCache drives random sequences of operations and checks that the cache invariants hold after each of them.
+// Every operation is encoded by 3 bytes: the operation itself, the key and the parent key.
+func FuzzCache(f *testing.F) {
+	f.Add([]byte{0, 1, 0, 0, 2, 1, 0, 3, 2, 2, 1, 0, 3, 3, 0, 1, 2, 3})
+	f.Add([]byte{0, 1, 0, 0, 2, 1, 1, 1, 2, 1, 2, 1, 4, 2, 0, 5, 1, 0})
+	f.Add([]byte{0, 1, 0, 6, 2, 1, 7, 2, 0, 0, 2, 1, 6, 3, 2, 3, 2, 0, 6, 4, 0, 0, 5, 0, 0, 6, 0, 0, 7, 0, 0, 8, 0})
+	f.Add([]byte{0, 1, 0, 0, 2, 1, 0, 3, 1, 0, 4, 3, 0, 5, 4, 0, 6, 5, 0, 7, 6, 0, 8, 7, 3, 1, 0, 0, 9, 1})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cache := NewCache[int, int](8)
+		assertNoError(t, cache.AddRoot(0, 0))
+		for i := 0; i+2 < len(data); i += 3 {
+			key, parentKey := int(data[i+1]%16), int(data[i+2]%16)
+			switch data[i] % 8 {
+			case 0, 1:
+				_ = cache.Add(key, i, parentKey)
+			case 2:
+				_ = cache.AddOrUpdate(key, i, parentKey)
+			case 3:
+				cache.Remove(key)
+			case 4:
+				cache.Get(key)
+			case 5:
+				cache.GetBranch(key)
+			case 6:
+				_ = cache.AddNegative(key, parentKey, 0)
+			case 7:
+				cache.Lookup(key)
+			}
+			if err := cache.Validate(); err != nil {
+				t.Fatalf("invariant violated after operation %d: %v", i/3, err)
+			}
+			assertTrue(t, cache.Len() <= 8)
+		}
+	})
+}